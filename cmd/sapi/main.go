@@ -1,8 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"log/slog"
 
@@ -10,11 +17,25 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/sabbatD/srest-api/internal/blob"
 	"github.com/sabbatD/srest-api/internal/config"
 	sdb "github.com/sabbatD/srest-api/internal/database"
+	"github.com/sabbatD/srest-api/internal/health"
 	"github.com/sabbatD/srest-api/internal/http-server/handlers/admin"
+	"github.com/sabbatD/srest-api/internal/http-server/handlers/attachment"
+	"github.com/sabbatD/srest-api/internal/http-server/handlers/system"
 	"github.com/sabbatD/srest-api/internal/http-server/handlers/todo"
 	"github.com/sabbatD/srest-api/internal/http-server/handlers/user"
+	"github.com/sabbatD/srest-api/internal/jobs"
+	"github.com/sabbatD/srest-api/internal/maintenance"
+	"github.com/sabbatD/srest-api/internal/metrics"
+	"github.com/sabbatD/srest-api/internal/notify"
+	"github.com/sabbatD/srest-api/internal/outbox"
+	"github.com/sabbatD/srest-api/internal/scheduler"
+	"github.com/sabbatD/srest-api/internal/stream"
+	"github.com/sabbatD/srest-api/internal/tracing"
+	"github.com/sabbatD/srest-api/internal/trash"
+	"github.com/sabbatD/srest-api/internal/webhook"
 	httpSwagger "github.com/swaggo/http-swagger"
 
 	"github.com/sabbatD/srest-api/internal/lib/api/access"
@@ -48,16 +69,122 @@ func main() {
 	log.Info("Starting sAPI server")
 	log.Debug("Debug mode enabled")
 
+	flushTraces, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		SampleRatio: cfg.SampleRatio,
+		Service:     "sapi",
+		Version:     health.Version,
+	})
+	if err != nil {
+		log.Error("Failed to setup tracing", sl.Err(err))
+		os.Exit(1)
+	}
+
 	storage, err := sdb.SetupDataBase(cfg.DbString, cfg.Env)
 	if err != nil {
 		log.Error("Failed to setup database", sl.Err(err))
 		os.Exit(1)
 	}
 
+	storage.SetObserver(metrics.ObserveStorage)
+	metrics.RegisterDB(storage.Stats)
+
+	blobs, err := setupBlobStore(cfg.Attachments)
+	if err != nil {
+		log.Error("Failed to setup attachment storage", sl.Err(err))
+		os.Exit(1)
+	}
+
+	if cfg.Attachments.SigningKey == "" {
+		log.Error("Attachments signing key is not set")
+		os.Exit(1)
+	}
+	signer := blob.NewSigner([]byte(cfg.Attachments.SigningKey), cfg.Attachments.URLTTL)
+	limits := attachment.Limits{MaxSize: cfg.Attachments.MaxSize, Quota: cfg.Attachments.Quota}
+
+	// The background loops stop with ctx on shutdown, background tells when they are over.
+	ctx, stopBackground := context.WithCancel(context.Background())
+	var background sync.WaitGroup
+	spawn := func(run func(ctx context.Context)) {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			run(ctx)
+		}()
+	}
+
+	worker := jobs.NewWorker(storage, log, jobs.WorkerOptions{
+		Concurrency:  cfg.Workers,
+		PollInterval: cfg.JobPollInterval,
+		Timeout:      cfg.JobTimeout,
+		Backoff:      cfg.JobBackoff,
+		MaxBackoff:   cfg.JobMaxBackoff,
+	})
+	jobs.Register(worker, trash.PurgeJob, trash.PurgeHandler(log, storage, blobs))
+	jobs.Register(worker, maintenance.TokensJob, maintenance.TokensHandler(log, storage))
+	jobs.Register(worker, maintenance.RetentionJob, maintenance.RetentionHandler(log, storage))
+	jobs.Register(worker, notify.ReminderJob, notify.ReminderHandler(log, storage))
+	jobs.Register(worker, notify.EmailJob, notify.EmailHandler(log, storage, setupMailer(cfg.Notifications, log)))
+	spawn(worker.Run)
+
+	sched, err := setupScheduler(cfg, storage, log)
+	if err != nil {
+		log.Error("Failed to setup scheduler", sl.Err(err))
+		os.Exit(1)
+	}
+	spawn(sched.Run)
+
+	broker, err := stream.New(ctx, cfg.Stream.Broker, cfg.DbString, log)
+	if err != nil {
+		log.Error("Failed to setup event stream", sl.Err(err))
+		os.Exit(1)
+	}
+	storage.SetPublisher(broker)
+
+	// closing is closed when the shutdown begins, so that the open event streams end instead of
+	// holding the shutdown until the timeout. Other requests keep their contexts and are drained.
+	closing := make(chan struct{})
+
+	dispatcher := webhook.NewDispatcher(storage, log, webhook.Options{
+		MaxAttempts:  cfg.Webhooks.MaxAttempts,
+		Backoff:      cfg.Webhooks.Backoff,
+		MaxBackoff:   cfg.Webhooks.MaxBackoff,
+		Timeout:      cfg.Webhooks.DeliveryTimeout,
+		PollInterval: cfg.Webhooks.PollInterval,
+	})
+	spawn(dispatcher.Run)
+
+	// Consumers in the process subscribe to the bus, for now domain events are only logged.
+	bus := outbox.NewBus()
+	bus.Subscribe(outbox.All, func(ctx context.Context, e outbox.Event) error {
+		log.Debug("domain event", slog.String("id", e.ID), slog.String("event", e.Type))
+		return nil
+	})
+
+	sinks, err := setupSinks(cfg.Outbox.Sinks, bus, storage)
+	if err != nil {
+		log.Error("Failed to setup outbox", sl.Err(err))
+		os.Exit(1)
+	}
+	spawn(outbox.NewRelay(storage, log, sinks, cfg.RelayInterval, cfg.RelayBatch).Run)
+
+	checker := setupChecker(storage, worker)
+
 	route := chi.NewRouter()
+	route.Use(metrics.Middleware)
+
+	// Probes for nginx, systemd and docker, outside of the API so they skip its middlewares.
+	route.Get("/healthz", system.Healthz())
+	route.Get("/readyz", system.Readyz(log, checker))
+	route.Get("/version", system.Version())
+
 	route.Route("/api/v1", func(router chi.Router) {
 
 		router.Use(middleware.RequestID)
+		router.Use(access.StripQueryToken)
+		router.Use(tracing.Middleware)
 		router.Use(middleware.Logger)
 		router.Use(middleware.Recoverer)
 		router.Use(middleware.URLFormat)
@@ -91,7 +218,24 @@ func main() {
 
 			u.Get("/profile", user.Profile(log, storage))
 			u.Put("/profile", user.UpdateUser(log, storage))
+			u.Patch("/profile", user.PatchProfile(log, storage))
 			u.Put("/profile/reset-password", user.ChangePassword(log, storage))
+
+			u.Post("/feed", user.RegenerateFeed(log, storage))
+			u.Delete("/feed", user.RevokeFeed(log, storage))
+
+			u.Get("/shares", todo.IncomingShares(log, storage))
+			u.Post("/shares/{id}/accept", todo.AcceptShare(log, storage))
+			u.Post("/shares/{id}/decline", todo.DeclineShare(log, storage))
+
+			u.Get("/timer", todo.ActiveTimer(log, storage))
+
+			u.Get("/notifications", user.Notifications(log, storage))
+			u.Post("/notifications/read", user.ReadAllNotifications(log, storage))
+			u.Get("/notifications/preferences", user.NotificationPreferences(log, storage))
+			u.Put("/notifications/preferences", user.SetNotificationPreferences(log, storage))
+			u.Post("/notifications/{id}/read", user.ReadNotification(log, storage))
+			u.Delete("/notifications/{id}", user.DeleteNotification(log, storage))
 		})
 
 		// Authenticated admin handlers
@@ -109,17 +253,113 @@ func main() {
 			r.Post("/users/{id}/block", admin.Block(log, storage))
 			r.Post("/users/{id}/unblock", admin.Unblock(log, storage))
 			r.Post("/users/{id}/rights", admin.Update(log, storage))
+
+			r.Get("/webhooks", admin.Webhooks(log, storage))
+			r.Post("/webhooks", admin.CreateWebhook(log, storage))
+			r.Get("/webhooks/deliveries", admin.Deliveries(log, storage))
+			r.Post("/webhooks/deliveries/{id}/replay", admin.ReplayDelivery(log, storage))
+			r.Get("/webhooks/{id}", admin.GetWebhook(log, storage))
+			r.Put("/webhooks/{id}", admin.UpdateWebhook(log, storage))
+			r.Delete("/webhooks/{id}", admin.DeleteWebhook(log, storage))
+			r.Get("/webhooks/{id}/deliveries", admin.Deliveries(log, storage))
+
+			r.Get("/jobs", admin.Jobs(log, storage))
+			r.Get("/jobs/{id}", admin.GetJob(log, storage))
+			r.Post("/jobs/{id}/retry", admin.RetryJob(log, storage))
+			r.Delete("/jobs/{id}", admin.DeleteJob(log, storage))
 		})
 
+		// Todo handlers
+		// OptionalJWTAuthMiddleware records the authenticated user as the actor of a change, anonymous changes are still allowed.
 		router.Route("/todos", func(t chi.Router) {
+			t.Use(access.OptionalJWTAuthMiddleware)
+
+			// EventSource and WebSocket clients can not send headers, streams take the token from the query as well.
+			t.Group(func(s chi.Router) {
+				s.Use(access.QueryJWTAuthMiddleware)
+
+				s.Get("/stream", todo.Stream(log, storage, broker, cfg.Stream.Heartbeat, closing))
+				s.Get("/stream/ws", todo.StreamWS(log, storage, broker, cfg.Stream.Heartbeat, closing))
+			})
+
+			t.Get("/ready", todo.Ready(log, storage))
+			t.Post("/bulk", todo.Bulk(log, storage))
+			t.Get("/export", todo.Export(log, storage))
+			t.Post("/import", todo.Import(log, storage))
+
+			t.Get("/trash", todo.Trash(log, storage))
+			t.Delete("/trash", todo.EmptyTrash(log, storage, blobs))
+			t.Post("/{id}/restore", todo.Restore(log, storage))
+
 			t.Get("/{id}", todo.Get(log, storage))
 			t.Put("/{id}", todo.Update(log, storage))
+			t.Patch("/{id}", todo.Patch(log, storage))
 			t.Delete("/{id}", todo.Delete(log, storage))
+			t.Post("/{id}/move", todo.Move(log, storage))
+
+			t.Get("/{id}/history", todo.History(log, storage))
+			t.Post("/{id}/revert", todo.Revert(log, storage))
+
+			t.Get("/{id}/dependencies", todo.Dependencies(log, storage))
+			t.Post("/{id}/dependencies", todo.AddDependency(log, storage))
+			t.Delete("/{id}/dependencies/{blockerId}", todo.RemoveDependency(log, storage))
+
+			// Comment authorship comes from the token, so comments require authentication.
+			t.Group(func(c chi.Router) {
+				c.Use(access.JWTAuthMiddleware)
+
+				c.Get("/{id}/comments", todo.Comments(log, storage))
+				c.Post("/{id}/comments", todo.CreateComment(log, storage))
+				c.Put("/{id}/comments/{commentId}", todo.UpdateComment(log, storage))
+				c.Delete("/{id}/comments/{commentId}", todo.DeleteComment(log, storage))
+
+				c.Get("/{id}/attachments", attachment.List(log, storage, signer))
+				c.Post("/{id}/attachments", attachment.Upload(log, storage, blobs, signer, limits))
+				c.Delete("/{id}/attachments/{attachmentId}", attachment.Delete(log, storage, blobs))
+
+				c.Get("/{id}/shares", todo.Shares(log, storage))
+				c.Post("/{id}/shares", todo.Share(log, storage))
+				c.Delete("/{id}/shares/{userId}", todo.Unshare(log, storage))
+
+				// Tracked time belongs to the user who tracked it.
+				c.Get("/time/report", todo.TimeReport(log, storage))
+				c.Get("/{id}/time", todo.TaskTime(log, storage))
+				c.Post("/{id}/time", todo.AddTime(log, storage))
+				c.Delete("/{id}/time/{entryId}", todo.DeleteTime(log, storage))
+				c.Post("/{id}/timer", todo.StartTimer(log, storage))
+				c.Delete("/{id}/timer", todo.StopTimer(log, storage))
+			})
 		})
 
-		// Todo handlers
-		router.Post("/todos", todo.Create(log, storage))
-		router.Get("/todos", todo.GetAll(log, storage))
+		// Download links are signed, so they work without the Authorization header.
+		router.Get("/attachments/{id}/download", attachment.Download(log, storage, blobs, signer))
+
+		// Calendar apps can not send the Authorization header, the feed token in the path authenticates them.
+		// URLFormat strips the .ics extension from the path.
+		router.Get("/feed/{token}", todo.Feed(log, storage))
+
+		router.With(access.OptionalJWTAuthMiddleware).Post("/todos", todo.Create(log, storage))
+		router.With(access.OptionalJWTAuthMiddleware).Get("/todos", todo.GetAll(log, storage))
+
+		// List handlers
+		// OptionalJWTAuthMiddleware makes the authenticated user the owner of new lists, anonymous lists are public.
+		router.Route("/lists", func(l chi.Router) {
+			l.Use(access.OptionalJWTAuthMiddleware)
+
+			l.Post("/", todo.CreateList(log, storage))
+			l.Get("/", todo.Lists(log, storage))
+			l.Get("/{id}/workflow", todo.Workflow(log, storage))
+			l.Put("/{id}/workflow", todo.SetWorkflow(log, storage))
+
+			// Shares are managed by the owner, so they require authentication.
+			l.Group(func(s chi.Router) {
+				s.Use(access.JWTAuthMiddleware)
+
+				s.Get("/{id}/shares", todo.ListShares(log, storage))
+				s.Post("/{id}/shares", todo.ShareList(log, storage))
+				s.Delete("/{id}/shares/{userId}", todo.UnshareList(log, storage))
+			})
+		})
 	})
 
 	log.Info("starting server", slog.String("address", cfg.Address))
@@ -130,12 +370,200 @@ func main() {
 		WriteTimeout: cfg.Timeout,
 		IdleTimeout:  cfg.IdleTimeout,
 	}
+	srv.RegisterOnShutdown(func() { close(closing) })
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Info("server started", slog.String("address", cfg.Address))
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	// The admin listener is kept apart from the API, nginx does not proxy it.
+	var admin *http.Server
+	if cfg.AdminAddress != "" {
+		adminRoute := chi.NewRouter()
+		adminRoute.Handle("/metrics", metrics.Handler())
+
+		admin = &http.Server{Addr: cfg.AdminAddress, Handler: adminRoute, ReadHeaderTimeout: cfg.Timeout}
+		go func() {
+			log.Info("admin server started", slog.String("address", cfg.AdminAddress))
+			if err := admin.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error("failed to start admin server", sl.Err(err))
+			}
+		}()
+	}
+
+	signals, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	failed := false
+	delay := cfg.ShutdownDelay
+	select {
+	case err := <-serverErr:
+		log.Error("failed to start server", sl.Err(err))
+		failed = true
+		delay = 0
+	case <-signals.Done():
+		log.Info("shutting down", slog.Duration("delay", cfg.ShutdownDelay), slog.Duration("timeout", cfg.ShutdownTimeout))
+	}
+	// A second signal kills the process right away.
+	cancel()
+
+	shutdown(log, srv, admin, checker, stopBackground, &background, storage, flushTraces, delay, cfg.ShutdownTimeout)
+
+	log.Info("server stopped")
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// setupChecker checks for readiness that the database is reachable and has every migration the service
+// knows of applied, and that the job workers run. The known migrations are only there when the service runs
+// from the source tree or its image, otherwise any applied version is accepted.
+func setupChecker(storage *sdb.Storage, worker *jobs.Worker) *health.Checker {
+	checker := health.NewChecker(2 * time.Second)
+
+	checker.Add("database", func(ctx context.Context) (any, error) {
+		return nil, storage.Ping(ctx)
+	})
+
+	latest, _ := sdb.LatestMigration(sdb.MigrationsDir)
+	checker.Add("migrations", func(ctx context.Context) (any, error) {
+		version, err := storage.MigrationVersion(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		detail := map[string]int64{"version": version, "latest": latest}
+		if version < latest {
+			return detail, fmt.Errorf("migration %d is not applied", latest)
+		}
+		return detail, nil
+	})
+
+	checker.Add("workers", func(ctx context.Context) (any, error) {
+		status := worker.Status()
+		if status.Running == 0 {
+			return status, errors.New("job workers are not running")
+		}
+		return status, nil
+	})
+
+	return checker
+}
+
+// shutdown fails the readiness check for delay, then stops accepting connections and waits for the requests
+// in flight, then stops the background loops and waits for the jobs they run, then closes the database and
+// flushes the traces, all within timeout after the delay. Whatever is still running after it is cut off:
+// requests are dropped and jobs are taken over once their leases expire. The admin server, if any, goes last
+// so the metrics can be scraped until the end.
+func shutdown(log *slog.Logger, srv, admin *http.Server, checker *health.Checker, stopBackground context.CancelFunc,
+	background *sync.WaitGroup, storage *sdb.Storage, flushTraces func(context.Context) error, delay, timeout time.Duration) {
+	// The listener stays open for delay, so nginx, systemd and docker see /readyz fail and stop
+	// sending requests instead of getting their connections refused.
+	checker.Drain()
+	time.Sleep(delay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Warn("requests did not finish in time", sl.Err(err))
+		srv.Close()
+	}
+
+	stopBackground()
+
+	done := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Warn("background workers did not stop in time")
+	}
+
+	if err := storage.Close(); err != nil {
+		log.Error("failed to close database", sl.Err(err))
+	}
+
+	if err := flushTraces(ctx); err != nil {
+		log.Warn("failed to flush traces", sl.Err(err))
+	}
+
+	if admin != nil {
+		if err := admin.Shutdown(ctx); err != nil {
+			admin.Close()
+		}
+	}
+}
+
+func setupBlobStore(cfg config.Attachments) (blob.BlobStore, error) {
+	switch cfg.Storage {
+	case "local":
+		return blob.NewLocal(cfg.Dir)
+	case "s3":
+		return blob.NewS3(cfg.Endpoint, cfg.AccessKey, cfg.SecretKey, cfg.Region, cfg.Bucket, cfg.UseSSL)
+	default:
+		return nil, fmt.Errorf("unknown attachment storage: %q", cfg.Storage)
+	}
+}
+
+func setupSinks(names []string, bus *outbox.Bus, storage *sdb.Storage) ([]outbox.Sink, error) {
+	var sinks []outbox.Sink
+	for _, name := range names {
+		switch name {
+		case "bus":
+			sinks = append(sinks, bus)
+		case "webhooks":
+			sinks = append(sinks, webhook.NewSink(storage))
+		case "stdout":
+			sinks = append(sinks, outbox.NewWriter(os.Stdout))
+		default:
+			return nil, fmt.Errorf("unknown outbox sink: %q", name)
+		}
+	}
+	return sinks, nil
+}
+
+// setupMailer sends the emails through SMTP, without an SMTP host they are only logged.
+func setupMailer(cfg config.Notifications, log *slog.Logger) notify.Mailer {
+	if cfg.SMTPHost == "" {
+		log.Warn("SMTP host is not set, notification emails are only logged")
+		return notify.Log{Log: log}
+	}
+
+	return notify.SMTP{Host: cfg.SMTPHost, Port: cfg.SMTPPort, User: cfg.SMTPUser, Password: cfg.SMTPPassword, From: cfg.From}
+}
+
+// setupScheduler schedules the maintenance jobs, the trash is only purged if tasks expire from it.
+func setupScheduler(cfg *config.Config, storage *sdb.Storage, log *slog.Logger) (*scheduler.Scheduler, error) {
+	sched := scheduler.New(storage, log, 0)
+
+	if err := sched.Add(cfg.TokensCleanup, maintenance.TokensJob, nil); err != nil {
+		return nil, err
+	}
+
+	if cfg.RetentionDays > 0 {
+		retention := time.Duration(cfg.RetentionDays) * 24 * time.Hour
+		if err := sched.Add(cfg.TrashPurge, trash.PurgeJob, trash.PurgeArgs{Retention: retention}); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := sched.Add(cfg.TodoReminders, notify.ReminderJob, notify.ReminderArgs{Before: cfg.RemindBefore}); err != nil {
+		return nil, err
+	}
 
-	if err := srv.ListenAndServe(); err != nil {
-		log.Error("failed to start server")
+	if err := sched.Add(cfg.RetentionPrune, maintenance.RetentionJob, maintenance.RetentionArgs{Keep: cfg.Keep}); err != nil {
+		return nil, err
 	}
 
-	log.Error("server stopped")
+	return sched, nil
 }
 
 func CORSMiddleware(next http.Handler) http.Handler {
@@ -146,8 +574,9 @@ func CORSMiddleware(next http.Handler) http.Handler {
 		}
 
 		w.Header().Set("Access-Control-Allow-Origin", origin)
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match, If-None-Match")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, Content-Disposition")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 
 		if r.Method == http.MethodOptions {
@@ -0,0 +1,71 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocal(t *testing.T) {
+	ctx := context.Background()
+
+	store, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Put(ctx, "todos/1/abc", strings.NewReader("hello"), 5, "text/plain"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	rc, err := store.Get(ctx, "todos/1/abc")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	b, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(b) != "hello" {
+		t.Errorf("Get() = %q, want hello", b)
+	}
+
+	if err := store.Delete(ctx, "todos/1/abc"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := store.Get(ctx, "todos/1/abc"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Delete error = %v, want ErrNotFound", err)
+	}
+
+	if err := store.Put(ctx, "../escape", strings.NewReader("x"), 1, "text/plain"); err == nil {
+		t.Errorf("Put() outside of the directory must fail")
+	}
+}
+
+func TestSigner(t *testing.T) {
+	s := NewSigner([]byte("secret"), time.Minute)
+
+	u, err := url.Parse(s.URL("/api/v1", 7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expires, signature := u.Query().Get("expires"), u.Query().Get("signature")
+
+	if !s.Verify(7, expires, signature) {
+		t.Errorf("Verify() = false for a fresh URL")
+	}
+	if s.Verify(8, expires, signature) {
+		t.Errorf("Verify() = true for another attachment")
+	}
+	if NewSigner([]byte("other"), time.Minute).Verify(7, expires, signature) {
+		t.Errorf("Verify() = true with another key")
+	}
+
+	expired := NewSigner([]byte("secret"), -time.Minute)
+	u, _ = url.Parse(expired.URL("/api/v1", 7))
+	if expired.Verify(7, u.Query().Get("expires"), u.Query().Get("signature")) {
+		t.Errorf("Verify() = true for an expired URL")
+	}
+}
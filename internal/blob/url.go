@@ -0,0 +1,46 @@
+package blob
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Signer signs time limited download URLs, so a link works without the Authorization header.
+type Signer struct {
+	key []byte
+	ttl time.Duration
+}
+
+func NewSigner(key []byte, ttl time.Duration) *Signer {
+	return &Signer{key: key, ttl: ttl}
+}
+
+// URL returns the download URL of an attachment valid for the signer ttl.
+func (s *Signer) URL(basePath string, id int) string {
+	expires := time.Now().Add(s.ttl).Unix()
+
+	return fmt.Sprintf("%s/attachments/%d/download?expires=%d&signature=%s", basePath, id, expires, s.sign(id, expires))
+}
+
+// Verify checks the expires and signature query values of a download URL.
+func (s *Signer) Verify(id int, expires, signature string) bool {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return false
+	}
+
+	want := s.sign(id, exp)
+
+	return hmac.Equal([]byte(want), []byte(signature))
+}
+
+func (s *Signer) sign(id int, expires int64) string {
+	mac := hmac.New(sha256.New, s.key)
+	fmt.Fprintf(mac, "%d:%d", id, expires)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
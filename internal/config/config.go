@@ -9,15 +9,120 @@ import (
 )
 
 type Config struct {
-	Env        string `yaml:"env" env-default:"local"`
-	DbString   string `yaml:"dbstring" env-required:"true"`
-	HTTPServer `yaml:"http_server"`
+	Env           string `yaml:"env" env-default:"local"`
+	DbString      string `yaml:"dbstring" env-required:"true"`
+	HTTPServer    `yaml:"http_server"`
+	Attachments   `yaml:"attachments"`
+	Trash         `yaml:"trash"`
+	Stream        `yaml:"stream"`
+	Webhooks      `yaml:"webhooks"`
+	Outbox        `yaml:"outbox"`
+	Jobs          `yaml:"jobs"`
+	Scheduler     `yaml:"scheduler"`
+	Notifications `yaml:"notifications"`
+	Tracing       `yaml:"tracing"`
 }
 
+// HTTPServer fails /readyz for ShutdownDelay on SIGINT or SIGTERM while still serving, so the proxies
+// stop sending requests, then waits up to ShutdownTimeout for the requests in flight and the background
+// jobs to finish. AdminAddress serves /metrics apart from the API, empty disables it.
 type HTTPServer struct {
-	Address     string        `yaml:"address" env-default:"0.0.0.0:8082"`
-	Timeout     time.Duration `yaml:"timeout" env-default:"4s"`
-	IdleTimeout time.Duration `yaml:"idleTimeout" env-default:"30s"`
+	Address         string        `yaml:"address" env-default:"0.0.0.0:8082"`
+	Timeout         time.Duration `yaml:"timeout" env-default:"4s"`
+	IdleTimeout     time.Duration `yaml:"idleTimeout" env-default:"30s"`
+	ShutdownDelay   time.Duration `yaml:"shutdown_delay" env-default:"5s"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env-default:"20s"`
+	AdminAddress    string        `yaml:"admin_address" env-default:"127.0.0.1:9090"`
+}
+
+type Attachments struct {
+	Storage    string        `yaml:"storage" env-default:"local"` // local, s3
+	Dir        string        `yaml:"dir" env-default:"./data/attachments"`
+	MaxSize    int64         `yaml:"max_size" env-default:"10485760"`
+	Quota      int64         `yaml:"quota" env-default:"104857600"`
+	URLTTL     time.Duration `yaml:"url_ttl" env-default:"15m"`
+	SigningKey string        `yaml:"signing_key" env:"ATTACHMENTS_SIGNING_KEY"`
+	S3         `yaml:"s3"`
+}
+
+type S3 struct {
+	Endpoint  string `yaml:"endpoint"`
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	AccessKey string `yaml:"access_key" env:"S3_ACCESS_KEY"`
+	SecretKey string `yaml:"secret_key" env:"S3_SECRET_KEY"`
+	UseSSL    bool   `yaml:"use_ssl" env-default:"true"`
+}
+
+// Trash keeps deleted tasks for RetentionDays, 0 keeps them until the trash is emptied.
+// The trash is purged on the TrashPurge schedule.
+type Trash struct {
+	RetentionDays int `yaml:"retention_days" env-default:"30"`
+}
+
+// Stream picks the broker waking up the task streams: memory for a single instance,
+// postgres (LISTEN/NOTIFY) for several instances sharing the database.
+type Stream struct {
+	Broker    string        `yaml:"broker" env-default:"memory"`
+	Heartbeat time.Duration `yaml:"heartbeat" env-default:"25s"`
+}
+
+// Webhooks retries a failed delivery after Backoff, doubling the delay up to MaxBackoff.
+// A delivery failing MaxAttempts times is dead.
+type Webhooks struct {
+	MaxAttempts     int           `yaml:"max_attempts" env-default:"8"`
+	Backoff         time.Duration `yaml:"backoff" env-default:"30s"`
+	MaxBackoff      time.Duration `yaml:"max_backoff" env-default:"6h"`
+	DeliveryTimeout time.Duration `yaml:"delivery_timeout" env-default:"10s"`
+	PollInterval    time.Duration `yaml:"poll_interval" env-default:"5s"`
+}
+
+// Outbox relays domain events to the sinks: bus (consumers in the process), webhooks
+// and stdout (newline delimited JSON for local testing).
+type Outbox struct {
+	Sinks         []string      `yaml:"sinks" env-default:"bus,webhooks"`
+	RelayInterval time.Duration `yaml:"relay_interval" env-default:"1s"`
+	RelayBatch    int           `yaml:"relay_batch" env-default:"100"`
+}
+
+// Jobs runs Workers background jobs at once, a job running longer than JobTimeout is cancelled.
+// A failed job is retried after JobBackoff, doubling the delay up to JobMaxBackoff.
+type Jobs struct {
+	Workers         int           `yaml:"workers" env-default:"4"`
+	JobPollInterval time.Duration `yaml:"poll_interval" env-default:"1s"`
+	JobTimeout      time.Duration `yaml:"timeout" env-default:"5m"`
+	JobBackoff      time.Duration `yaml:"backoff" env-default:"10s"`
+	JobMaxBackoff   time.Duration `yaml:"max_backoff" env-default:"1h"`
+}
+
+// Scheduler queues the maintenance jobs on cron schedules, an empty schedule disables the job.
+// RetentionPrune deletes the outbox events, webhook deliveries and jobs processed more than Keep ago.
+type Scheduler struct {
+	TokensCleanup  string        `yaml:"tokens_cleanup" env-default:"@hourly"`
+	TrashPurge     string        `yaml:"trash_purge" env-default:"0 3 * * *"`
+	TodoReminders  string        `yaml:"todo_reminders" env-default:"*/5 * * * *"`
+	RetentionPrune string        `yaml:"retention_prune" env-default:"30 3 * * *"`
+	Keep           time.Duration `yaml:"keep" env-default:"720h"`
+}
+
+// Notifications emails through SMTP, with no SMTPHost the emails are only logged.
+// Owners of the tasks due within RemindBefore are reminded of them.
+type Notifications struct {
+	SMTPHost     string        `yaml:"smtp_host"`
+	SMTPPort     int           `yaml:"smtp_port" env-default:"587"`
+	SMTPUser     string        `yaml:"smtp_user" env:"SMTP_USER"`
+	SMTPPassword string        `yaml:"smtp_password" env:"SMTP_PASSWORD"`
+	From         string        `yaml:"from" env-default:"sAPI <noreply@easydev.club>"`
+	RemindBefore time.Duration `yaml:"remind_before" env-default:"1h"`
+}
+
+// Tracing exports the spans: otlp to the collector at Endpoint (OTEL_EXPORTER_OTLP_ENDPOINT if empty),
+// stdout for local use or none. SampleRatio of the traces started here are sampled.
+type Tracing struct {
+	Exporter    string  `yaml:"exporter" env-default:"none"`
+	Endpoint    string  `yaml:"endpoint"`
+	Insecure    bool    `yaml:"insecure"`
+	SampleRatio float64 `yaml:"sample_ratio" env-default:"1"`
 }
 
 func MustLoad() *Config {
@@ -36,5 +141,10 @@ func MustLoad() *Config {
 		log.Fatalf("config file not found: %s", configPath)
 	}
 
+	// Download links have to verify after a restart and on every instance, so the key can not be made up.
+	if cfg.Env != "local" && cfg.Attachments.SigningKey == "" {
+		log.Fatal("attachments signing key is not set, set ATTACHMENTS_SIGNING_KEY")
+	}
+
 	return &cfg
 }
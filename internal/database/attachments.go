@@ -0,0 +1,153 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+)
+
+const attachmentFields = `id, todo_id, owner_id, filename, content_type, size, created, blob_key`
+
+// CreateAttachment stores the metadata of an uploaded blob. It fails with -2 when the owner
+// would exceed quota bytes of attachments in total.
+func (s *Storage) CreateAttachment(ctx context.Context, a t.Attachment, quota int64) (code int64, err error) {
+	const op = "database.postgres.CreateAttachment"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	defer tx.Rollback()
+
+	// Concurrent uploads of one owner are serialized, so together they can not exceed the quota.
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('attachments'), $1)`, a.OwnerID); err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	used, err := attachmentUsage(ctx, tx, a.OwnerID)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+	if used+a.Size > quota {
+		return -2, fmt.Errorf("%s: quota exceeded", op)
+	}
+
+	var id int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO public.attachments (todo_id, owner_id, filename, content_type, size, blob_key)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, a.TodoID, a.OwnerID, a.Filename, a.ContentType, a.Size, a.BlobKey).Scan(&id)
+	if err != nil {
+		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23503" {
+			return 0, fmt.Errorf("%s: no task with id: %v", op, a.TodoID)
+		}
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return id, nil
+}
+
+func (s *Storage) DeleteAttachment(ctx context.Context, id int) (code int64, err error) {
+	const op = "database.postgres.DeleteAttachment"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM public.attachments WHERE id = $1`, id)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if n == 0 {
+		return n, fmt.Errorf("%s: no attachment with id: %v", op, id)
+	}
+
+	return n, nil
+}
+
+func (s *Storage) GetAttachment(ctx context.Context, id int) (attachment t.Attachment, err error) {
+	const op = "database.postgres.GetAttachment"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	var a t.Attachment
+	err = s.db.QueryRowContext(ctx, `SELECT `+attachmentFields+` FROM public.attachments WHERE id = $1`, id).
+		Scan(&a.ID, &a.TodoID, &a.OwnerID, &a.Filename, &a.ContentType, &a.Size, &a.Created, &a.BlobKey)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return t.Attachment{}, fmt.Errorf("%s: no such attachment", op)
+		}
+		return t.Attachment{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return a, nil
+}
+
+func (s *Storage) Attachments(ctx context.Context, todoID int) (attachments []t.Attachment, err error) {
+	const op = "database.postgres.Attachments"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+attachmentFields+` FROM public.attachments
+		WHERE todo_id = $1
+		ORDER BY id ASC
+	`, todoID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	var result []t.Attachment
+	for rows.Next() {
+		var a t.Attachment
+		if err := rows.Scan(&a.ID, &a.TodoID, &a.OwnerID, &a.Filename, &a.ContentType, &a.Size, &a.Created, &a.BlobKey); err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+
+		result = append(result, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return result, nil
+}
+
+// AttachmentUsage returns the total size in bytes of the attachments uploaded by the owner.
+func (s *Storage) AttachmentUsage(ctx context.Context, ownerID int) (code int64, err error) {
+	const op = "database.postgres.AttachmentUsage"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	used, err := attachmentUsage(ctx, s.db, ownerID)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return used, nil
+}
+
+func attachmentUsage(ctx context.Context, q querier, ownerID int) (int64, error) {
+	var used int64
+	err := q.QueryRowContext(ctx, `SELECT COALESCE(SUM(size), 0) FROM public.attachments WHERE owner_id = $1`, ownerID).Scan(&used)
+
+	return used, err
+}
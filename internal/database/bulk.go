@@ -0,0 +1,243 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/lib/pq"
+	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+)
+
+// Bulk applies one action to many tasks in a single transaction. A task that can not take the action
+// is reported in its result with the code the single operation would have returned and does not stop
+// the others. Only an internal error rolls the whole request back. Completing tasks is retried while
+// it unblocks other selected tasks, so a chain of dependencies can be completed at once.
+func (s *Storage) Bulk(ctx context.Context, b t.BulkRequest, actor int) (resp t.BulkResponse, code int64, err error) {
+	const op = "database.postgres.Bulk"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return resp, -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	defer tx.Rollback()
+
+	// A missing list would abort the transaction in the middle of the moves.
+	if b.Action == "move" && b.ListID != nil {
+		var role sql.NullInt64
+		if err := tx.QueryRowContext(ctx, `SELECT public.list_role($1, $2)`, *b.ListID, actor).Scan(&role); err != nil {
+			return resp, -1, fmt.Errorf("%s: %v", op, err)
+		}
+		if !role.Valid || role.Int64 == t.NoAccess {
+			return resp, 0, fmt.Errorf("%s: no such list", op)
+		}
+		if role.Int64 < t.EditAccess {
+			return resp, -2, fmt.Errorf("%s: list %v is read only", op, *b.ListID)
+		}
+	}
+
+	ids, denied, missing, err := bulkTargets(ctx, tx, b, actor)
+	if err != nil {
+		return resp, -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	apply := func(id int) (int64, error) {
+		switch b.Action {
+		case "complete", "uncomplete":
+			done := b.Action == "complete"
+			return updateTodo(ctx, tx, id, t.TodoRequest{IsDone: &done}, 0, actor)
+		case "delete":
+			return deleteTodo(ctx, tx, id, actor)
+		case "move":
+			return moveTodo(ctx, tx, id, t.MoveRequest{ListID: b.ListID}, actor)
+		case "tag":
+			return tagTodo(ctx, tx, id, b.Tags, actor)
+		default:
+			return -1, fmt.Errorf("unknown action: %v", b.Action)
+		}
+	}
+
+	results := make(map[int]t.BulkResult, len(ids))
+	for pending := ids; len(pending) > 0; {
+		var blocked []int
+		progress := false
+
+		for _, id := range pending {
+			n, err := apply(id)
+			if n == -1 {
+				return resp, -1, fmt.Errorf("%s: %v", op, err)
+			}
+			// Like the tasks the actor can only view, a filter skips the tasks the actor can not move to another list.
+			if n == -6 && len(b.IDs) == 0 {
+				continue
+			}
+
+			res := t.BulkResult{ID: id, Code: n}
+			if err != nil {
+				res.Error = err.Error()
+				if n == -2 && b.Action == "complete" {
+					blocked = append(blocked, id)
+				}
+			} else {
+				progress = true
+			}
+			results[id] = res
+		}
+
+		if !progress {
+			break
+		}
+		pending = blocked
+	}
+
+	for _, id := range ids {
+		if res, ok := results[id]; ok {
+			resp.Results = append(resp.Results, res)
+		}
+	}
+	for _, id := range denied {
+		resp.Results = append(resp.Results, t.BulkResult{ID: id, Code: -6, Error: fmt.Sprintf("task %v is read only", id)})
+	}
+	for _, id := range missing {
+		resp.Results = append(resp.Results, t.BulkResult{ID: id, Code: 0, Error: fmt.Sprintf("no task with id: %v", id)})
+	}
+
+	info := t.GetAllQuery{UserID: actor}
+	if b.Where != nil {
+		info.ListID, info.SearchTerm = b.Where.ListID, b.Where.Search
+	}
+	resp.Info, err = todoInfo(ctx, tx, info)
+	if err != nil {
+		return resp, -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return resp, -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	s.published()
+
+	return resp, 1, nil
+}
+
+// bulkTargets returns the IDs of the tasks the bulk request applies to in their list order, the requested IDs
+// of tasks the actor can only view and the requested IDs of tasks that do not exist, are in the trash or are not visible.
+// Tasks matched by a filter the actor can only view are skipped.
+func bulkTargets(ctx context.Context, tx *sql.Tx, b t.BulkRequest, actor int) (ids, denied, missing []int, err error) {
+	var args []any
+	arg := func(val any) string {
+		args = append(args, val)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	query := `SELECT id, public.todo_role(id, ` + arg(actor) + `) FROM public.todos`
+	if len(b.IDs) > 0 {
+		query += ` WHERE deleted_at IS NULL AND id = ANY (` + arg(pq.Array(b.IDs)) + `)`
+	} else {
+		q := t.GetAllQuery{UserID: actor}
+		if b.Where != nil {
+			q.Filter, q.Status, q.ListID, q.SearchTerm = b.Where.Filter, b.Where.Status, b.Where.ListID, b.Where.Search
+		}
+		scope, status := todoFilter(q, arg)
+		query += scope + ` AND ` + status
+	}
+	query += ` ORDER BY COALESCE(list_id, 0), rank, id FOR UPDATE`
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, role int
+		if err := rows.Scan(&id, &role); err != nil {
+			return nil, nil, nil, err
+		}
+
+		switch {
+		case role >= t.EditAccess:
+			ids = append(ids, id)
+		case role == t.ViewAccess && len(b.IDs) > 0:
+			denied = append(denied, id)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	for _, id := range b.IDs {
+		if !slices.Contains(ids, id) && !slices.Contains(denied, id) && !slices.Contains(missing, id) {
+			missing = append(missing, id)
+		}
+	}
+
+	return ids, denied, missing, nil
+}
+
+// tagTodo adds tags to a task within the transaction tx.
+func tagTodo(ctx context.Context, tx *sql.Tx, id int, tags []string, actor int) (int64, error) {
+	before, err := lockTodo(ctx, tx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("no task with id: %v", id)
+		}
+		return -1, err
+	}
+
+	merged := uniqueTags(append(slices.Clone(before.Tags), tags...))
+	if slices.Equal(merged, before.Tags) {
+		return 1, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE public.todos SET tags = $1 WHERE id = $2`, pq.Array(merged), id); err != nil {
+		return -1, err
+	}
+
+	if err := recordEvent(ctx, tx, id, "update", actor, &before); err != nil {
+		return -1, err
+	}
+
+	return 1, nil
+}
+
+// todoInfo counts the tasks in the scope of q, like the counters of OutputAll.
+func todoInfo(ctx context.Context, q querier, filter t.GetAllQuery) (t.TodoInfo, error) {
+	var args []any
+	arg := func(val any) string {
+		args = append(args, val)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	scope, _ := todoFilter(filter, arg)
+
+	var info t.TodoInfo
+	err := q.QueryRowContext(ctx, `
+		SELECT
+			COUNT(*),
+			COUNT(*) FILTER (WHERE is_done),
+			COUNT(*) FILTER (WHERE NOT is_done)
+		FROM public.todos`+scope, args...).
+		Scan(&info.All, &info.Completed, &info.InWork)
+
+	return info, err
+}
+
+// uniqueTags trims the tags and drops empty and repeated ones, keeping their order.
+func uniqueTags(tags []string) []string {
+	result := []string{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !slices.Contains(result, tag) {
+			result = append(result, tag)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,203 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/sabbatD/srest-api/internal/lib/mention"
+	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+	"github.com/sabbatD/srest-api/internal/notify"
+)
+
+const commentFields = `c.id, c.todo_id, c.author_id, COALESCE(u.username, ''), c.body, c.created, c.updated`
+
+func (s *Storage) CreateComment(ctx context.Context, todoID, authorID int, c t.CommentRequest) (code int64, err error) {
+	const op = "database.postgres.CreateComment"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO public.comments (todo_id, author_id, body)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`, todoID, authorID, c.Body).Scan(&id)
+	if err != nil {
+		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23503" {
+			return 0, fmt.Errorf("%s: no task with id: %v", op, todoID)
+		}
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := notifyMentions(ctx, tx, todoID, int(id), authorID, mention.Parse(c.Body)); err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return id, nil
+}
+
+func (s *Storage) UpdateComment(ctx context.Context, id int, c t.CommentRequest) (code int64, err error) {
+	const op = "database.postgres.UpdateComment"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	defer tx.Rollback()
+
+	var todoID, authorID int
+	var old string
+	err = tx.QueryRowContext(ctx, `SELECT todo_id, COALESCE(author_id, 0), body FROM public.comments WHERE id = $1 FOR UPDATE`, id).
+		Scan(&todoID, &authorID, &old)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("%s: no comment with id: %v", op, id)
+		}
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE public.comments SET body = $1, updated = NOW() WHERE id = $2`, c.Body, id); err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	// Only users mentioned by the edit are notified, the others already were.
+	if err := notifyMentions(ctx, tx, todoID, id, authorID, mention.New(old, c.Body)); err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return 1, nil
+}
+
+func (s *Storage) DeleteComment(ctx context.Context, id int) (code int64, err error) {
+	const op = "database.postgres.DeleteComment"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM public.comments WHERE id = $1`, id)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if n == 0 {
+		return n, fmt.Errorf("%s: no comment with id: %v", op, id)
+	}
+
+	return n, nil
+}
+
+func (s *Storage) GetComment(ctx context.Context, id int) (comment t.Comment, err error) {
+	const op = "database.postgres.GetComment"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	var c t.Comment
+	err = s.db.QueryRowContext(ctx, `
+		SELECT `+commentFields+`
+		FROM public.comments c
+			LEFT JOIN public.users u ON u.id = c.author_id
+		WHERE c.id = $1
+	`, id).Scan(&c.ID, &c.TodoID, &c.AuthorID, &c.Author, &c.Body, &c.Created, &c.Updated)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return t.Comment{}, fmt.Errorf("%s: no such comment", op)
+		}
+		return t.Comment{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return c, nil
+}
+
+func (s *Storage) Comments(ctx context.Context, todoID int) (comments []t.Comment, err error) {
+	const op = "database.postgres.Comments"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+commentFields+`
+		FROM public.comments c
+			LEFT JOIN public.users u ON u.id = c.author_id
+		WHERE c.todo_id = $1
+		ORDER BY c.id ASC
+	`, todoID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	var result []t.Comment
+	for rows.Next() {
+		var c t.Comment
+		if err := rows.Scan(&c.ID, &c.TodoID, &c.AuthorID, &c.Author, &c.Body, &c.Created, &c.Updated); err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+
+		result = append(result, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return result, nil
+}
+
+// notifyMentions creates a mention notification for every user with one of the usernames
+// who can see the task, except the comment author.
+func notifyMentions(ctx context.Context, tx *sql.Tx, todoID, commentID, authorID int, usernames []string) error {
+	if len(usernames) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(map[string]int{
+		"todoId":    todoID,
+		"commentId": commentID,
+		"authorId":  authorID,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = notifyUsers(ctx, tx, notify.Mention, `
+		SELECT id AS user_id, $1::jsonb AS payload
+		FROM public.users
+		WHERE lower(username) = ANY ($2) AND id <> $3 AND public.todo_role($4, id) >= $5
+	`, payload, pq.Array(lowered(usernames)), authorID, todoID, t.ViewAccess)
+
+	return err
+}
+
+func lowered(names []string) []string {
+	result := make([]string, len(names))
+	for i, name := range names {
+		result[i] = strings.ToLower(name)
+	}
+	return result
+}
@@ -1,14 +1,49 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
 	"github.com/pressly/goose/v3"
+	"github.com/sabbatD/srest-api/internal/tracing"
+	"go.opentelemetry.io/otel/codes"
 )
 
+// MigrationsDir is where the migrations are, relative to the working directory of the service.
+const MigrationsDir = "./internal/database/migrations"
+
 type Storage struct {
-	db *sql.DB
+	db        *sql.DB
+	publisher Publisher
+	observer  Observer
+}
+
+// Observer is told how long every call of a Storage method took, by the op of the method.
+type Observer func(op string, took time.Duration)
+
+// SetObserver sets the observer of the Storage methods, it is not safe to call once the storage is in use.
+func (s *Storage) SetObserver(o Observer) {
+	s.observer = o
+}
+
+// observe starts timing a call and its span, it returns the context of the span for the queries of the call.
+// The returned function records the error err points to on the span, ends it and reports the call to the observer.
+func (s *Storage) observe(ctx context.Context, op string) (context.Context, func(err *error)) {
+	ctx, span := tracing.Start(ctx, op, tracing.StorageAttrs(op))
+
+	start := time.Now()
+	return ctx, func(err *error) {
+		if err != nil && *err != nil {
+			span.RecordError(*err)
+			span.SetStatus(codes.Error, (*err).Error())
+		}
+		span.End()
+		if s.observer != nil {
+			s.observer(op, time.Since(start))
+		}
+	}
 }
 
 var DB *sql.DB
@@ -26,9 +61,7 @@ func SetupDataBase(dbStr, env string) (*Storage, error) {
 	}
 
 	if env == "local" {
-		migrationsDir := "./internal/database/migrations"
-
-		if err := runMigrations(db, migrationsDir); err != nil {
+		if err := runMigrations(db, MigrationsDir); err != nil {
 			return nil, fmt.Errorf("%s: %v", op, err)
 		}
 	}
@@ -37,6 +70,60 @@ func SetupDataBase(dbStr, env string) (*Storage, error) {
 	return &Storage{db: db}, nil
 }
 
+// Stats returns the stats of the connection pool.
+func (s *Storage) Stats() sql.DBStats {
+	return s.db.Stats()
+}
+
+// Close closes the connection pool, waiting for the queries in flight.
+func (s *Storage) Close() error {
+	return s.db.Close()
+}
+
+// Ping checks that the database is reachable.
+func (s *Storage) Ping(ctx context.Context) (err error) {
+	const op = "database.postgres.Ping"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	return nil
+}
+
+// MigrationVersion returns the version of the newest migration applied to the database.
+func (s *Storage) MigrationVersion(ctx context.Context) (code int64, err error) {
+	const op = "database.postgres.MigrationVersion"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	var version int64
+	err = s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version_id), 0) FROM public.goose_db_version WHERE is_applied`).
+		Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return version, nil
+}
+
+// LatestMigration returns the version of the newest migration in dir.
+func LatestMigration(dir string) (int64, error) {
+	migrations, err := goose.CollectMigrations(dir, 0, goose.MaxVersion)
+	if err != nil {
+		return 0, err
+	}
+
+	last, err := migrations.Last()
+	if err != nil {
+		return 0, err
+	}
+
+	return last.Version, nil
+}
+
 func runMigrations(db *sql.DB, migrationsDir string) error {
 	if err := goose.SetDialect("postgres"); err != nil {
 		return fmt.Errorf("error setting postgres dialect: %v", err)
@@ -0,0 +1,157 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+)
+
+func (s *Storage) AddDependency(ctx context.Context, id, blockerID int) (code int64, err error) {
+	const op = "database.postgres.AddDependency"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	if id == blockerID {
+		return -2, fmt.Errorf("%s: task can not block itself", op)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	defer tx.Rollback()
+
+	// Serialize dependency changes so two concurrent links can not close a cycle together.
+	if _, err := tx.ExecContext(ctx, `LOCK TABLE public.todo_dependencies IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	var n int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM public.todos WHERE id IN ($1, $2) AND deleted_at IS NULL`, id, blockerID).Scan(&n); err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+	if n != 2 {
+		return 0, fmt.Errorf("%s: no task with id: %v or %v", op, id, blockerID)
+	}
+
+	// The new edge id -> blockerID closes a cycle if id is already reachable from blockerID.
+	var cycle bool
+	err = tx.QueryRowContext(ctx, `
+		WITH RECURSIVE chain (todo_id) AS (
+			SELECT blocked_by FROM public.todo_dependencies WHERE todo_id = $1
+			UNION
+			SELECT d.blocked_by FROM public.todo_dependencies d
+				JOIN chain c ON d.todo_id = c.todo_id
+		)
+		SELECT EXISTS (SELECT 1 FROM chain WHERE todo_id = $2)
+	`, blockerID, id).Scan(&cycle)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+	if cycle {
+		return -2, fmt.Errorf("%s: dependency creates a cycle", op)
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO public.todo_dependencies (todo_id, blocked_by)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, id, blockerID)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	n64, err := res.RowsAffected()
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return n64, nil
+}
+
+func (s *Storage) RemoveDependency(ctx context.Context, id, blockerID int) (code int64, err error) {
+	const op = "database.postgres.RemoveDependency"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM public.todo_dependencies WHERE todo_id = $1 AND blocked_by = $2`, id, blockerID)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if n == 0 {
+		return n, fmt.Errorf("%s: no dependency %v -> %v", op, id, blockerID)
+	}
+
+	return n, nil
+}
+
+// Dependencies returns the tasks blocking id that are visible to the user.
+func (s *Storage) Dependencies(ctx context.Context, id int, user int) (todos []t.Todo, err error) {
+	const op = "database.postgres.Dependencies"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+todoFields+` FROM public.todos
+		WHERE id IN (SELECT blocked_by FROM public.todo_dependencies WHERE todo_id = $1)
+			AND deleted_at IS NULL AND public.todo_role(id, $2) > 0
+		ORDER BY id ASC
+	`, id, user)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	return scanTodos(op, rows)
+}
+
+// Ready returns the open tasks visible to the user that have no open blockers.
+func (s *Storage) Ready(ctx context.Context, user int) (todos []t.Todo, err error) {
+	const op = "database.postgres.Ready"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+todoFields+`
+		FROM public.todos td
+		WHERE is_done = false AND deleted_at IS NULL AND public.todo_role(td.id, $1) > 0
+			AND NOT EXISTS (
+				SELECT 1 FROM public.todo_dependencies d
+					JOIN public.todos b ON b.id = d.blocked_by
+				WHERE d.todo_id = td.id AND b.is_done = false AND b.deleted_at IS NULL
+			)
+		ORDER BY list_id ASC NULLS FIRST, rank ASC, id ASC
+	`, user)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	return scanTodos(op, rows)
+}
+
+// hasOpenBlockers reports whether any task blocking id is not done yet. Trashed blockers do not count.
+func hasOpenBlockers(ctx context.Context, q querier, id int) (bool, error) {
+	var blocked bool
+	err := q.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM public.todo_dependencies d
+				JOIN public.todos b ON b.id = d.blocked_by
+			WHERE d.todo_id = $1 AND b.is_done = false AND b.deleted_at IS NULL
+		)
+	`, id).Scan(&blocked)
+
+	return blocked, err
+}
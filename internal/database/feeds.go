@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+)
+
+// SaveFeedToken replaces the calendar feed token of a user, the previous token stops working.
+func (s *Storage) SaveFeedToken(ctx context.Context, id int, hash string) (err error) {
+	const op = "database.postgres.SaveFeedToken"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO public.feed_tokens (user_id, token_hash)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id)
+		DO UPDATE SET token_hash = EXCLUDED.token_hash, created = NOW()
+	`, id, hash)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) RevokeFeedToken(ctx context.Context, id int) (code int64, err error) {
+	const op = "database.postgres.RevokeFeedToken"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM public.feed_tokens WHERE user_id = $1`, id)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if n == 0 {
+		return n, fmt.Errorf("%s: no feed token", op)
+	}
+
+	return n, nil
+}
+
+// FeedUser returns the user a feed token belongs to. Feeds of blocked users do not work.
+func (s *Storage) FeedUser(ctx context.Context, hash string) (user int, err error) {
+	const op = "database.postgres.FeedUser"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	var id int
+	err = s.db.QueryRowContext(ctx, `
+		SELECT f.user_id FROM public.feed_tokens f
+			JOIN public.users u ON u.id = f.user_id
+		WHERE f.token_hash = $1 AND u.is_blocked = false
+	`, hash).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("%s: no such feed", op)
+		}
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return id, nil
+}
+
+// DueTodos returns the tasks with a due date the user owns or that are shared with the user, the earliest first.
+func (s *Storage) DueTodos(ctx context.Context, user int) (todos []t.Todo, err error) {
+	const op = "database.postgres.DueTodos"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+todoFields+` FROM public.todos
+		WHERE due IS NOT NULL AND deleted_at IS NULL
+			AND owner_id IS NOT NULL AND public.todo_role(id, $1) > 0
+		ORDER BY due ASC, id ASC
+	`, user)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	return scanTodos(op, rows)
+}
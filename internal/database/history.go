@@ -0,0 +1,241 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/sabbatD/srest-api/internal/lib/history"
+	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+	"github.com/sabbatD/srest-api/internal/outbox"
+)
+
+func (s *Storage) History(ctx context.Context, todoID int) (events []t.TodoEvent, err error) {
+	const op = "database.postgres.History"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT e.version, e.kind, e.actor_id, COALESCE(u.username, ''), e.changes, e.created
+		FROM public.todo_events e
+			LEFT JOIN public.users u ON u.id = e.actor_id
+		WHERE e.todo_id = $1
+		ORDER BY e.version ASC
+	`, todoID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	var result []t.TodoEvent
+	for rows.Next() {
+		var e t.TodoEvent
+		var changes []byte
+		if err := rows.Scan(&e.Version, &e.Kind, &e.ActorID, &e.Actor, &changes, &e.Created); err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+
+		if err := json.Unmarshal(changes, &e.Changes); err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+
+		result = append(result, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return result, nil
+}
+
+// Revert brings a task back to the state it had after the given version. The revert itself
+// is recorded as a new version, so it can be reverted as well. A task in the trash is restored
+// if it was not trashed at that version.
+func (s *Storage) Revert(ctx context.Context, id, version int, actor int) (code int64, err error) {
+	const op = "database.postgres.Revert"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	defer tx.Rollback()
+
+	var before t.Todo
+	err = tx.QueryRowContext(ctx, `SELECT `+todoFields+` FROM public.todos WHERE id = $1 FOR UPDATE`, id).
+		Scan(todoDest(&before)...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("%s: no task with id: %v", op, id)
+		}
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	var snapshot []byte
+	err = tx.QueryRowContext(ctx, `SELECT snapshot FROM public.todo_events WHERE todo_id = $1 AND version = $2`, id, version).Scan(&snapshot)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return -2, fmt.Errorf("%s: no version %v of task %v", op, version, id)
+		}
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	var target t.Todo
+	if err := json.Unmarshal(snapshot, &target); err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	// Reverting to another list is a move: the list has to be editable and the task has to be the actor's
+	// to hand over. A list deleted since can not take the task back, it stays in its current list.
+	if !sameList(before.ListID, target.ListID) {
+		role := sql.NullInt64{Int64: t.EditAccess, Valid: true}
+		if target.ListID != nil {
+			if err := tx.QueryRowContext(ctx, `SELECT public.list_role($1, $2)`, *target.ListID, actor).Scan(&role); err != nil {
+				return -1, fmt.Errorf("%s: %v", op, err)
+			}
+		}
+
+		if !role.Valid {
+			target.ListID, target.Rank = before.ListID, before.Rank
+		} else {
+			allowed, err := canHandOver(ctx, tx, id, actor, target.ListID)
+			if err != nil {
+				return -1, fmt.Errorf("%s: %v", op, err)
+			}
+			if role.Int64 < t.EditAccess || !allowed {
+				return -6, fmt.Errorf("%s: task %v can not be moved back to its list of version %v", op, id, version)
+			}
+		}
+	}
+
+	// The workflow of the list may have changed since, keep the status valid there.
+	wf, err := listWorkflow(ctx, tx, target.ListID)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+	if terminal, ok := wf.Terminal(target.Status); ok {
+		target.IsDone = terminal
+	} else {
+		target.Status = wf.StatusFor(target.IsDone)
+	}
+
+	if target.IsDone && !before.IsDone {
+		blocked, err := hasOpenBlockers(ctx, tx, id)
+		if err != nil {
+			return -1, fmt.Errorf("%s: %v", op, err)
+		}
+		if blocked {
+			return -3, fmt.Errorf("%s: task %v is blocked by open tasks", op, id)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE public.todos
+		SET title = $1, is_done = $2, status = $3, list_id = $4, rank = $5, due = $6, priority = $7, tags = $8, deleted_at = $9
+		WHERE id = $10
+	`, target.Title, target.IsDone, target.Status, target.ListID, target.Rank, target.Due, target.Priority, pq.Array(uniqueTags(target.Tags)), target.DeletedAt, id)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := recordEvent(ctx, tx, id, "revert", actor, &before); err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	s.published()
+
+	return 1, nil
+}
+
+// recordEvent stores the current state of the task as its next version together with the fields
+// changed since before. A nil before records the creation. Nothing is stored if no field changed.
+// The caller must hold the lock of the task row.
+func recordEvent(ctx context.Context, tx *sql.Tx, id int, kind string, actor int, before *t.Todo) error {
+	var after t.Todo
+	err := tx.QueryRowContext(ctx, `SELECT `+todoFields+` FROM public.todos WHERE id = $1`, id).
+		Scan(todoDest(&after)...)
+	if err != nil {
+		return err
+	}
+
+	changes, err := history.Diff(before, &after)
+	if err != nil {
+		return err
+	}
+	if before != nil && len(changes) == 0 {
+		return nil
+	}
+
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := json.Marshal(after)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO public.todo_events (todo_id, version, kind, actor_id, changes, snapshot)
+		SELECT $1, COALESCE(MAX(version), 0) + 1, $2, NULLIF($3, 0), $4, $5
+		FROM public.todo_events WHERE todo_id = $1
+	`, id, kind, actor, changesJSON, snapshot)
+	if err != nil {
+		return err
+	}
+
+	return emitTodoEvents(ctx, tx, kind, actor, before, &after, changes)
+}
+
+// todoEvents maps the kinds of task events to domain events, a revert is an update like any other.
+var todoEvents = map[string]string{
+	"create":  outbox.TodoCreated,
+	"update":  outbox.TodoUpdated,
+	"revert":  outbox.TodoUpdated,
+	"move":    outbox.TodoMoved,
+	"delete":  outbox.TodoDeleted,
+	"restore": outbox.TodoRestored,
+}
+
+// emitTodoEvents emits the domain events of a recorded task event. Completing or reopening a task
+// is an event of its own on top of the change that did it.
+func emitTodoEvents(ctx context.Context, tx *sql.Tx, kind string, actor int, before, after *t.Todo, changes map[string]history.Change) error {
+	data := struct {
+		Todo    *t.Todo                   `json:"todo"`
+		ActorID *int                      `json:"actorId"`
+		Changes map[string]history.Change `json:"changes"`
+	}{Todo: after, Changes: changes}
+	if actor != 0 {
+		data.ActorID = &actor
+	}
+
+	events := []string{todoEvents[kind]}
+	switch wasDone := before != nil && before.IsDone; {
+	case after.IsDone && !wasDone:
+		events = append(events, outbox.TodoCompleted)
+	case !after.IsDone && wasDone:
+		events = append(events, outbox.TodoReopened)
+	}
+
+	for _, event := range events {
+		if event == "" {
+			continue
+		}
+		if err := emitEvent(ctx, tx, event, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
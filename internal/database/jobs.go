@@ -0,0 +1,236 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sabbatD/srest-api/internal/jobs"
+)
+
+const jobFields = `id, kind, payload, status, attempts, max_attempts, run_at, unique_key, last_error, created, started_at, finished_at`
+
+// EnqueueJob stores a job. It returns 0 if a job with the same unique key is queued or running.
+func (s *Storage) EnqueueJob(ctx context.Context, kind string, payload []byte, opts jobs.Options) (code int64, err error) {
+	const op = "database.postgres.EnqueueJob"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	var runAt *time.Time
+	if !opts.RunAt.IsZero() {
+		runAt = &opts.RunAt
+	}
+
+	var id int64
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO public.jobs (kind, payload, max_attempts, run_at, unique_key)
+		VALUES ($1, $2, $3, COALESCE($4, NOW()), NULLIF($5, ''))
+		ON CONFLICT (unique_key) WHERE status IN ('queued', 'running') DO NOTHING
+		RETURNING id
+	`, kind, payload, opts.MaxAttempts, runAt, opts.UniqueKey).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return id, nil
+}
+
+// ClaimJob takes the oldest due job of the kinds, including running jobs whose lease ran out.
+func (s *Storage) ClaimJob(ctx context.Context, kinds []string, lease time.Duration) (job jobs.Job, ok bool, err error) {
+	const op = "database.postgres.ClaimJob"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	row := s.db.QueryRowContext(ctx, `
+		UPDATE public.jobs
+		SET status = 'running', attempts = attempts + 1, started_at = NOW(),
+			locked_until = NOW() + make_interval(secs => $2)
+		WHERE id = (
+			SELECT id FROM public.jobs
+			WHERE kind = ANY($1) AND (
+				(status = 'queued' AND run_at <= NOW()) OR (status = 'running' AND locked_until < NOW())
+			)
+			ORDER BY run_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+jobFields, pq.Array(kinds), lease.Seconds())
+
+	job, err = scanJob(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return job, false, nil
+		}
+		return job, false, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return job, true, nil
+}
+
+func (s *Storage) CompleteJob(ctx context.Context, id int64) (err error) {
+	const op = "database.postgres.CompleteJob"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE public.jobs SET status = 'succeeded', locked_until = NULL, last_error = '', finished_at = NOW()
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	return nil
+}
+
+// FailJob queues a failed job again at retry, without a retry the job is failed for good.
+func (s *Storage) FailJob(ctx context.Context, id int64, msg string, retry *time.Time) (err error) {
+	const op = "database.postgres.FailJob"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE public.jobs
+		SET status = CASE WHEN $3::TIMESTAMPTZ IS NULL THEN 'failed' ELSE 'queued' END,
+			run_at = COALESCE($3, run_at), locked_until = NULL, last_error = $2,
+			finished_at = CASE WHEN $3::TIMESTAMPTZ IS NULL THEN NOW() END
+		WHERE id = $1
+	`, id, msg, retry)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	return nil
+}
+
+// Jobs returns the jobs of the query, latest first.
+func (s *Storage) Jobs(ctx context.Context, q jobs.Query) (found []jobs.Job, err error) {
+	const op = "database.postgres.Jobs"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+jobFields+` FROM public.jobs
+		WHERE ($1 = '' OR status = $1) AND ($2 = '' OR kind = $2)
+		ORDER BY id DESC
+		LIMIT $3 OFFSET $4
+	`, q.Status, q.Kind, q.Limit, q.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	var result []jobs.Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+
+		result = append(result, job)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return result, nil
+}
+
+func (s *Storage) GetJob(ctx context.Context, id int64) (job jobs.Job, err error) {
+	const op = "database.postgres.GetJob"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	job, err = scanJob(s.db.QueryRowContext(ctx, `SELECT `+jobFields+` FROM public.jobs WHERE id = $1`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return job, fmt.Errorf("%s: no such job", op)
+		}
+		return job, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return job, nil
+}
+
+// RetryJob queues a failed job to run now with a fresh set of attempts. It returns 0 for a missing job,
+// -2 for a job that did not fail and -3 if another job with its unique key is pending.
+func (s *Storage) RetryJob(ctx context.Context, id int64) (code int64, err error) {
+	const op = "database.postgres.RetryJob"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE public.jobs SET status = 'queued', attempts = 0, run_at = NOW(), finished_at = NULL
+		WHERE id = $1 AND status = 'failed'
+	`, id)
+	if err != nil {
+		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" {
+			return -3, fmt.Errorf("%s: job with the same unique key is pending", op)
+		}
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if n == 0 {
+		return s.jobMissing(ctx, op, id)
+	}
+
+	return n, nil
+}
+
+// DeleteJob deletes a job that is not running. It returns 0 for a missing job and -2 for a running one.
+func (s *Storage) DeleteJob(ctx context.Context, id int64) (code int64, err error) {
+	const op = "database.postgres.DeleteJob"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM public.jobs WHERE id = $1 AND status <> 'running'`, id)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if n == 0 {
+		return s.jobMissing(ctx, op, id)
+	}
+
+	return n, nil
+}
+
+// jobMissing tells a missing job from one in the wrong status after a conditional change touched no row.
+func (s *Storage) jobMissing(ctx context.Context, op string, id int64) (int64, error) {
+	var status string
+	err := s.db.QueryRowContext(ctx, `SELECT status FROM public.jobs WHERE id = $1`, id).Scan(&status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("%s: no job with id: %v", op, id)
+		}
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return -2, fmt.Errorf("%s: job %v is %s", op, id, status)
+}
+
+func scanJob(row interface{ Scan(dest ...any) error }) (jobs.Job, error) {
+	var job jobs.Job
+	var payload []byte
+	err := row.Scan(&job.ID, &job.Kind, &payload, &job.Status, &job.Attempts, &job.MaxAttempts, &job.RunAt,
+		&job.UniqueKey, &job.LastError, &job.Created, &job.StartedAt, &job.FinishedAt)
+	job.Payload = payload
+	return job, err
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+)
+
+// CreateList creates a list owned by owner, anonymous lists have no owner.
+func (s *Storage) CreateList(ctx context.Context, l t.ListRequest, owner int) (list t.List, err error) {
+	const op = "database.postgres.CreateList"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO public.lists (title, owner_id)
+		VALUES ($1, NULLIF($2, 0))
+		RETURNING id, title, owner_id, created
+	`, l.Title, owner).Scan(&list.ID, &list.Title, &list.OwnerID, &list.Created)
+	if err != nil {
+		return t.List{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return list, nil
+}
+
+// Lists returns the lists visible to the user.
+func (s *Storage) Lists(ctx context.Context, user int) (lists []t.List, err error) {
+	const op = "database.postgres.Lists"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, title, owner_id, created FROM public.lists
+		WHERE public.list_role(id, $1) > 0
+		ORDER BY id ASC
+	`, user)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	var result []t.List
+	for rows.Next() {
+		var list t.List
+		if err := rows.Scan(&list.ID, &list.Title, &list.OwnerID, &list.Created); err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+
+		result = append(result, list)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return result, nil
+}
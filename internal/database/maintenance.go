@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/sabbatD/srest-api/internal/scheduler"
+)
+
+// advisoryLock is a session advisory lock held by a connection of its own.
+type advisoryLock struct {
+	conn *sql.Conn
+	key  int64
+}
+
+// TryLock takes the session advisory lock key if no other session holds it.
+func (s *Storage) TryLock(ctx context.Context, key int64) (lock scheduler.Lock, ok bool, err error) {
+	const op = "database.postgres.TryLock"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&ok); err != nil {
+		conn.Close()
+		return nil, false, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if !ok {
+		conn.Close()
+		return nil, false, nil
+	}
+
+	return &advisoryLock{conn: conn, key: key}, true, nil
+}
+
+func (l *advisoryLock) Alive(ctx context.Context) error {
+	return l.conn.PingContext(ctx)
+}
+
+// Release unlocks the key and returns the connection to the pool.
+func (l *advisoryLock) Release() error {
+	defer l.conn.Close()
+
+	_, err := l.conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, l.key)
+
+	return err
+}
+
+// DeleteExpiredTokens deletes the expired refresh tokens and returns how many there were.
+func (s *Storage) DeleteExpiredTokens(ctx context.Context) (code int64, err error) {
+	const op = "database.postgres.DeleteExpiredTokens"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM public.tokens WHERE date <= NOW()`)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	n, _ := res.RowsAffected()
+
+	return n, nil
+}
+
+// PruneProcessed deletes the records kept only as a log once they are older than age: published
+// outbox events, delivered webhook deliveries, succeeded jobs and reminders of past due dates. Dead deliveries and failed jobs
+// are kept until an admin replays, retries or deletes them, a delivery replayed is kept while its replays are.
+func (s *Storage) PruneProcessed(ctx context.Context, age time.Duration) (code int64, err error) {
+	const op = "database.postgres.PruneProcessed"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	queries := []string{
+		`DELETE FROM public.outbox
+		WHERE published_at IS NOT NULL AND published_at < NOW() - make_interval(secs => $1)`,
+		`DELETE FROM public.webhook_deliveries d
+		WHERE status = 'delivered' AND delivered_at < NOW() - make_interval(secs => $1)
+		AND NOT EXISTS (SELECT 1 FROM public.webhook_deliveries r WHERE r.replay_of = d.id)`,
+		`DELETE FROM public.jobs
+		WHERE status = 'succeeded' AND finished_at < NOW() - make_interval(secs => $1)`,
+		// Tasks overdue by more than a day are not reminded of, their reminders can go after that.
+		`DELETE FROM public.todo_reminders
+		WHERE due < NOW() - GREATEST(make_interval(secs => $1), INTERVAL '1 day')`,
+	}
+
+	var total int64
+	for _, q := range queries {
+		res, err := s.db.ExecContext(ctx, q, age.Seconds())
+		if err != nil {
+			return total, fmt.Errorf("%s: %v", op, err)
+		}
+
+		n, _ := res.RowsAffected()
+		total += n
+	}
+
+	return total, nil
+}
@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS public.lists (
+    id SERIAL PRIMARY KEY,
+    title TEXT NOT NULL,
+    created TIMESTAMPTZ DEFAULT NOW()
+);
+
+ALTER TABLE public.todos
+    ADD COLUMN IF NOT EXISTS list_id INT REFERENCES public.lists (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS rank TEXT COLLATE "C" NOT NULL DEFAULT '';
+
+-- Existing tasks keep their id order: fixed width hex plus a non-zero tail digit.
+UPDATE public.todos SET rank = lpad(to_hex(id), 8, '0') || 'i' WHERE rank = '';
+
+CREATE INDEX IF NOT EXISTS todos_list_rank_idx ON public.todos (list_id, rank);
+
+-- +goose Down
+DROP INDEX IF EXISTS todos_list_rank_idx;
+
+ALTER TABLE public.todos
+    DROP COLUMN IF EXISTS rank,
+    DROP COLUMN IF EXISTS list_id;
+
+DROP TABLE IF EXISTS public.lists;
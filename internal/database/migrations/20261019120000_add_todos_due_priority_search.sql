@@ -0,0 +1,22 @@
+-- +goose Up
+ALTER TABLE public.todos
+    ADD COLUMN IF NOT EXISTS due TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS priority INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS search TSVECTOR
+        GENERATED ALWAYS AS (to_tsvector('simple', COALESCE(title, ''))) STORED;
+
+CREATE INDEX IF NOT EXISTS todos_search_idx ON public.todos USING GIN (search);
+CREATE INDEX IF NOT EXISTS todos_created_idx ON public.todos (created, id);
+CREATE INDEX IF NOT EXISTS todos_due_idx ON public.todos (due, id);
+CREATE INDEX IF NOT EXISTS todos_priority_idx ON public.todos (priority, id);
+
+-- +goose Down
+DROP INDEX IF EXISTS todos_priority_idx;
+DROP INDEX IF EXISTS todos_due_idx;
+DROP INDEX IF EXISTS todos_created_idx;
+DROP INDEX IF EXISTS todos_search_idx;
+
+ALTER TABLE public.todos
+    DROP COLUMN IF EXISTS search,
+    DROP COLUMN IF EXISTS priority,
+    DROP COLUMN IF EXISTS due;
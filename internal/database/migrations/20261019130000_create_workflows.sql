@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS public.workflows (
+    list_id INT PRIMARY KEY REFERENCES public.lists (id) ON DELETE CASCADE,
+    definition JSONB NOT NULL
+);
+
+ALTER TABLE public.todos ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'todo';
+
+UPDATE public.todos SET status = 'done' WHERE is_done = true;
+
+-- +goose Down
+ALTER TABLE public.todos DROP COLUMN IF EXISTS status;
+
+DROP TABLE IF EXISTS public.workflows;
@@ -0,0 +1,26 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS public.comments (
+    id SERIAL PRIMARY KEY,
+    todo_id INT NOT NULL REFERENCES public.todos (id) ON DELETE CASCADE,
+    author_id INT REFERENCES public.users (id) ON DELETE SET NULL,
+    body TEXT NOT NULL,
+    created TIMESTAMPTZ DEFAULT NOW(),
+    updated TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS comments_todo_idx ON public.comments (todo_id, id);
+
+CREATE TABLE IF NOT EXISTS public.notifications (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES public.users (id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    payload JSONB NOT NULL DEFAULT '{}',
+    created TIMESTAMPTZ DEFAULT NOW(),
+    read_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS notifications_user_idx ON public.notifications (user_id, id);
+
+-- +goose Down
+DROP TABLE IF EXISTS public.notifications;
+DROP TABLE IF EXISTS public.comments;
@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS public.attachments (
+    id SERIAL PRIMARY KEY,
+    todo_id INT NOT NULL REFERENCES public.todos (id) ON DELETE CASCADE,
+    owner_id INT NOT NULL REFERENCES public.users (id) ON DELETE CASCADE,
+    filename TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    blob_key TEXT NOT NULL UNIQUE,
+    created TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS attachments_todo_idx ON public.attachments (todo_id, id);
+CREATE INDEX IF NOT EXISTS attachments_owner_idx ON public.attachments (owner_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS public.attachments;
@@ -0,0 +1,8 @@
+-- +goose Up
+ALTER TABLE public.todos ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS todos_deleted_at_idx ON public.todos (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS public.todos_deleted_at_idx;
+ALTER TABLE public.todos DROP COLUMN IF EXISTS deleted_at;
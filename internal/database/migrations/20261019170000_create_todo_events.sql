@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS public.todo_events (
+    id SERIAL PRIMARY KEY,
+    todo_id INT NOT NULL REFERENCES public.todos (id) ON DELETE CASCADE,
+    version INT NOT NULL,
+    kind TEXT NOT NULL,
+    actor_id INT REFERENCES public.users (id) ON DELETE SET NULL,
+    changes JSONB NOT NULL DEFAULT '{}',
+    snapshot JSONB NOT NULL,
+    created TIMESTAMPTZ DEFAULT NOW(),
+    UNIQUE (todo_id, version)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS public.todo_events;
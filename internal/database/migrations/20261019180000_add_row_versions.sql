@@ -0,0 +1,27 @@
+-- +goose Up
+-- row_version changes with every update of a row and is sent as the ETag header.
+-- users.version is the session version, it only changes on logout.
+ALTER TABLE public.todos ADD COLUMN IF NOT EXISTS row_version INT NOT NULL DEFAULT 1;
+ALTER TABLE public.users ADD COLUMN IF NOT EXISTS row_version INT NOT NULL DEFAULT 1;
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION public.bump_row_version() RETURNS trigger AS $$
+BEGIN
+    NEW.row_version := OLD.row_version + 1;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER todos_row_version BEFORE UPDATE ON public.todos
+    FOR EACH ROW EXECUTE FUNCTION public.bump_row_version();
+
+CREATE TRIGGER users_row_version BEFORE UPDATE ON public.users
+    FOR EACH ROW EXECUTE FUNCTION public.bump_row_version();
+
+-- +goose Down
+DROP TRIGGER IF EXISTS users_row_version ON public.users;
+DROP TRIGGER IF EXISTS todos_row_version ON public.todos;
+DROP FUNCTION IF EXISTS public.bump_row_version();
+ALTER TABLE public.users DROP COLUMN IF EXISTS row_version;
+ALTER TABLE public.todos DROP COLUMN IF EXISTS row_version;
@@ -0,0 +1,8 @@
+-- +goose Up
+ALTER TABLE public.todos ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS todos_tags_idx ON public.todos USING GIN (tags);
+
+-- +goose Down
+DROP INDEX IF EXISTS public.todos_tags_idx;
+ALTER TABLE public.todos DROP COLUMN IF EXISTS tags;
@@ -0,0 +1,9 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS public.feed_tokens (
+    user_id INT PRIMARY KEY REFERENCES public.users (id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    created TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS public.feed_tokens;
@@ -0,0 +1,69 @@
+-- +goose Up
+-- Tasks and lists without an owner were created anonymously, everyone can see and edit them.
+ALTER TABLE public.todos ADD COLUMN IF NOT EXISTS owner_id INT REFERENCES public.users (id) ON DELETE CASCADE;
+ALTER TABLE public.lists ADD COLUMN IF NOT EXISTS owner_id INT REFERENCES public.users (id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS todos_owner_idx ON public.todos (owner_id);
+
+CREATE TABLE IF NOT EXISTS public.shares (
+    id SERIAL PRIMARY KEY,
+    todo_id INT REFERENCES public.todos (id) ON DELETE CASCADE,
+    list_id INT REFERENCES public.lists (id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES public.users (id) ON DELETE CASCADE,
+    role TEXT NOT NULL CHECK (role IN ('viewer', 'editor')),
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'declined')),
+    shared_by INT REFERENCES public.users (id) ON DELETE SET NULL,
+    created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK ((todo_id IS NULL) <> (list_id IS NULL)),
+    UNIQUE (todo_id, user_id),
+    UNIQUE (list_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS shares_user_idx ON public.shares (user_id, status);
+
+-- Access levels: 0 none, 1 viewer, 2 editor, 3 owner. Owning a list gives full access to its tasks,
+-- a share of a list gives its role on every task of the list. NULL means there is no such row.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION public.list_role(list INT, member INT) RETURNS INT AS $$
+    SELECT GREATEST(
+        CASE
+            WHEN l.owner_id = member THEN 3
+            WHEN l.owner_id IS NULL THEN 2
+            ELSE 0
+        END,
+        COALESCE((
+            SELECT MAX(CASE s.role WHEN 'editor' THEN 2 ELSE 1 END) FROM public.shares s
+            WHERE s.list_id = l.id AND s.user_id = member AND s.status = 'accepted'
+        ), 0)
+    )
+    FROM public.lists l
+    WHERE l.id = list
+$$ LANGUAGE SQL STABLE;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION public.todo_role(todo INT, member INT) RETURNS INT AS $$
+    SELECT GREATEST(
+        CASE
+            WHEN td.owner_id = member OR l.owner_id = member THEN 3
+            WHEN td.owner_id IS NULL AND l.owner_id IS NULL THEN 2
+            ELSE 0
+        END,
+        COALESCE((
+            SELECT MAX(CASE s.role WHEN 'editor' THEN 2 ELSE 1 END) FROM public.shares s
+            WHERE (s.todo_id = td.id OR s.list_id = td.list_id) AND s.user_id = member AND s.status = 'accepted'
+        ), 0)
+    )
+    FROM public.todos td
+        LEFT JOIN public.lists l ON l.id = td.list_id
+    WHERE td.id = todo
+$$ LANGUAGE SQL STABLE;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP FUNCTION IF EXISTS public.todo_role(INT, INT);
+DROP FUNCTION IF EXISTS public.list_role(INT, INT);
+DROP TABLE IF EXISTS public.shares;
+DROP INDEX IF EXISTS todos_owner_idx;
+ALTER TABLE public.lists DROP COLUMN IF EXISTS owner_id;
+ALTER TABLE public.todos DROP COLUMN IF EXISTS owner_id;
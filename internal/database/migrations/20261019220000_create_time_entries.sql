@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS public.time_entries (
+    id SERIAL PRIMARY KEY,
+    todo_id INT NOT NULL REFERENCES public.todos (id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES public.users (id) ON DELETE CASCADE,
+    started TIMESTAMPTZ NOT NULL,
+    stopped TIMESTAMPTZ,
+    note TEXT NOT NULL DEFAULT '',
+    created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (stopped IS NULL OR stopped >= started)
+);
+
+-- A running timer has no stop time, a user runs at most one.
+CREATE UNIQUE INDEX IF NOT EXISTS time_entries_running_idx ON public.time_entries (user_id) WHERE stopped IS NULL;
+CREATE INDEX IF NOT EXISTS time_entries_todo_idx ON public.time_entries (todo_id);
+CREATE INDEX IF NOT EXISTS time_entries_user_idx ON public.time_entries (user_id, started);
+
+-- +goose Down
+DROP TABLE IF EXISTS public.time_entries;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION public.notify_todo_event() RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('todo_events', NEW.id::TEXT);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER todo_events_notify AFTER INSERT ON public.todo_events
+    FOR EACH ROW EXECUTE FUNCTION public.notify_todo_event();
+
+-- +goose Down
+DROP TRIGGER IF EXISTS todo_events_notify ON public.todo_events;
+DROP FUNCTION IF EXISTS public.notify_todo_event();
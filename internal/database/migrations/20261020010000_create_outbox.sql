@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS public.outbox (
+    id BIGSERIAL PRIMARY KEY,
+    event_id TEXT NOT NULL UNIQUE,
+    event TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    published_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS outbox_unpublished_idx ON public.outbox (id) WHERE published_at IS NULL;
+
+-- Deliveries are queued from the outbox now, an event published again must not be delivered twice.
+-- Replays share the event ID of the original delivery.
+ALTER TABLE public.webhook_deliveries ADD COLUMN IF NOT EXISTS event_id TEXT NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX IF NOT EXISTS webhook_deliveries_event_idx ON public.webhook_deliveries (webhook_id, event_id)
+    WHERE replay_of IS NULL AND event_id <> '';
+
+-- +goose Down
+DROP INDEX IF EXISTS public.webhook_deliveries_event_idx;
+ALTER TABLE public.webhook_deliveries DROP COLUMN IF EXISTS event_id;
+DROP TABLE IF EXISTS public.outbox;
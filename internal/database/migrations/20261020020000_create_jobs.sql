@@ -0,0 +1,25 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS public.jobs (
+    id BIGSERIAL PRIMARY KEY,
+    kind TEXT NOT NULL,
+    payload JSONB NOT NULL DEFAULT '{}',
+    status TEXT NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'succeeded', 'failed')),
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL DEFAULT 5 CHECK (max_attempts > 0),
+    run_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    locked_until TIMESTAMPTZ,
+    unique_key TEXT,
+    last_error TEXT NOT NULL DEFAULT '',
+    created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ
+);
+
+-- A unique key is taken only while its job is pending.
+CREATE UNIQUE INDEX IF NOT EXISTS jobs_unique_key_idx ON public.jobs (unique_key) WHERE status IN ('queued', 'running');
+CREATE INDEX IF NOT EXISTS jobs_due_idx ON public.jobs (run_at) WHERE status = 'queued';
+CREATE INDEX IF NOT EXISTS jobs_lease_idx ON public.jobs (locked_until) WHERE status = 'running';
+CREATE INDEX IF NOT EXISTS jobs_status_idx ON public.jobs (status, id);
+
+-- +goose Down
+DROP TABLE IF EXISTS public.jobs;
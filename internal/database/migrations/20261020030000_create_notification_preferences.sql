@@ -0,0 +1,26 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS public.notification_preferences (
+    user_id INT NOT NULL REFERENCES public.users (id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    inbox BOOLEAN NOT NULL DEFAULT TRUE,
+    email BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (user_id, kind)
+);
+
+CREATE INDEX IF NOT EXISTS notifications_unread_idx ON public.notifications (user_id, id) WHERE read_at IS NULL;
+
+-- The due dates tasks were reminded of, a new due date is reminded of again. Kept apart from the tasks,
+-- so a reminder does not change their row_version.
+CREATE TABLE IF NOT EXISTS public.todo_reminders (
+    todo_id INT NOT NULL REFERENCES public.todos (id) ON DELETE CASCADE,
+    due TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (todo_id, due)
+);
+
+CREATE INDEX IF NOT EXISTS todos_remind_idx ON public.todos (due) WHERE due IS NOT NULL AND NOT is_done AND deleted_at IS NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS public.todos_remind_idx;
+DROP TABLE IF EXISTS public.todo_reminders;
+DROP INDEX IF EXISTS public.notifications_unread_idx;
+DROP TABLE IF EXISTS public.notification_preferences;
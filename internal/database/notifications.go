@@ -0,0 +1,254 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sabbatD/srest-api/internal/jobs"
+	"github.com/sabbatD/srest-api/internal/notify"
+)
+
+// notifyUsers creates a notification of kind for every row of query, which returns user_id and payload (JSONB)
+// columns, and returns the number of rows. Users who turned the kind off get none, users who asked for emails
+// get one queued as well. query may be a data-modifying statement with RETURNING, its arguments come first.
+func notifyUsers(ctx context.Context, q querier, kind, query string, args ...any) (int64, error) {
+	n := len(args)
+
+	var count int64
+	err := q.QueryRowContext(ctx, fmt.Sprintf(`
+		WITH target AS (%[1]s),
+		created AS (
+			INSERT INTO public.notifications (user_id, kind, payload)
+			SELECT t.user_id, $%[2]d, t.payload FROM target t
+			WHERE NOT EXISTS (
+				SELECT 1 FROM public.notification_preferences p
+				WHERE p.user_id = t.user_id AND p.kind = $%[2]d AND NOT p.inbox
+			)
+		),
+		emailed AS (
+			INSERT INTO public.jobs (kind, payload, max_attempts)
+			SELECT $%[3]d, jsonb_build_object('userId', t.user_id, 'kind', $%[2]d::text, 'payload', t.payload), $%[4]d
+			FROM target t
+				JOIN public.notification_preferences p ON p.user_id = t.user_id AND p.kind = $%[2]d AND p.email
+		)
+		SELECT count(*) FROM target
+	`, query, n+1, n+2, n+3), append(args, kind, notify.EmailJob, jobs.DefaultMaxAttempts)...).Scan(&count)
+
+	return count, err
+}
+
+// RemindDue notifies the owners of the tasks due within before, once for every due date.
+// Done and trashed tasks are skipped, and so are tasks overdue by more than a day. The reminded due dates
+// go to todo_reminders rather than the tasks, a reminder is not a change of the task.
+func (s *Storage) RemindDue(ctx context.Context, before time.Duration) (code int64, err error) {
+	const op = "database.postgres.RemindDue"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	n, err := notifyUsers(ctx, s.db, notify.Reminder, `
+		INSERT INTO public.todo_reminders (todo_id, due)
+		SELECT id, due FROM public.todos
+		WHERE due IS NOT NULL AND NOT is_done AND deleted_at IS NULL AND owner_id IS NOT NULL
+			AND due <= NOW() + make_interval(secs => $1) AND due > NOW() - INTERVAL '1 day'
+		ON CONFLICT DO NOTHING
+		RETURNING
+			(SELECT owner_id FROM public.todos WHERE id = todo_id) AS user_id,
+			(SELECT jsonb_build_object('todoId', id, 'title', COALESCE(title, ''), 'due', due) FROM public.todos WHERE id = todo_id) AS payload
+	`, before.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return n, nil
+}
+
+// Notifications returns the notifications of a user, newest first, and how many of them are unread.
+func (s *Storage) Notifications(ctx context.Context, user int, q notify.Query) (inbox notify.Inbox, err error) {
+	const op = "database.postgres.Notifications"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	inbox = notify.Inbox{Data: []notify.Notification{}}
+
+	err = s.db.QueryRowContext(ctx, `SELECT count(*) FROM public.notifications WHERE user_id = $1 AND read_at IS NULL`, user).
+		Scan(&inbox.Unread)
+	if err != nil {
+		return inbox, fmt.Errorf("%s: %v", op, err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, kind, payload, created, read_at FROM public.notifications
+		WHERE user_id = $1 AND (NOT $2 OR read_at IS NULL)
+		ORDER BY id DESC
+		LIMIT $3 OFFSET $4
+	`, user, q.Unread, q.Limit, q.Offset)
+	if err != nil {
+		return inbox, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var n notify.Notification
+		if err := rows.Scan(&n.ID, &n.Kind, &n.Payload, &n.Created, &n.ReadAt); err != nil {
+			return inbox, fmt.Errorf("%s: %v", op, err)
+		}
+		inbox.Data = append(inbox.Data, n)
+	}
+
+	if err := rows.Err(); err != nil {
+		return inbox, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return inbox, nil
+}
+
+// ReadNotification marks a notification of the user read. It returns 0 for a notification that is not the user's.
+func (s *Storage) ReadNotification(ctx context.Context, id, user int) (code int64, err error) {
+	const op = "database.postgres.ReadNotification"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE public.notifications SET read_at = COALESCE(read_at, NOW()) WHERE id = $1 AND user_id = $2
+	`, id, user)
+
+	return notificationResult(op, res, err)
+}
+
+// ReadAllNotifications marks every unread notification of the user read and returns how many there were.
+func (s *Storage) ReadAllNotifications(ctx context.Context, user int) (code int64, err error) {
+	const op = "database.postgres.ReadAllNotifications"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	res, err := s.db.ExecContext(ctx, `UPDATE public.notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL`, user)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	n, _ := res.RowsAffected()
+
+	return n, nil
+}
+
+// DeleteNotification deletes a notification of the user. It returns 0 for a notification that is not the user's.
+func (s *Storage) DeleteNotification(ctx context.Context, id, user int) (code int64, err error) {
+	const op = "database.postgres.DeleteNotification"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM public.notifications WHERE id = $1 AND user_id = $2`, id, user)
+
+	return notificationResult(op, res, err)
+}
+
+func notificationResult(op string, res sql.Result, err error) (int64, error) {
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if n == 0 {
+		return 0, fmt.Errorf("%s: no such notification", op)
+	}
+
+	return n, nil
+}
+
+// NotificationPreferences returns the preference of the user for every kind, the default one if the user set none.
+func (s *Storage) NotificationPreferences(ctx context.Context, user int) (prefs []notify.Preference, err error) {
+	const op = "database.postgres.NotificationPreferences"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	rows, err := s.db.QueryContext(ctx, `SELECT kind, inbox, email FROM public.notification_preferences WHERE user_id = $1`, user)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	set := make(map[string]notify.Preference)
+	for rows.Next() {
+		var p notify.Preference
+		if err := rows.Scan(&p.Kind, &p.Inbox, &p.Email); err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		set[p.Kind] = p
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	prefs = notify.Defaults()
+	for i, p := range prefs {
+		if saved, ok := set[p.Kind]; ok {
+			prefs[i] = saved
+		}
+	}
+
+	return prefs, nil
+}
+
+// SetNotificationPreferences saves the preferences of the user for the given kinds, the others are left as they are.
+func (s *Storage) SetNotificationPreferences(ctx context.Context, user int, prefs []notify.Preference) (err error) {
+	const op = "database.postgres.SetNotificationPreferences"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	defer tx.Rollback()
+
+	for _, p := range prefs {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO public.notification_preferences (user_id, kind, inbox, email)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (user_id, kind) DO UPDATE SET inbox = EXCLUDED.inbox, email = EXCLUDED.email
+		`, user, p.Kind, p.Inbox, p.Email)
+		if err != nil {
+			return fmt.Errorf("%s: %v", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	return nil
+}
+
+// UserEmail returns the email address of a user, empty for a user that is gone.
+func (s *Storage) UserEmail(ctx context.Context, id int) (address string, err error) {
+	const op = "database.postgres.UserEmail"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	var email sql.NullString
+	err = s.db.QueryRowContext(ctx, `SELECT email FROM public.users WHERE id = $1`, id).Scan(&email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("%s: %v", op, err)
+	}
+
+	return email.String, nil
+}
+
+// accountNotice notifies a user that an admin changed their account.
+func accountNotice(ctx context.Context, q querier, id int, action string, roles []string) error {
+	_, err := notifyUsers(ctx, q, notify.Account, `
+		SELECT $1::int AS user_id, jsonb_build_object('action', $2::text, 'roles', $3::text[]) AS payload
+	`, id, action, pq.Array(roles))
+
+	return err
+}
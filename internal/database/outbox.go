@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/sabbatD/srest-api/internal/outbox"
+)
+
+// emitEvent writes a domain event to the outbox. Inside a transaction the event is published
+// only if the change is committed.
+func emitEvent(ctx context.Context, q querier, event string, data any) error {
+	id, err := outbox.NewID()
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.ExecContext(ctx, `INSERT INTO public.outbox (event_id, event, payload) VALUES ($1, $2, $3)`, id, event, payload)
+
+	return err
+}
+
+// PublishOutbox passes the oldest unpublished events to publish and marks them published if it succeeds.
+// The events stay locked until then, so concurrent relays skip them.
+func (s *Storage) PublishOutbox(ctx context.Context, limit int, publish func([]outbox.Event) error) (n int, err error) {
+	const op = "database.postgres.PublishOutbox"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, event_id, event, created, payload FROM public.outbox
+		WHERE published_at IS NULL
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`, limit)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	var ids []int64
+	var events []outbox.Event
+	for rows.Next() {
+		var id int64
+		var e outbox.Event
+		var payload []byte
+		if err := rows.Scan(&id, &e.ID, &e.Type, &e.Created, &payload); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("%s: %v", op, err)
+		}
+		e.Data = payload
+
+		ids = append(ids, id)
+		events = append(events, e)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	if err := publish(events); err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE public.outbox SET published_at = NOW() WHERE id = ANY($1)`, pq.Array(ids)); err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return len(events), nil
+}
@@ -0,0 +1,259 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+	"github.com/sabbatD/srest-api/internal/notify"
+)
+
+const shareQuery = `
+	SELECT s.id, s.todo_id, s.list_id, COALESCE(td.title, l.title, ''), s.user_id, COALESCE(u.username, ''),
+		s.role, s.status, s.shared_by, s.created
+	FROM public.shares s
+		JOIN public.users u ON u.id = s.user_id
+		LEFT JOIN public.todos td ON td.id = s.todo_id
+		LEFT JOIN public.lists l ON l.id = s.list_id
+`
+
+// TodoRole returns the access level of the user to a task, trashed tasks included.
+// A missing task gives NoAccess, the same as a task the user can not see.
+func (s *Storage) TodoRole(ctx context.Context, id, user int) (level int, err error) {
+	const op = "database.postgres.TodoRole"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	var role sql.NullInt64
+	if err := s.db.QueryRowContext(ctx, `SELECT public.todo_role($1, $2)`, id, user).Scan(&role); err != nil {
+		return t.NoAccess, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return int(role.Int64), nil
+}
+
+// ListRole returns the access level of the user to a list, NoAccess for a missing list.
+func (s *Storage) ListRole(ctx context.Context, id, user int) (level int, err error) {
+	const op = "database.postgres.ListRole"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	var role sql.NullInt64
+	if err := s.db.QueryRowContext(ctx, `SELECT public.list_role($1, $2)`, id, user).Scan(&role); err != nil {
+		return t.NoAccess, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return int(role.Int64), nil
+}
+
+// ShareTodo offers the user of the request a role on a task. Sharing again changes the role,
+// a declined share becomes pending again. It returns 0 for a missing user and -2 for the owner of the task.
+func (s *Storage) ShareTodo(ctx context.Context, id int, req t.ShareRequest, by int) (share t.Share, code int64, err error) {
+	const op = "database.postgres.ShareTodo"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	share, n, err := s.share(ctx, "todos", "todo_id", id, req, by)
+	if err != nil {
+		return share, n, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return share, n, nil
+}
+
+// ShareList is ShareTodo for a list, the role applies to every task of the list.
+func (s *Storage) ShareList(ctx context.Context, id int, req t.ShareRequest, by int) (share t.Share, code int64, err error) {
+	const op = "database.postgres.ShareList"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	share, n, err := s.share(ctx, "lists", "list_id", id, req, by)
+	if err != nil {
+		return share, n, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return share, n, nil
+}
+
+func (s *Storage) share(ctx context.Context, table, column string, id int, req t.ShareRequest, by int) (t.Share, int64, error) {
+	var owner sql.NullInt64
+	err := s.db.QueryRowContext(ctx, `SELECT owner_id FROM public.`+table+` WHERE id = $1`, id).Scan(&owner)
+	if err != nil {
+		return t.Share{}, -1, err
+	}
+	if owner.Valid && int(owner.Int64) == req.UserID {
+		return t.Share{}, -2, errors.New("can not share with the owner")
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return t.Share{}, -1, err
+	}
+
+	defer tx.Rollback()
+
+	var shareID int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO public.shares (`+column+`, user_id, role, shared_by)
+		VALUES ($1, $2, $3, NULLIF($4, 0))
+		ON CONFLICT (`+column+`, user_id)
+		DO UPDATE SET role = EXCLUDED.role, shared_by = EXCLUDED.shared_by,
+			status = CASE WHEN shares.status = 'declined' THEN 'pending' ELSE shares.status END
+		RETURNING id
+	`, id, req.UserID, req.Role, by).Scan(&shareID)
+	if err != nil {
+		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23503" { // Код ошибки 23503 означает нарушение внешнего ключа
+			return t.Share{}, 0, errors.New("no such user")
+		}
+		return t.Share{}, -1, err
+	}
+
+	_, err = notifyUsers(ctx, tx, notify.Share, `
+		SELECT s.user_id, jsonb_build_object('todoId', s.todo_id, 'listId', s.list_id,
+			'title', COALESCE(td.title, l.title, ''), 'role', s.role, 'sharedBy', s.shared_by) AS payload
+		FROM public.shares s
+			LEFT JOIN public.todos td ON td.id = s.todo_id
+			LEFT JOIN public.lists l ON l.id = s.list_id
+		WHERE s.id = $1
+	`, shareID)
+	if err != nil {
+		return t.Share{}, -1, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return t.Share{}, -1, err
+	}
+
+	shares, err := s.shares(ctx, `s.id = $1`, shareID)
+	if err != nil || len(shares) == 0 {
+		return t.Share{}, -1, fmt.Errorf("share %v is gone: %v", shareID, err)
+	}
+
+	return shares[0], 1, nil
+}
+
+func (s *Storage) TodoShares(ctx context.Context, id int) (shares []t.Share, err error) {
+	const op = "database.postgres.TodoShares"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	shares, err = s.shares(ctx, `s.todo_id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return shares, nil
+}
+
+func (s *Storage) ListShares(ctx context.Context, id int) (shares []t.Share, err error) {
+	const op = "database.postgres.ListShares"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	shares, err = s.shares(ctx, `s.list_id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return shares, nil
+}
+
+// IncomingShares returns the shares offered to the user, with an empty status in every status.
+func (s *Storage) IncomingShares(ctx context.Context, user int, status string) (shares []t.Share, err error) {
+	const op = "database.postgres.IncomingShares"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	shares, err = s.shares(ctx, `s.user_id = $1 AND ($2 = '' OR s.status = $2)`, user, status)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return shares, nil
+}
+
+func (s *Storage) shares(ctx context.Context, cond string, args ...any) ([]t.Share, error) {
+	rows, err := s.db.QueryContext(ctx, shareQuery+` WHERE `+cond+` ORDER BY s.id DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []t.Share
+	for rows.Next() {
+		var sh t.Share
+		err := rows.Scan(&sh.ID, &sh.TodoID, &sh.ListID, &sh.Title, &sh.UserID, &sh.User, &sh.Role, &sh.Status, &sh.SharedBy, &sh.Created)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, sh)
+	}
+
+	return result, rows.Err()
+}
+
+func (s *Storage) UnshareTodo(ctx context.Context, id, user int) (code int64, err error) {
+	const op = "database.postgres.UnshareTodo"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	return s.unshare(ctx, op, `todo_id`, id, user)
+}
+
+func (s *Storage) UnshareList(ctx context.Context, id, user int) (code int64, err error) {
+	const op = "database.postgres.UnshareList"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	return s.unshare(ctx, op, `list_id`, id, user)
+}
+
+func (s *Storage) unshare(ctx context.Context, op, column string, id, user int) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM public.shares WHERE `+column+` = $1 AND user_id = $2`, id, user)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if n == 0 {
+		return n, fmt.Errorf("%s: no share for user %v", op, user)
+	}
+
+	return n, nil
+}
+
+// RespondShare accepts or declines a share offered to the user. A declined share can still be accepted later.
+func (s *Storage) RespondShare(ctx context.Context, id, user int, accept bool) (code int64, err error) {
+	const op = "database.postgres.RespondShare"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	status := "declined"
+	if accept {
+		status = "accepted"
+	}
+
+	res, err := s.db.ExecContext(ctx, `UPDATE public.shares SET status = $1 WHERE id = $2 AND user_id = $3`, status, id, user)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if n == 0 {
+		return n, fmt.Errorf("%s: no such share", op)
+	}
+
+	return n, nil
+}
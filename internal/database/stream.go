@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+)
+
+// Publisher is told when changes of tasks are committed, see stream.Broker.
+type Publisher interface {
+	Publish()
+}
+
+func (s *Storage) SetPublisher(p Publisher) {
+	s.publisher = p
+}
+
+// published tells the publisher about committed task events.
+func (s *Storage) published() {
+	if s.publisher != nil {
+		s.publisher.Publish()
+	}
+}
+
+// StreamEvents scans up to limit events after the event ID after and returns the ones of the tasks the user can see,
+// oldest first, with the ID of the last event scanned to continue after. The events the user can not see are scanned
+// only once that way, next equals after once there are no more events.
+func (s *Storage) StreamEvents(ctx context.Context, user int, after int64, limit int) (events []t.StreamEvent, next int64, err error) {
+	const op = "database.postgres.StreamEvents"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT e.id, public.todo_role(e.todo_id, $1) > 0, e.kind, e.todo_id, e.version, e.actor_id, e.snapshot, e.created
+		FROM public.todo_events e
+		WHERE e.id > $2
+		ORDER BY e.id
+		LIMIT $3
+	`, user, after, limit)
+	if err != nil {
+		return nil, after, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	next = after
+	for rows.Next() {
+		var e t.StreamEvent
+		var visible sql.NullBool
+		if err := rows.Scan(&e.ID, &visible, &e.Type, &e.TodoID, &e.Version, &e.ActorID, &e.Todo, &e.Created); err != nil {
+			return nil, after, fmt.Errorf("%s: %v", op, err)
+		}
+
+		next = e.ID
+		if visible.Bool {
+			events = append(events, e)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, after, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return events, next, nil
+}
+
+// LastEventID returns the ID of the latest task event, a new stream starts after it.
+func (s *Storage) LastEventID(ctx context.Context) (code int64, err error) {
+	const op = "database.postgres.LastEventID"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	var id int64
+	if err := s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(id), 0) FROM public.todo_events`).Scan(&id); err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,274 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sabbatD/srest-api/internal/lib/timetrack"
+	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+)
+
+const timeEntryQuery = `
+	SELECT e.id, e.todo_id, e.user_id, COALESCE(u.username, ''), e.started, e.stopped,
+		EXTRACT(EPOCH FROM COALESCE(e.stopped, NOW()) - e.started)::BIGINT, e.note
+	FROM public.time_entries e
+		JOIN public.users u ON u.id = e.user_id
+`
+
+// StartTimer starts a timer of the user on a task and stops the timer the user had running on another task.
+// It returns 0 for a missing or trashed task and -2 when the timer of the task is running already.
+func (s *Storage) StartTimer(ctx context.Context, todoID, user int, note string) (entry t.TimeEntry, code int64, err error) {
+	const op = "database.postgres.StartTimer"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return t.TimeEntry{}, -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	defer tx.Rollback()
+
+	var running int
+	err = tx.QueryRowContext(ctx, `SELECT todo_id FROM public.time_entries WHERE user_id = $1 AND stopped IS NULL FOR UPDATE`, user).Scan(&running)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return t.TimeEntry{}, -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if running == todoID {
+		return t.TimeEntry{}, -2, fmt.Errorf("%s: timer of task %v is running already", op, todoID)
+	}
+
+	if running != 0 {
+		if _, err := tx.ExecContext(ctx, `UPDATE public.time_entries SET stopped = GREATEST(NOW(), started) WHERE user_id = $1 AND stopped IS NULL`, user); err != nil {
+			return t.TimeEntry{}, -1, fmt.Errorf("%s: %v", op, err)
+		}
+	}
+
+	var id int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO public.time_entries (todo_id, user_id, started, note)
+		SELECT id, $2, NOW(), $3 FROM public.todos WHERE id = $1 AND deleted_at IS NULL
+		RETURNING id
+	`, todoID, user, note).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return t.TimeEntry{}, 0, fmt.Errorf("%s: no such task", op)
+		}
+		// A concurrent start of the same user took the running slot first.
+		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" {
+			return t.TimeEntry{}, -2, fmt.Errorf("%s: timer is running already", op)
+		}
+		return t.TimeEntry{}, -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return t.TimeEntry{}, -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	e, err := s.GetTimeEntry(ctx, id)
+	if err != nil {
+		return e, -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return e, 1, nil
+}
+
+// StopTimer stops the timer the user has running on a task, 0 means there is none.
+func (s *Storage) StopTimer(ctx context.Context, todoID, user int) (entry t.TimeEntry, code int64, err error) {
+	const op = "database.postgres.StopTimer"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	var id int
+	err = s.db.QueryRowContext(ctx, `
+		UPDATE public.time_entries SET stopped = GREATEST(NOW(), started)
+		WHERE user_id = $1 AND todo_id = $2 AND stopped IS NULL
+		RETURNING id
+	`, user, todoID).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return t.TimeEntry{}, 0, fmt.Errorf("%s: no running timer", op)
+		}
+		return t.TimeEntry{}, -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	e, err := s.GetTimeEntry(ctx, id)
+	if err != nil {
+		return e, -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return e, 1, nil
+}
+
+func (s *Storage) ActiveTimer(ctx context.Context, user int) (entry t.TimeEntry, err error) {
+	const op = "database.postgres.ActiveTimer"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	entries, err := s.timeEntries(ctx, `e.user_id = $1 AND e.stopped IS NULL`, user)
+	if err != nil {
+		return t.TimeEntry{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if len(entries) == 0 {
+		return t.TimeEntry{}, fmt.Errorf("%s: no running timer", op)
+	}
+
+	return entries[0], nil
+}
+
+// AddTimeEntry records time tracked without a timer, 0 means the task is missing or trashed.
+func (s *Storage) AddTimeEntry(ctx context.Context, todoID, user int, started, stopped time.Time, note string) (entry t.TimeEntry, code int64, err error) {
+	const op = "database.postgres.AddTimeEntry"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	var id int
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO public.time_entries (todo_id, user_id, started, stopped, note)
+		SELECT id, $2, $3, $4, $5 FROM public.todos WHERE id = $1 AND deleted_at IS NULL
+		RETURNING id
+	`, todoID, user, started, stopped, note).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return t.TimeEntry{}, 0, fmt.Errorf("%s: no such task", op)
+		}
+		return t.TimeEntry{}, -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	e, err := s.GetTimeEntry(ctx, id)
+	if err != nil {
+		return e, -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return e, 1, nil
+}
+
+func (s *Storage) GetTimeEntry(ctx context.Context, id int) (entry t.TimeEntry, err error) {
+	const op = "database.postgres.GetTimeEntry"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	entries, err := s.timeEntries(ctx, `e.id = $1`, id)
+	if err != nil {
+		return t.TimeEntry{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if len(entries) == 0 {
+		return t.TimeEntry{}, fmt.Errorf("%s: no such entry", op)
+	}
+
+	return entries[0], nil
+}
+
+func (s *Storage) DeleteTimeEntry(ctx context.Context, id int) (code int64, err error) {
+	const op = "database.postgres.DeleteTimeEntry"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM public.time_entries WHERE id = $1`, id)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if n == 0 {
+		return n, fmt.Errorf("%s: no time entry with id: %v", op, id)
+	}
+
+	return n, nil
+}
+
+// TimeEntries returns the time tracked on a task by every user, latest first.
+func (s *Storage) TimeEntries(ctx context.Context, todoID int) (entries []t.TimeEntry, err error) {
+	const op = "database.postgres.TimeEntries"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	entries, err = s.timeEntries(ctx, `e.todo_id = $1`, todoID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return entries, nil
+}
+
+func (s *Storage) timeEntries(ctx context.Context, cond string, args ...any) ([]t.TimeEntry, error) {
+	rows, err := s.db.QueryContext(ctx, timeEntryQuery+` WHERE `+cond+` ORDER BY e.started DESC, e.id DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []t.TimeEntry
+	for rows.Next() {
+		var e t.TimeEntry
+		if err := rows.Scan(&e.ID, &e.TodoID, &e.UserID, &e.User, &e.Started, &e.Stopped, &e.Seconds, &e.Note); err != nil {
+			return nil, err
+		}
+
+		result = append(result, e)
+	}
+
+	return result, rows.Err()
+}
+
+// TrackedTime returns the entries of the query overlapping its range together with their tasks for a report.
+func (s *Storage) TrackedTime(ctx context.Context, q t.TimeQuery) (entries []timetrack.Entry, err error) {
+	const op = "database.postgres.TrackedTime"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	var from, to *time.Time
+	if !q.From.IsZero() {
+		from = &q.From
+	}
+	if !q.To.IsZero() {
+		to = &q.To
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT e.todo_id, COALESCE(td.title, ''), td.list_id, COALESCE(l.title, ''), td.tags, e.started, e.stopped
+		FROM public.time_entries e
+			JOIN public.todos td ON td.id = e.todo_id
+			LEFT JOIN public.lists l ON l.id = td.list_id
+		WHERE ($1 = 0 OR e.user_id = $1)
+			AND ($2::INT IS NULL OR e.todo_id = $2)
+			AND ($3::INT IS NULL OR td.list_id = $3)
+			AND ($4 = '' OR $4 = ANY(td.tags))
+			AND ($5::TIMESTAMPTZ IS NULL OR COALESCE(e.stopped, NOW()) > $5)
+			AND ($6::TIMESTAMPTZ IS NULL OR e.started < $6)
+		ORDER BY e.started
+	`, q.UserID, q.TodoID, q.ListID, q.Tag, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	var result []timetrack.Entry
+	for rows.Next() {
+		var e timetrack.Entry
+		var stopped sql.NullTime
+		if err := rows.Scan(&e.TodoID, &e.Title, &e.ListID, &e.List, pq.Array(&e.Tags), &e.Start, &stopped); err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+		e.End = stopped.Time
+
+		result = append(result, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return result, nil
+}
@@ -1,202 +1,694 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/lib/pq"
+	"github.com/sabbatD/srest-api/internal/lib/rank"
 	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
 )
 
-func (s *Storage) Create(t t.TodoRequest) (int64, error) {
+const todoFields = `id, title, created, is_done, status, list_id, rank, due, priority, tags, owner_id, deleted_at, row_version`
+
+func (s *Storage) Create(ctx context.Context, t t.TodoRequest, actor int) (code int64, err error) {
 	const op = "database.postgres.CreateTodo"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
 
-	query := `
-		INSERT INTO public.todos (title, is_done)
-		VALUES ($1, $2)
-		RETURNING id
-	`
-	stmt, err := s.db.Prepare(query)
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return 0, fmt.Errorf("%s: %v", op, err)
 	}
-	defer stmt.Close()
 
-	var id int64
+	defer tx.Rollback()
+
+	id, err := createTodo(ctx, tx, t, actor)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	s.published()
+
+	return id, nil
+}
+
+// createTodo is Create within the transaction tx. The actor owns the task, anonymous tasks have no owner.
+// It returns 0 for a missing list or status and -1 for other errors.
+func createTodo(ctx context.Context, tx *sql.Tx, t t.TodoRequest, actor int) (int64, error) {
+	// New tasks go to the end of their list.
+	var last string
+	err := tx.QueryRowContext(ctx, `
+		SELECT rank FROM public.todos
+		WHERE list_id IS NOT DISTINCT FROM $1
+		ORDER BY rank DESC LIMIT 1
+	`, t.ListID).Scan(&last)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return -1, err
+	}
+
+	r, err := rank.Between(last, "")
+	if err != nil {
+		return -1, err
+	}
+
+	wf, err := listWorkflow(ctx, tx, t.ListID)
+	if err != nil {
+		return -1, err
+	}
+
+	// An explicit status wins, isDone only picks the first open or terminal status.
+	isDone := false
 	if t.IsDone != nil {
-		err = stmt.QueryRow(t.Title, *t.IsDone).Scan(&id)
-	} else {
-		err = stmt.QueryRow(t.Title, false).Scan(&id)
+		isDone = *t.IsDone
 	}
+
+	status := wf.StatusFor(isDone)
+	if t.Status != nil {
+		terminal, ok := wf.Terminal(*t.Status)
+		if !ok {
+			return 0, errors.New("no such status")
+		}
+		status, isDone = *t.Status, terminal
+	}
+
+	priority := 0
+	if t.Priority != nil {
+		priority = *t.Priority
+	}
+
+	var id int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO public.todos (title, is_done, status, list_id, rank, due, priority, tags, owner_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, 0))
+		RETURNING id
+	`, t.Title, isDone, status, t.ListID, r, t.Due, priority, pq.Array(uniqueTags(t.Tags)), actor).Scan(&id)
 	if err != nil {
-		return 0, fmt.Errorf("%s: %v", op, err)
+		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23503" { // Код ошибки 23503 означает нарушение внешнего ключа
+			return 0, errors.New("no such list")
+		}
+		return -1, err
+	}
+
+	if err := recordEvent(ctx, tx, int(id), "create", actor, nil); err != nil {
+		return -1, err
 	}
 
 	return id, nil
 }
 
-func (s *Storage) Update(id int, t t.TodoRequest) (int64, error) {
+// Update changes the given fields of a task. A non zero version must match the current version of the task.
+func (s *Storage) Update(ctx context.Context, id int, t t.TodoRequest, version int, actor int) (code int64, err error) {
 	const op = "database.postgres.UpdateTodo"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
 
-	var stmt *sql.Stmt
-	var err error
-	var res sql.Result
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
 
-	if t.Title == "" {
-		stmt, err = s.db.Prepare(`UPDATE public.todos SET is_done = $1 WHERE id = $2`)
-		if err != nil {
-			return -1, fmt.Errorf("%s: %v", op, err)
-		}
+	defer tx.Rollback()
 
-		res, err = stmt.Exec(*t.IsDone, id)
-		if err != nil {
-			return -1, fmt.Errorf("%s: %v", op, err)
+	n, err := updateTodo(ctx, tx, id, t, version, actor)
+	if err != nil {
+		return n, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	s.published()
+
+	return 1, nil
+}
+
+// updateTodo is Update within the transaction tx.
+func updateTodo(ctx context.Context, tx *sql.Tx, id int, t t.TodoRequest, version int, actor int) (int64, error) {
+	before, err := lockTodo(ctx, tx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("no task with id: %v", id)
 		}
+		return -1, err
+	}
+	if version != 0 && version != before.Version {
+		return -5, fmt.Errorf("task %v has version %v, not %v", id, before.Version, version)
+	}
+	current, wasDone := before.Status, before.IsDone
 
-		stmt.Close()
+	wf, err := listWorkflow(ctx, tx, before.ListID)
+	if err != nil {
+		return -1, err
 	}
 
-	if t.IsDone == nil {
-		stmt, err = s.db.Prepare(`UPDATE public.todos SET title = $1 WHERE id = $2`)
-		if err != nil {
-			return -1, fmt.Errorf("%s: %v", op, err)
+	var sets []string
+	var args []any
+	set := func(column string, val any) {
+		args = append(args, val)
+		sets = append(sets, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	// isDone is derived from the status: an explicit status wins,
+	// a changed isDone moves the task to the first open or terminal status.
+	var done *bool
+	if t.Status != nil {
+		terminal, ok := wf.Terminal(*t.Status)
+		if !ok {
+			return -3, fmt.Errorf("no such status: %v", *t.Status)
 		}
-		res, err = stmt.Exec(t.Title, id)
-		if err != nil {
-			return -1, fmt.Errorf("%s: %v", op, err)
+		if !wf.CanMove(current, *t.Status) {
+			return -4, fmt.Errorf("transition %v -> %v is not allowed", current, *t.Status)
 		}
-
-		stmt.Close()
+		set("status", *t.Status)
+		done = &terminal
+	} else if t.IsDone != nil {
+		if *t.IsDone != wasDone {
+			status := wf.StatusFor(*t.IsDone)
+			if !wf.CanMove(current, status) {
+				return -4, fmt.Errorf("transition %v -> %v is not allowed", current, status)
+			}
+			set("status", status)
+		}
+		done = t.IsDone
 	}
 
-	if t.Title != "" && t.IsDone != nil {
-		stmt, err = s.db.Prepare(`UPDATE public.todos SET title = $1, is_done = $2 WHERE id = $3`)
-		if err != nil {
-			return -1, fmt.Errorf("%s: %v", op, err)
+	if done != nil {
+		if *done && !wasDone {
+			blocked, err := hasOpenBlockers(ctx, tx, id)
+			if err != nil {
+				return -1, err
+			}
+			if blocked {
+				return -2, fmt.Errorf("task %v is blocked by open tasks", id)
+			}
 		}
-		res, err = stmt.Exec(t.Title, t.IsDone, id)
-		if err != nil {
-			return -1, fmt.Errorf("%s: %v", op, err)
+		set("is_done", *done)
+	}
+
+	if t.Title != "" {
+		set("title", t.Title)
+	}
+	// An empty due clears it, requests are validated before, so only patches can send one.
+	if t.Due != nil {
+		if *t.Due == "" {
+			set("due", nil)
+		} else {
+			set("due", *t.Due)
 		}
-		stmt.Close()
+	}
+	if t.Priority != nil {
+		set("priority", *t.Priority)
+	}
+	if t.Tags != nil {
+		set("tags", pq.Array(uniqueTags(t.Tags)))
 	}
 
-	n, err := res.RowsAffected()
-	if err != nil {
-		return -1, fmt.Errorf("%s: %v", op, err)
+	if len(sets) == 0 {
+		return 1, nil
 	}
 
-	if n == 0 {
-		return n, fmt.Errorf("%s: no task with id: %v", op, id)
+	args = append(args, id)
+	query := fmt.Sprintf(`UPDATE public.todos SET %s WHERE id = $%d`, strings.Join(sets, ", "), len(args))
+
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return -1, err
 	}
 
-	return n, nil
+	if err := recordEvent(ctx, tx, id, "update", actor, &before); err != nil {
+		return -1, err
+	}
+
+	return 1, nil
 }
 
-func (s *Storage) Delete(id int) (int64, error) {
+func (s *Storage) Delete(ctx context.Context, id int, actor int) (code int64, err error) {
 	const op = "database.postgres.DeleteTodo"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
 
-	stmt, err := s.db.Prepare(`
-	DELETE FROM public.todos 
-		WHERE id = $1
-	`)
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return -1, fmt.Errorf("%s: %v", op, err)
 	}
-	defer stmt.Close()
 
-	res, err := stmt.Exec(id)
+	defer tx.Rollback()
+
+	n, err := deleteTodo(ctx, tx, id, actor)
 	if err != nil {
+		return n, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
 		return -1, fmt.Errorf("%s: %v", op, err)
 	}
 
-	n, err := res.RowsAffected()
+	s.published()
+
+	return 1, nil
+}
+
+// deleteTodo is Delete within the transaction tx.
+func deleteTodo(ctx context.Context, tx *sql.Tx, id int, actor int) (int64, error) {
+	before, err := lockTodo(ctx, tx, id)
 	if err != nil {
-		return -1, fmt.Errorf("%s: %v", op, err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("no task with id: %v", id)
+		}
+		return -1, err
 	}
 
-	if n == 0 {
-		return n, fmt.Errorf("%s: no task with id: %v", op, id)
+	// Deleted tasks are moved to the trash, PurgeTrash removes them for good.
+	if _, err := tx.ExecContext(ctx, `UPDATE public.todos SET deleted_at = NOW() WHERE id = $1`, id); err != nil {
+		return -1, err
 	}
 
-	return n, nil
+	if err := recordEvent(ctx, tx, id, "delete", actor, &before); err != nil {
+		return -1, err
+	}
+
+	return 1, nil
 }
 
-func (s *Storage) GetTodo(id int) (t.Todo, error) {
+func (s *Storage) GetTodo(ctx context.Context, id int) (todo t.Todo, err error) {
 	const op = "database.postgres.GetTodo"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
 
-	rows, err := s.db.Query(`SELECT id, title, created, is_done FROM public.todos WHERE id = $1`, id)
+	rows, err := s.db.QueryContext(ctx, `SELECT `+todoFields+` FROM public.todos WHERE id = $1 AND deleted_at IS NULL`, id)
 	if err != nil {
 		return t.Todo{}, fmt.Errorf("%s: %v", op, err)
 	}
 	defer rows.Close()
 
-	var todo t.Todo
+	todos, err := scanTodos(op, rows)
+	if err != nil {
+		return t.Todo{}, err
+	}
 
-	if rows.Next() {
-		if err := rows.Scan(&todo.ID, &todo.Title, &todo.Created, &todo.IsDone); err != nil {
-			return t.Todo{}, fmt.Errorf("%s: %v", op, err)
-		}
-	} else {
+	if len(todos) == 0 {
 		return t.Todo{}, fmt.Errorf("%s: no such task", op)
 	}
 
-	return todo, nil
+	return todos[0], nil
 }
 
-func (s *Storage) OutputAll(filter string) ([]t.Todo, t.TodoInfo, int, error) {
+type sortKey struct {
+	expr string
+	cast string
+}
+
+// todoSorts maps a sortBy value to the keys rows are ordered and paginated by.
+// Every sort ends with id, so the order is total and a cursor points to exactly one row.
+var todoSorts = map[string][]sortKey{
+	"rank":     {{"COALESCE(list_id, 0)", "int"}, {"rank", "text"}, {"id", "int"}},
+	"created":  {{"COALESCE(created, '-infinity')", "timestamptz"}, {"id", "int"}},
+	"title":    {{"COALESCE(title, '')", "text"}, {"id", "int"}},
+	"due":      {{"COALESCE(due, 'infinity')", "timestamptz"}, {"id", "int"}},
+	"priority": {{"priority", "int"}, {"id", "int"}},
+}
+
+func (s *Storage) OutputAll(ctx context.Context, q t.GetAllQuery) (result t.MetaResponse, E error) {
 	const op = "database.postgres.OutputAllTodos"
+	ctx, end := s.observe(ctx, op)
+	defer end(&E)
+
+	keys, ok := todoSorts[q.SortBy]
+	if !ok {
+		q.SortBy, keys = "rank", todoSorts["rank"]
+	}
+
+	var args []any
+	arg := func(val any) string {
+		args = append(args, val)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	scope, status := todoFilter(q, arg)
+
+	err := s.db.QueryRowContext(ctx, `
+		SELECT
+			COUNT(*),
+			COUNT(*) FILTER (WHERE is_done),
+			COUNT(*) FILTER (WHERE NOT is_done),
+			COUNT(*) FILTER (WHERE `+status+`)
+		FROM public.todos`+scope, args...).
+		Scan(&result.Info.All, &result.Info.Completed, &result.Info.InWork, &result.Meta.TotalAmount)
+	if err != nil {
+		return result, fmt.Errorf("%s: meta req %v", op, err)
+	}
+
+	query := `SELECT ` + todoFields + ` FROM public.todos` + scope + ` AND ` + status
+
+	cmp, dir := ">", "ASC"
+	if q.SortOrder == "DESC" {
+		cmp, dir = "<", "DESC"
+	}
+
+	if q.Cursor != "" {
+		vals, err := decodeCursor(q.Cursor, keys)
+		if err != nil {
+			return result, fmt.Errorf("%s: invalid cursor", op)
+		}
+
+		exprs := make([]string, len(keys))
+		params := make([]string, len(keys))
+		for i, k := range keys {
+			exprs[i] = k.expr
+			params[i] = arg(vals[i]) + "::" + k.cast
+		}
 
-	query := ``
-	switch filter {
-	case "all":
-		query = `SELECT id, title, created, is_done FROM public.todos ORDER BY id ASC`
+		query += fmt.Sprintf(` AND (%s) %s (%s)`, strings.Join(exprs, ", "), cmp, strings.Join(params, ", "))
+	}
+
+	order := make([]string, len(keys))
+	for i, k := range keys {
+		order[i] = k.expr + " " + dir
+	}
+	query += ` ORDER BY ` + strings.Join(order, ", ") + ` LIMIT ` + arg(q.Limit+1)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return result, fmt.Errorf("%s: todos req %v", op, err)
+	}
+	defer rows.Close()
+
+	todos, err := scanTodos(op, rows)
+	if err != nil {
+		return result, err
+	}
+
+	// One extra row was requested to know whether there is a next page.
+	if len(todos) > q.Limit {
+		todos = todos[:q.Limit]
+		result.Meta.NextCursor = encodeCursor(cursorValues(q.SortBy, todos[len(todos)-1]))
+	}
+
+	result.Meta.SortBy, result.Meta.SortOrder = q.SortBy, dir
+	result.Data = todos
+
+	return result, nil
+}
+
+// todoFilter returns the conditions of the filters of q. scope is shared by the page and the counters,
+// status only narrows the page.
+func todoFilter(q t.GetAllQuery, arg func(val any) string) (scope, status string) {
+	scope = ` WHERE deleted_at IS NULL`
+	switch user := arg(q.UserID); q.Scope {
+	case "mine":
+		scope += ` AND owner_id = ` + user
+	case "shared":
+		scope += ` AND owner_id <> ` + user + ` AND public.todo_role(id, ` + user + `) > 0`
+	default:
+		scope += ` AND public.todo_role(id, ` + user + `) > 0`
+	}
+	if q.ListID != nil {
+		scope += ` AND list_id = ` + arg(*q.ListID)
+	}
+	if q.SearchTerm != "" {
+		scope += ` AND search @@ websearch_to_tsquery('simple', ` + arg(q.SearchTerm) + `)`
+	}
+
+	status = `true`
+	switch q.Filter {
 	case "completed":
-		query = `SELECT id, title, created, is_done FROM public.todos WHERE is_done = true ORDER BY id ASC`
+		status = `is_done = true`
 	case "inWork":
-		query = `SELECT id, title, created, is_done FROM public.todos WHERE is_done = false ORDER BY id ASC`
+		status = `is_done = false`
+	}
+	if q.Status != "" {
+		status += ` AND status = ` + arg(q.Status)
+	}
+
+	return scope, status
+}
+
+func cursorValues(sortBy string, todo t.Todo) []string {
+	id := strconv.Itoa(int(todo.ID))
+
+	switch sortBy {
+	case "created":
+		return []string{todo.Created, id}
+	case "title":
+		return []string{todo.Title, id}
+	case "due":
+		if todo.Due == nil {
+			return []string{"infinity", id}
+		}
+		return []string{*todo.Due, id}
+	case "priority":
+		return []string{strconv.Itoa(todo.Priority), id}
 	default:
-		query = `SELECT id, title, created, is_done FROM public.todos ORDER BY id ASC`
+		list := 0
+		if todo.ListID != nil {
+			list = *todo.ListID
+		}
+		return []string{strconv.Itoa(list), todo.Rank, id}
 	}
+}
+
+func encodeCursor(vals []string) string {
+	b, _ := json.Marshal(vals)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
 
-	rows, err := s.db.Query(query)
+// decodeCursor returns the values of a cursor of the sort keys. The values are checked against the casts
+// of the keys, so a forged cursor is an invalid cursor rather than a failed query.
+func decodeCursor(cursor string, keys []sortKey) ([]string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
 	if err != nil {
-		return nil, t.TodoInfo{}, 0, fmt.Errorf("%s: %v", op, err)
+		return nil, err
 	}
-	defer rows.Close()
 
-	var result []t.Todo
-	var todo t.Todo
+	var vals []string
+	if err := json.Unmarshal(b, &vals); err != nil {
+		return nil, err
+	}
 
-	for rows.Next() {
-		if err := rows.Scan(&todo.ID, &todo.Title, &todo.Created, &todo.IsDone); err != nil {
-			return nil, t.TodoInfo{}, 0, fmt.Errorf("%s: %v", op, err)
+	if len(vals) != len(keys) {
+		return nil, fmt.Errorf("cursor has %d values, want %d", len(vals), len(keys))
+	}
+
+	for i, k := range keys {
+		if !castable(vals[i], k.cast) {
+			return nil, fmt.Errorf("cursor value %q is not %s", vals[i], k.cast)
 		}
+	}
 
-		result = append(result, todo)
+	return vals, nil
+}
+
+// castable tells whether PostgreSQL accepts val as a value of the type cast.
+func castable(val, cast string) bool {
+	switch cast {
+	case "int":
+		_, err := strconv.ParseInt(val, 10, 32)
+		return err == nil
+	case "timestamptz":
+		if val == "infinity" || val == "-infinity" {
+			return true
+		}
+		_, err := time.Parse(time.RFC3339Nano, val)
+		return err == nil
+	default:
+		return !strings.ContainsRune(val, 0)
 	}
+}
+
+func (s *Storage) Move(ctx context.Context, id int, m t.MoveRequest, actor int) (code int64, err error) {
+	const op = "database.postgres.MoveTodo"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
 
-	var info t.TodoInfo
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
 
-	query = `SELECT is_done FROM public.todos`
+	defer tx.Rollback()
 
-	rows, err = s.db.Query(query)
+	n, err := moveTodo(ctx, tx, id, m, actor)
 	if err != nil {
-		return nil, t.TodoInfo{}, 0, fmt.Errorf("%s: %v", op, err)
+		return n, fmt.Errorf("%s: %v", op, err)
 	}
 
-	var done bool
-	for rows.Next() {
-		if err := rows.Scan(&done); err != nil {
-			return nil, t.TodoInfo{}, 0, fmt.Errorf("%s: %v", op, err)
+	if err := tx.Commit(); err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	s.published()
+
+	return 1, nil
+}
+
+// moveTodo is Move within the transaction tx.
+func moveTodo(ctx context.Context, tx *sql.Tx, id int, m t.MoveRequest, actor int) (int64, error) {
+	before, err := lockTodo(ctx, tx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("no task with id: %v", id)
+		}
+		return -1, err
+	}
+	listID := before.ListID
+
+	anchor := m.Before
+	if anchor == nil {
+		anchor = m.After
+	}
+
+	var lo, hi string
+	if anchor != nil {
+		if *anchor == id {
+			return -2, errors.New("task can not be its own anchor")
 		}
 
-		if done {
-			info.Completed++
+		var anchorRank string
+		if err := tx.QueryRowContext(ctx, `SELECT list_id, rank FROM public.todos WHERE id = $1 AND deleted_at IS NULL`, *anchor).Scan(&listID, &anchorRank); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return 0, fmt.Errorf("no task with id: %v", *anchor)
+			}
+			return -1, err
+		}
+
+		// Only the neighbour on the other side of the anchor is needed to fit the task in.
+		if m.Before != nil {
+			hi = anchorRank
+			err = tx.QueryRowContext(ctx, `
+				SELECT rank FROM public.todos
+				WHERE list_id IS NOT DISTINCT FROM $1 AND rank < $2 AND id <> $3
+				ORDER BY rank DESC LIMIT 1
+			`, listID, anchorRank, id).Scan(&lo)
 		} else {
-			info.InWork++
+			lo = anchorRank
+			err = tx.QueryRowContext(ctx, `
+				SELECT rank FROM public.todos
+				WHERE list_id IS NOT DISTINCT FROM $1 AND rank > $2 AND id <> $3
+				ORDER BY rank ASC LIMIT 1
+			`, listID, anchorRank, id).Scan(&hi)
+		}
+	} else {
+		listID = m.ListID
+		err = tx.QueryRowContext(ctx, `
+			SELECT rank FROM public.todos
+			WHERE list_id IS NOT DISTINCT FROM $1 AND id <> $2
+			ORDER BY rank DESC LIMIT 1
+		`, listID, id).Scan(&lo)
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return -1, err
+	}
+
+	if !sameList(before.ListID, listID) {
+		allowed, err := canHandOver(ctx, tx, id, actor, listID)
+		if err != nil {
+			return -1, err
+		}
+		if !allowed {
+			return -6, fmt.Errorf("only the owner can move task %v to another list", id)
+		}
+	}
+
+	r, err := rank.Between(lo, hi)
+	if err != nil {
+		return -1, err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE public.todos SET list_id = $1, rank = $2 WHERE id = $3`, listID, r, id)
+	if err != nil {
+		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23503" {
+			return 0, errors.New("no such list")
+		}
+		return -1, err
+	}
+
+	// The target list may have another workflow, keep the status valid there.
+	wf, err := listWorkflow(ctx, tx, listID)
+	if err != nil {
+		return -1, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE public.todos
+		SET status = CASE WHEN is_done THEN $2 ELSE $3 END
+		WHERE id = $1 AND status <> ALL ($4)
+	`, id, wf.StatusFor(true), wf.StatusFor(false), pq.Array(wf.Names(false)))
+	if err != nil {
+		return -1, err
+	}
+
+	if err := recordEvent(ctx, tx, id, "move", actor, &before); err != nil {
+		return -1, err
+	}
+
+	return 1, nil
+}
+
+// canHandOver tells whether the actor can move the task id to the list listID. The owner of a list owns its
+// tasks, so moving a task to another list hands it over. Only the owner of the task can do that, anonymous
+// tasks can still move between anonymous lists.
+func canHandOver(ctx context.Context, q querier, id, actor int, listID *int) (bool, error) {
+	var allowed bool
+	err := q.QueryRowContext(ctx, `
+		SELECT public.todo_role(td.id, $2) = 3 OR (td.owner_id IS NULL AND l.owner_id IS NULL
+			AND NOT EXISTS (SELECT 1 FROM public.lists WHERE id = $3 AND owner_id IS NOT NULL))
+		FROM public.todos td
+			LEFT JOIN public.lists l ON l.id = td.list_id
+		WHERE td.id = $1
+	`, id, actor, listID).Scan(&allowed)
+
+	return allowed, err
+}
+
+// sameList tells whether two list IDs are the same list, nil being no list.
+func sameList(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// lockTodo loads a task that is not in the trash and locks it until the end of the transaction.
+func lockTodo(ctx context.Context, tx *sql.Tx, id int) (t.Todo, error) {
+	var todo t.Todo
+	err := tx.QueryRowContext(ctx, `SELECT `+todoFields+` FROM public.todos WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, id).
+		Scan(todoDest(&todo)...)
+
+	return todo, err
+}
+
+// todoDest returns the scan destinations of todoFields.
+func todoDest(todo *t.Todo) []any {
+	return []any{&todo.ID, &todo.Title, &todo.Created, &todo.IsDone, &todo.Status, &todo.ListID, &todo.Rank, &todo.Due, &todo.Priority, pq.Array(&todo.Tags), &todo.OwnerID, &todo.DeletedAt, &todo.Version}
+}
+
+func scanTodos(op string, rows *sql.Rows) ([]t.Todo, error) {
+	var result []t.Todo
+
+	for rows.Next() {
+		var todo t.Todo
+		if err := rows.Scan(todoDest(&todo)...); err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
 		}
-		info.All++
+
+		result = append(result, todo)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
 	}
 
-	return result, info, info.All, nil
+	return result, nil
 }
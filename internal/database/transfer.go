@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+)
+
+// Export returns the tasks visible to the user of a list, or of all lists without a list ID, in their manual order.
+func (s *Storage) Export(ctx context.Context, listID *int, user int) (todos []t.Todo, err error) {
+	const op = "database.postgres.Export"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+todoFields+` FROM public.todos
+		WHERE deleted_at IS NULL AND ($1::int IS NULL OR list_id = $1) AND public.todo_role(id, $2) > 0
+		ORDER BY list_id ASC NULLS FIRST, rank ASC, id ASC
+	`, listID, user)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	return scanTodos(op, rows)
+}
+
+// Import creates the tasks in one transaction. Every task gets a result, a task that can not be created
+// does not stop the others. A dry run creates the tasks the same way and rolls them back.
+func (s *Storage) Import(ctx context.Context, todos []t.TodoRequest, dryRun bool, actor int) (results []t.ImportResult, err error) {
+	const op = "database.postgres.Import"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	defer tx.Rollback()
+
+	results = make([]t.ImportResult, len(todos))
+	for i, todo := range todos {
+		// A failed insert aborts the transaction, the savepoint keeps the rows before it.
+		if _, err := tx.ExecContext(ctx, `SAVEPOINT import_row`); err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+
+		id, err := createTodo(ctx, tx, todo, actor)
+		if id == -1 {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+
+		if err != nil {
+			results[i].Error = err.Error()
+			if _, err := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT import_row`); err != nil {
+				return nil, fmt.Errorf("%s: %v", op, err)
+			}
+			continue
+		}
+
+		if !dryRun {
+			results[i].ID = id
+		}
+		if _, err := tx.ExecContext(ctx, `RELEASE SAVEPOINT import_row`); err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+	}
+
+	if dryRun {
+		return results, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	s.published()
+
+	return results, nil
+}
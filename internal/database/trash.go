@@ -0,0 +1,163 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+
+	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+)
+
+// Trash returns the trashed tasks visible to the user.
+func (s *Storage) Trash(ctx context.Context, user int) (todos []t.Todo, err error) {
+	const op = "database.postgres.Trash"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+todoFields+` FROM public.todos
+		WHERE deleted_at IS NOT NULL AND public.todo_role(id, $1) > 0
+		ORDER BY deleted_at DESC, id DESC
+	`, user)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	return scanTodos(op, rows)
+}
+
+func (s *Storage) Restore(ctx context.Context, id int, actor int) (code int64, err error) {
+	const op = "database.postgres.Restore"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	defer tx.Rollback()
+
+	var before t.Todo
+	err = tx.QueryRowContext(ctx, `SELECT `+todoFields+` FROM public.todos WHERE id = $1 AND deleted_at IS NOT NULL FOR UPDATE`, id).
+		Scan(todoDest(&before)...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("%s: no task with id %v in trash", op, id)
+		}
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE public.todos SET deleted_at = NULL WHERE id = $1`, id); err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := recordEvent(ctx, tx, id, "restore", actor, &before); err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	s.published()
+
+	return 1, nil
+}
+
+// PurgeTrash permanently deletes the tasks trashed at least age ago, age 0 empties the trash.
+// It returns the number of deleted tasks and the blob keys of their attachments,
+// which the caller has to remove from the blob store.
+func (s *Storage) PurgeTrash(ctx context.Context, age time.Duration) (code int64, keys []string, err error) {
+	const op = "database.postgres.PurgeTrash"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	n, keys, err := s.purgeTrash(ctx, `td.deleted_at <= $1`, time.Now().Add(-age))
+	if err != nil {
+		return n, nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return n, keys, nil
+}
+
+// EmptyTrash permanently deletes the trashed tasks the user can edit, like PurgeTrash does.
+func (s *Storage) EmptyTrash(ctx context.Context, user int) (code int64, keys []string, err error) {
+	const op = "database.postgres.EmptyTrash"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	n, keys, err := s.purgeTrash(ctx, `td.deleted_at IS NOT NULL AND public.todo_role(td.id, $1) >= 2`, user)
+	if err != nil {
+		return n, nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return n, keys, nil
+}
+
+// purgeTrash deletes the tasks aliased td matching cond with the argument arg.
+func (s *Storage) purgeTrash(ctx context.Context, cond string, arg any) (int64, []string, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return -1, nil, err
+	}
+
+	defer tx.Rollback()
+
+	// Locking the tasks keeps a concurrent restore from losing the attachments collected here.
+	rows, err := tx.QueryContext(ctx, `
+		SELECT td.id, COALESCE(a.blob_key, '')
+		FROM public.todos td
+			LEFT JOIN public.attachments a ON a.todo_id = td.id
+		WHERE `+cond+`
+		FOR UPDATE OF td
+	`, arg)
+	if err != nil {
+		return -1, nil, err
+	}
+
+	var ids []int
+	var keys []string
+	for rows.Next() {
+		var id int
+		var key string
+		if err := rows.Scan(&id, &key); err != nil {
+			rows.Close()
+			return -1, nil, err
+		}
+
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return -1, nil, err
+	}
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM public.todos WHERE id = ANY ($1)`, pq.Array(ids))
+	if err != nil {
+		return -1, nil, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return -1, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return -1, nil, err
+	}
+
+	return n, keys, nil
+}
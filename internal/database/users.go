@@ -1,25 +1,35 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 
 	"github.com/lib/pq"
 	u "github.com/sabbatD/srest-api/internal/lib/userConfig"
+	"github.com/sabbatD/srest-api/internal/outbox"
 	"github.com/sabbatD/srest-api/internal/password"
 )
 
-func (s *Storage) Add(u u.User) (int, error) {
+func (s *Storage) Add(ctx context.Context, u u.User) (id int, err error) {
 	const op = "database.postgres.Add"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
 
 	pwd, err := password.HashPassword(u.Password)
 	if err != nil {
 		return 0, fmt.Errorf("%s: %v", op, err)
 	}
 
-	var id int
-	err = s.db.QueryRow(`
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
 		INSERT INTO public.users (login, username, email, password, phone_number)
 		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id
@@ -32,19 +42,29 @@ func (s *Storage) Add(u u.User) (int, error) {
 		return 0, fmt.Errorf("%s: %v", op, err)
 	}
 
-	_, err = s.db.Exec(`insert into public.roles (user_id, role) values ($1, ARRAY['USER'])`, id)
+	_, err = tx.ExecContext(ctx, `insert into public.roles (user_id, role) values ($1, ARRAY['USER'])`, id)
 
 	if err != nil {
 		return 0, fmt.Errorf("%s: INSERT INTO public.roles (user_id, role)\n\tvalues ($1, $2): %v", op, err)
 	}
 
+	if err := userEvent(ctx, tx, outbox.UserCreated, id); err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %v", op, err)
+	}
+
 	return id, nil
 }
 
-func (s *Storage) Auth(u u.AuthData) (user u.TableUser, err error) {
+func (s *Storage) Auth(ctx context.Context, u u.AuthData) (user u.TableUser, err error) {
 	const op = "database.postgres.Auth"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
 
-	stmt, err := s.db.Prepare(`SELECT password FROM public.users WHERE login = $1`)
+	stmt, err := s.db.PrepareContext(ctx, `SELECT password FROM public.users WHERE login = $1`)
 	if err != nil {
 		return user, fmt.Errorf("%s.s.db.Prepare(`SELECT password FROM public.users WHERE login = $1`): %v", op, err)
 	}
@@ -52,7 +72,7 @@ func (s *Storage) Auth(u u.AuthData) (user u.TableUser, err error) {
 
 	var pwd string
 
-	if err = stmt.QueryRow(u.Login).Scan(&pwd); err != nil {
+	if err = stmt.QueryRowContext(ctx, u.Login).Scan(&pwd); err != nil {
 		return user, fmt.Errorf("%s.stmt.QueryRow(u.Login): %v", op, err)
 	}
 
@@ -60,13 +80,13 @@ func (s *Storage) Auth(u u.AuthData) (user u.TableUser, err error) {
 		return user, nil
 	}
 
-	stmt, err = s.db.Prepare(`SELECT id, username, email, date, is_blocked, is_admin FROM public.users WHERE login = $1`)
+	stmt, err = s.db.PrepareContext(ctx, `SELECT id, username, email, date, is_blocked, is_admin FROM public.users WHERE login = $1`)
 	if err != nil {
 		return user, fmt.Errorf("%s.s.db.Prepare(`SELECT id, username, email, date, is_blocked, is_admin FROM public.users WHERE login = $1`): %v", op, err)
 	}
 
 	var isAdmin bool
-	err = stmt.QueryRow(u.Login).Scan(&user.ID, &user.Username, &user.Email, &user.Date, &user.IsBlocked, &isAdmin)
+	err = stmt.QueryRowContext(ctx, u.Login).Scan(&user.ID, &user.Username, &user.Email, &user.Date, &user.IsBlocked, &isAdmin)
 	if err != nil {
 		return user, fmt.Errorf("%s.stmt.QueryRow(u.Login).Scan(user): %v", op, err)
 	}
@@ -74,10 +94,10 @@ func (s *Storage) Auth(u u.AuthData) (user u.TableUser, err error) {
 		user.Roles = append(user.Roles, "USER")
 	}
 
-	err = s.db.QueryRow(`select role from public.roles where user_id = $1`, user.ID).Scan(pq.Array(&user.Roles))
+	err = s.db.QueryRowContext(ctx, `select role from public.roles where user_id = $1`, user.ID).Scan(pq.Array(&user.Roles))
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		if user.ID != 0 {
-			_, err = s.db.Exec(`insert into public.roles (user_id, role) values ($1, ARRAY['USER'])`, user.ID)
+			_, err = s.db.ExecContext(ctx, `insert into public.roles (user_id, role) values ($1, ARRAY['USER'])`, user.ID)
 
 			user.Roles = append(user.Roles, "USER")
 
@@ -93,35 +113,41 @@ func (s *Storage) Auth(u u.AuthData) (user u.TableUser, err error) {
 	return user, nil
 }
 
-func (s *Storage) UpdateRoles(id int, roles []string) (int64, error) {
+func (s *Storage) UpdateRoles(ctx context.Context, id int, roles []string) (code int64, err error) {
 	const op = "database.postgres.UpdateRoles"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
 
 	if id == 1 || id == 2 {
 		return 0, nil
 	}
 
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer tx.Rollback()
+
 	var exists bool
-	err := s.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM public.roles WHERE user_id = $1)`, id).Scan(&exists)
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM public.roles WHERE user_id = $1)`, id).Scan(&exists)
 	if err != nil {
 		return -1, fmt.Errorf("%s: %w while checking existence with user_id: %d", op, err, id)
 	}
 
-	if exists {
-		res, err := s.db.Exec(`UPDATE public.roles SET role = $2 WHERE user_id = $1`, id, pq.Array(roles))
-		if err != nil {
-			return -1, fmt.Errorf("%s: %w while updating roles for user_id: %d", op, err, id)
-		}
+	// Roles are part of the profile, so they change its version as well.
+	if _, err := tx.ExecContext(ctx, `UPDATE public.users SET row_version = row_version + 1 WHERE id = $1`, id); err != nil {
+		return -1, fmt.Errorf("%s: %w while bumping version for user_id: %d", op, err, id)
+	}
 
-		n, err := res.RowsAffected()
-		if err != nil {
-			return -1, fmt.Errorf("%s: %w while fetching rows affected for user_id: %d", op, err, id)
-		}
-		return n, nil
+	query := `INSERT INTO public.roles (user_id, role) VALUES ($1, $2)`
+	if exists {
+		query = `UPDATE public.roles SET role = $2 WHERE user_id = $1`
 	}
 
-	res, err := s.db.Exec(`INSERT INTO public.roles (user_id, role) VALUES ($1, $2)`, id, pq.Array(roles))
+	res, err := tx.ExecContext(ctx, query, id, pq.Array(roles))
 	if err != nil {
-		return -1, fmt.Errorf("%s: %w while inserting roles for user_id: %d", op, err, id)
+		return -1, fmt.Errorf("%s: %w while saving roles for user_id: %d", op, err, id)
 	}
 
 	n, err := res.RowsAffected()
@@ -129,26 +155,41 @@ func (s *Storage) UpdateRoles(id int, roles []string) (int64, error) {
 		return -1, fmt.Errorf("%s: %w while fetching rows affected for user_id: %d", op, err, id)
 	}
 
+	if err := userEvent(ctx, tx, outbox.UserUpdated, id); err != nil {
+		return -1, fmt.Errorf("%s: %w while emitting event for user_id: %d", op, err, id)
+	}
+
+	if err := accountNotice(ctx, tx, id, "roles", roles); err != nil {
+		return -1, fmt.Errorf("%s: %w while notifying user_id: %d", op, err, id)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return -1, fmt.Errorf("%s: %w", op, err)
+	}
+
 	return n, nil
 }
 
-func (s *Storage) Remove(id int) (int64, error) {
+func (s *Storage) Remove(ctx context.Context, id int) (code int64, err error) {
 	const op = "database.postgres.RemoveUser"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
 
 	if id == 1 || id == 2 {
 		return 0, nil
 	}
 
-	stmt, err := s.db.Prepare(`
-	DELETE FROM public.users 
-		WHERE id = $1
-	`)
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return -1, fmt.Errorf("%s: %v", op, err)
 	}
-	defer stmt.Close()
 
-	res, err := stmt.Exec(id)
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+	DELETE FROM public.users 
+		WHERE id = $1
+	`, id)
 	if err != nil {
 		return -1, fmt.Errorf("%s: %v", op, err)
 	}
@@ -162,11 +203,23 @@ func (s *Storage) Remove(id int) (int64, error) {
 		return n, fmt.Errorf("%s: no users with id: %v", op, id)
 	}
 
+	if err := emitEvent(ctx, tx, outbox.UserDeleted, struct {
+		ID int `json:"id"`
+	}{id}); err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
 	return n, nil
 }
 
-func (s *Storage) All(q u.GetAllQuery) (result u.MetaResponse, E error) {
+func (s *Storage) All(ctx context.Context, q u.GetAllQuery) (result u.MetaResponse, E error) {
 	const op = "database.postgres.GetAllUsers"
+	ctx, end := s.observe(ctx, op)
+	defer end(&E)
 
 	qParams := []any{q.SearchTerm, q.Limit, q.Offset}
 	mParams := []any{q.SearchTerm}
@@ -199,12 +252,12 @@ func (s *Storage) All(q u.GetAllQuery) (result u.MetaResponse, E error) {
 
 	query += ` ORDER BY ` + q.SortBy + ` ` + q.SortOrder + ` LIMIT $2 OFFSET $3;`
 
-	rows, err := s.db.Query(query, qParams...)
+	rows, err := s.db.QueryContext(ctx, query, qParams...)
 	if err != nil {
 		return result, fmt.Errorf("%s: users req %v", op, err)
 	}
 
-	err = s.db.QueryRow(metaQuery, mParams...).Scan(&result.Meta.TotalAmount)
+	err = s.db.QueryRowContext(ctx, metaQuery, mParams...).Scan(&result.Meta.TotalAmount)
 	if err != nil {
 		return result, fmt.Errorf("%s: meta req %v", op, err)
 	}
@@ -221,7 +274,7 @@ func (s *Storage) All(q u.GetAllQuery) (result u.MetaResponse, E error) {
 			return result, fmt.Errorf("%s: user scan %v", op, err)
 		}
 
-		if err := s.db.QueryRow(`select role from public.roles where user_id = $1`, user.ID).Scan(pq.Array(&user.Roles)); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		if err := s.db.QueryRowContext(ctx, `select role from public.roles where user_id = $1`, user.ID).Scan(pq.Array(&user.Roles)); err != nil && !errors.Is(err, sql.ErrNoRows) {
 			return result, fmt.Errorf("%s: roles scan %v", op, err)
 		}
 
@@ -234,22 +287,23 @@ func (s *Storage) All(q u.GetAllQuery) (result u.MetaResponse, E error) {
 	return result, nil
 }
 
-func (s *Storage) Get(id int) (u.TableUser, error) {
+func (s *Storage) Get(ctx context.Context, id int) (user u.TableUser, err error) {
 	const op = "database.postgres.GetUser"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
 
-	var user u.TableUser
 	var isAdmin bool
 
-	err := s.db.QueryRow(`SELECT id, username, email, date, is_blocked, is_admin, phone_number FROM public.users WHERE id = $1`, id).
-		Scan(&user.ID, &user.Username, &user.Email, &user.Date, &user.IsBlocked, &isAdmin, &user.PhoneNumber)
+	err = s.db.QueryRowContext(ctx, `SELECT id, username, email, date, is_blocked, is_admin, phone_number, row_version FROM public.users WHERE id = $1`, id).
+		Scan(&user.ID, &user.Username, &user.Email, &user.Date, &user.IsBlocked, &isAdmin, &user.PhoneNumber, &user.Version)
 	if err != nil {
 		return u.TableUser{}, fmt.Errorf("%s: %v", op, err)
 	}
 
-	err = s.db.QueryRow(`select role from public.roles where user_id = $1;`, id).Scan(pq.Array(&user.Roles))
+	err = s.db.QueryRowContext(ctx, `select role from public.roles where user_id = $1;`, id).Scan(pq.Array(&user.Roles))
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		if user.ID != 0 {
-			_, err = s.db.Exec(`insert into public.roles (user_id, role) values ($1, ARRAY['USER'])`, user.ID)
+			_, err = s.db.ExecContext(ctx, `insert into public.roles (user_id, role) values ($1, ARRAY['USER'])`, user.ID)
 
 			user.Roles = append(user.Roles, "USER")
 
@@ -265,8 +319,10 @@ func (s *Storage) Get(id int) (u.TableUser, error) {
 	return user, nil
 }
 
-func (s *Storage) UpdateField(field string, id int, val any) (int64, error) {
+func (s *Storage) UpdateField(ctx context.Context, field string, id int, val any) (code int64, err error) {
 	const op = "database.postgres.UpdateUserField"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
 
 	if id == 1 || id == 2 {
 		return 0, nil
@@ -294,13 +350,14 @@ func (s *Storage) UpdateField(field string, id int, val any) (int64, error) {
 	}
 	query := fmt.Sprintf(`UPDATE public.users SET %s = $1 WHERE id = $2`, field)
 
-	stmt, err := s.db.Prepare(query)
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return -1, fmt.Errorf("%s: %v with parameters:%v, %v, %v", op, err, field, id, val)
+		return -1, fmt.Errorf("%s: %v", op, err)
 	}
-	defer stmt.Close()
 
-	res, err := stmt.Exec(val, id)
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, query, val, id)
 	if err != nil {
 		return -1, fmt.Errorf("%s: %v with parameters:%v, %v, %v", op, err, field, id, val)
 	}
@@ -314,25 +371,59 @@ func (s *Storage) UpdateField(field string, id int, val any) (int64, error) {
 		return n, fmt.Errorf("%s: no users with id: %v", op, id)
 	}
 
+	event, action := outbox.UserUpdated, "admin"
+	if field == "is_blocked" {
+		event, action = outbox.UserUnblocked, "unblocked"
+		if blocked, _ := val.(bool); blocked {
+			event, action = outbox.UserBlocked, "blocked"
+		}
+	}
+
+	if err := userEvent(ctx, tx, event, id); err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := accountNotice(ctx, tx, id, action, nil); err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
 	return n, nil
 }
 
-func (s *Storage) UpdateUser(u u.PutUser, id int) (int64, error) {
+// UpdateUser changes the given fields of a user. A non zero version must match the current version of the user.
+func (s *Storage) UpdateUser(ctx context.Context, u u.PutUser, id int, version int) (code int64, err error) {
 	const op = "database.postgres.UpdateUser"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
 
 	if id == 1 || id == 2 {
 		return 0, nil
 	}
 
-	tx, err := s.db.Begin()
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return -1, fmt.Errorf("%s: %v", op, err)
 	}
 
 	defer tx.Rollback()
 
+	var current int
+	if err := tx.QueryRowContext(ctx, `SELECT row_version FROM public.users WHERE id = $1 FOR UPDATE`, id).Scan(&current); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("%s: no users with id: %v", op, id)
+		}
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+	if version != 0 && version != current {
+		return -3, fmt.Errorf("%s: user %v has version %v, not %v", op, id, current, version)
+	}
+
 	if u.Username != "" {
-		_, err = tx.Exec(`UPDATE public.users SET username = $1 WHERE id = $2`, u.Username, id)
+		_, err = tx.ExecContext(ctx, `UPDATE public.users SET username = $1 WHERE id = $2`, u.Username, id)
 		if err != nil {
 			return -1, fmt.Errorf("%s: %v", op, err)
 		}
@@ -340,32 +431,90 @@ func (s *Storage) UpdateUser(u u.PutUser, id int) (int64, error) {
 
 	if u.Email != "" {
 		var exists bool
-		stmt, err := s.db.Prepare(`SELECT EXISTS (SELECT 1 FROM public.users WHERE email = $1)`)
+		stmt, err := s.db.PrepareContext(ctx, `SELECT EXISTS (SELECT 1 FROM public.users WHERE email = $1)`)
 		if err != nil {
 			return -1, fmt.Errorf("%s: %v", op, err)
 		}
 		defer stmt.Close()
 
-		if err = stmt.QueryRow(u.Email).Scan(&exists); err != nil {
+		if err = stmt.QueryRowContext(ctx, u.Email).Scan(&exists); err != nil {
 			return -1, fmt.Errorf("%s: %v", op, err)
 		}
 		if exists {
 			return -2, fmt.Errorf("%s: email already used", op)
 		}
 
-		_, err = tx.Exec(`UPDATE public.users SET email = $1 WHERE id = $2`, u.Email, id)
+		_, err = tx.ExecContext(ctx, `UPDATE public.users SET email = $1 WHERE id = $2`, u.Email, id)
 		if err != nil {
 			return -1, fmt.Errorf("%s: %v", op, err)
 		}
 	}
 
 	if u.PhoneNumber != "" {
-		_, err = tx.Exec(`UPDATE public.users SET phone_number = $1 WHERE id = $2`, u.PhoneNumber, id)
+		_, err = tx.ExecContext(ctx, `UPDATE public.users SET phone_number = $1 WHERE id = $2`, u.PhoneNumber, id)
 		if err != nil {
 			return -1, fmt.Errorf("%s: %v", op, err)
 		}
 	}
 
+	if err := userEvent(ctx, tx, outbox.UserUpdated, id); err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return 1, nil
+}
+
+// PatchUser replaces the editable fields of a user with the result of a patch, an empty phone number clears it.
+// The version must match the current version of the user.
+func (s *Storage) PatchUser(ctx context.Context, p u.PatchUser, id int, version int) (code int64, err error) {
+	const op = "database.postgres.PatchUser"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	if id == 1 || id == 2 {
+		return 0, nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	defer tx.Rollback()
+
+	var current int
+	if err := tx.QueryRowContext(ctx, `SELECT row_version FROM public.users WHERE id = $1 FOR UPDATE`, id).Scan(&current); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("%s: no users with id: %v", op, id)
+		}
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+	if version != current {
+		return -3, fmt.Errorf("%s: user %v has version %v, not %v", op, id, current, version)
+	}
+
+	var exists bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM public.users WHERE email = $1 AND id <> $2)`, p.Email, id).Scan(&exists)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+	if exists {
+		return -2, fmt.Errorf("%s: email already used", op)
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE public.users SET username = $1, email = $2, phone_number = $3 WHERE id = $4`, p.Username, p.Email, p.PhoneNumber, id)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := userEvent(ctx, tx, outbox.UserUpdated, id); err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
 	if err := tx.Commit(); err != nil {
 		return -1, fmt.Errorf("%s: %v", op, err)
 	}
@@ -373,10 +522,12 @@ func (s *Storage) UpdateUser(u u.PutUser, id int) (int64, error) {
 	return 1, nil
 }
 
-func (s *Storage) SaveRefreshToken(token string, id int) error {
+func (s *Storage) SaveRefreshToken(ctx context.Context, token string, id int) (err error) {
 	const op = "database.postgres.SaveRefreshToken"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
 
-	stmt, err := s.db.Prepare(`
+	stmt, err := s.db.PrepareContext(ctx, `
 		INSERT INTO public.tokens (user_id, token, date) 
 		VALUES ($1, $2, NOW() + INTERVAL '8 minutes') 
 		ON CONFLICT (user_id) 
@@ -387,7 +538,7 @@ func (s *Storage) SaveRefreshToken(token string, id int) error {
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(id, token)
+	_, err = stmt.ExecContext(ctx, id, token)
 	if err != nil {
 		return fmt.Errorf("%s: %v", op, err)
 	}
@@ -395,16 +546,18 @@ func (s *Storage) SaveRefreshToken(token string, id int) error {
 	return nil
 }
 
-func (s *Storage) RefreshToken(token string) (string, int, error) {
+func (s *Storage) RefreshToken(ctx context.Context, token string) (refresh string, user int, err error) {
 	const op = "database.postgres.RefreshToken"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
 
-	stmt, err := s.db.Prepare(`SELECT user_id, token FROM public.tokens WHERE token = $1 and date > NOW()`)
+	stmt, err := s.db.PrepareContext(ctx, `SELECT user_id, token FROM public.tokens WHERE token = $1 and date > NOW()`)
 	if err != nil {
 		return "", 0, fmt.Errorf("%s: %v", op, err)
 	}
 	defer stmt.Close()
 
-	rows, err := stmt.Query(token)
+	rows, err := stmt.QueryContext(ctx, token)
 	if err != nil {
 		return "", 0, fmt.Errorf("%s: %v", op, err)
 	}
@@ -422,28 +575,30 @@ func (s *Storage) RefreshToken(token string) (string, int, error) {
 	return "expired", 0, nil
 }
 
-func (s *Storage) ChangePassword(u u.Pwd, id int) (int64, error) {
+func (s *Storage) ChangePassword(ctx context.Context, u u.Pwd, id int) (code int64, err error) {
 	const op = "database.postgres.ChangePassword"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
 
 	if id == 1 || id == 2 {
 		return 0, nil
 	}
 
 	var exists bool
-	stmt, err := s.db.Prepare(`SELECT EXISTS (SELECT 1 FROM public.users WHERE id = $1)`)
+	stmt, err := s.db.PrepareContext(ctx, `SELECT EXISTS (SELECT 1 FROM public.users WHERE id = $1)`)
 	if err != nil {
 		return -1, fmt.Errorf("%s: %v", op, err)
 	}
 	defer stmt.Close()
 
-	if err = stmt.QueryRow(id).Scan(&exists); err != nil {
+	if err = stmt.QueryRowContext(ctx, id).Scan(&exists); err != nil {
 		return -1, fmt.Errorf("%s: %v", op, err)
 	}
 	if !exists {
 		return -2, fmt.Errorf("%s: no such user", op)
 	}
 
-	tx, err := s.db.Begin()
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return -1, fmt.Errorf("%s: %v", op, err)
 	}
@@ -456,7 +611,7 @@ func (s *Storage) ChangePassword(u u.Pwd, id int) (int64, error) {
 			return 0, fmt.Errorf("%s: %v", op, err)
 		}
 
-		_, err = tx.Exec(`UPDATE public.users SET password = $1 WHERE id = $2`, pwd, id)
+		_, err = tx.ExecContext(ctx, `UPDATE public.users SET password = $1 WHERE id = $2`, pwd, id)
 		if err != nil {
 			return -1, fmt.Errorf("%s: %v", op, err)
 		}
@@ -469,10 +624,12 @@ func (s *Storage) ChangePassword(u u.Pwd, id int) (int64, error) {
 	return 1, nil
 }
 
-func (s *Storage) Logout(id int) error {
+func (s *Storage) Logout(ctx context.Context, id int) (err error) {
 	const op = "database.postgres.Logout"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
 
-	res, err := s.db.Exec(`UPDATE public.users SET version = COALESCE(version, 0) + 1 WHERE id = $1`, id)
+	res, err := s.db.ExecContext(ctx, `UPDATE public.users SET version = COALESCE(version, 0) + 1 WHERE id = $1`, id)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
@@ -483,7 +640,7 @@ func (s *Storage) Logout(id int) error {
 		return fmt.Errorf("%s: %s", op, "no rows affected")
 	}
 
-	_, err = s.db.Exec(`
+	_, err = s.db.ExecContext(ctx, `
 		DELETE FROM public.tokens
 		WHERE user_id = $1`, id)
 	if err != nil {
@@ -493,10 +650,13 @@ func (s *Storage) Logout(id int) error {
 	return nil
 }
 
-func (s *Storage) UserVersion(id int) int {
+func (s *Storage) UserVersion(ctx context.Context, id int) int {
 	const op = "database.postgres.UserVersion"
+	ctx, end := s.observe(ctx, op)
+	var err error
+	defer end(&err)
 
-	stmt, err := s.db.Prepare(`SELECT version FROM public.users WHERE id = $1`)
+	stmt, err := s.db.PrepareContext(ctx, `SELECT version FROM public.users WHERE id = $1`)
 	if err != nil {
 		return 0
 	}
@@ -504,7 +664,7 @@ func (s *Storage) UserVersion(id int) int {
 
 	ver := 0
 
-	if err := stmt.QueryRow(id).Scan(&ver); err != nil {
+	if err = stmt.QueryRowContext(ctx, id).Scan(&ver); err != nil {
 		return 0
 	}
 
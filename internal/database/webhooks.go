@@ -0,0 +1,341 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	u "github.com/sabbatD/srest-api/internal/lib/userConfig"
+	"github.com/sabbatD/srest-api/internal/outbox"
+	"github.com/sabbatD/srest-api/internal/webhook"
+)
+
+const webhookFields = `id, url, events, active, description, created`
+
+const deliveryFields = `id, webhook_id, event_id, event, payload, status, attempts,
+	CASE WHEN status = 'pending' THEN next_attempt END, last_status, last_error, replay_of, created, delivered_at`
+
+// userEvent emits the event of a user with the profile the user has in q.
+func userEvent(ctx context.Context, q querier, event string, id int) error {
+	var user u.TableUser
+	err := q.QueryRowContext(ctx, `
+		SELECT id, username, email, date, is_blocked, phone_number,
+			COALESCE((SELECT role FROM public.roles WHERE user_id = $1), '{}')
+		FROM public.users WHERE id = $1
+	`, id).Scan(&user.ID, &user.Username, &user.Email, &user.Date, &user.IsBlocked, &user.PhoneNumber, pq.Array(&user.Roles))
+	if err != nil {
+		return err
+	}
+
+	return emitEvent(ctx, q, event, user)
+}
+
+// EnqueueWebhooks queues a delivery of every event to the active webhooks subscribed to it,
+// an event relayed again is not queued twice.
+func (s *Storage) EnqueueWebhooks(ctx context.Context, events []outbox.Event) (err error) {
+	const op = "database.postgres.EnqueueWebhooks"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	defer tx.Rollback()
+
+	for _, e := range events {
+		payload, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("%s: %v", op, err)
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO public.webhook_deliveries (webhook_id, event_id, event, payload)
+			SELECT id, $1, $2, $3 FROM public.webhooks
+			WHERE active AND ($2 = ANY(events) OR '*' = ANY(events))
+			ON CONFLICT (webhook_id, event_id) WHERE replay_of IS NULL AND event_id <> '' DO NOTHING
+		`, e.ID, e.Type, payload)
+		if err != nil {
+			return fmt.Errorf("%s: %v", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Webhooks(ctx context.Context) (hooks []webhook.Webhook, err error) {
+	const op = "database.postgres.Webhooks"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	rows, err := s.db.QueryContext(ctx, `SELECT `+webhookFields+` FROM public.webhooks ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	var result []webhook.Webhook
+	for rows.Next() {
+		var h webhook.Webhook
+		if err := rows.Scan(&h.ID, &h.URL, pq.Array(&h.Events), &h.Active, &h.Description, &h.Created); err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+
+		result = append(result, h)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return result, nil
+}
+
+func (s *Storage) GetWebhook(ctx context.Context, id int) (hook webhook.Webhook, err error) {
+	const op = "database.postgres.GetWebhook"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	var h webhook.Webhook
+	err = s.db.QueryRowContext(ctx, `SELECT `+webhookFields+` FROM public.webhooks WHERE id = $1`, id).
+		Scan(&h.ID, &h.URL, pq.Array(&h.Events), &h.Active, &h.Description, &h.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return h, fmt.Errorf("%s: no such webhook", op)
+		}
+		return h, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return h, nil
+}
+
+// CreateWebhook stores a webhook, the returned webhook shows its secret.
+func (s *Storage) CreateWebhook(ctx context.Context, req webhook.Request, secret string) (hook webhook.Webhook, err error) {
+	const op = "database.postgres.CreateWebhook"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	active := req.Active == nil || *req.Active
+
+	var id int
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO public.webhooks (url, secret, events, active, description)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, req.URL, secret, pq.Array(req.Events), active, req.Description).Scan(&id)
+	if err != nil {
+		return webhook.Webhook{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	h, err := s.GetWebhook(ctx, id)
+	if err != nil {
+		return h, fmt.Errorf("%s: %v", op, err)
+	}
+	h.Secret = secret
+
+	return h, nil
+}
+
+// UpdateWebhook replaces a webhook. An empty secret keeps the current one, a missing active flag keeps the state.
+func (s *Storage) UpdateWebhook(ctx context.Context, id int, req webhook.Request) (code int64, err error) {
+	const op = "database.postgres.UpdateWebhook"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE public.webhooks
+		SET url = $2, events = $3, active = COALESCE($4, active), description = $5, secret = COALESCE(NULLIF($6, ''), secret)
+		WHERE id = $1
+	`, id, req.URL, pq.Array(req.Events), req.Active, req.Description, req.Secret)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if n == 0 {
+		return n, fmt.Errorf("%s: no webhook with id: %v", op, id)
+	}
+
+	return n, nil
+}
+
+// DeleteWebhook deletes a webhook together with its delivery log.
+func (s *Storage) DeleteWebhook(ctx context.Context, id int) (code int64, err error) {
+	const op = "database.postgres.DeleteWebhook"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM public.webhooks WHERE id = $1`, id)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if n == 0 {
+		return n, fmt.Errorf("%s: no webhook with id: %v", op, id)
+	}
+
+	return n, nil
+}
+
+// Deliveries returns the delivery log, latest first.
+func (s *Storage) Deliveries(ctx context.Context, q webhook.DeliveryQuery) (deliveries []webhook.Delivery, err error) {
+	const op = "database.postgres.Deliveries"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+deliveryFields+` FROM public.webhook_deliveries
+		WHERE ($1 = 0 OR webhook_id = $1) AND ($2 = '' OR status = $2) AND ($3 = '' OR event = $3)
+		ORDER BY id DESC
+		LIMIT $4 OFFSET $5
+	`, q.WebhookID, q.Status, q.Event, q.Limit, q.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	var result []webhook.Delivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+
+		result = append(result, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return result, nil
+}
+
+// ReplayDelivery queues the payload of a logged delivery again as a new delivery, whatever the state of the original.
+// It returns 0 for a missing delivery.
+func (s *Storage) ReplayDelivery(ctx context.Context, id int64) (delivery webhook.Delivery, code int64, err error) {
+	const op = "database.postgres.ReplayDelivery"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	row := s.db.QueryRowContext(ctx, `
+		INSERT INTO public.webhook_deliveries (webhook_id, event_id, event, payload, replay_of)
+		SELECT webhook_id, event_id, event, payload, id FROM public.webhook_deliveries WHERE id = $1
+		RETURNING `+deliveryFields, id)
+
+	d, err := scanDelivery(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return d, 0, fmt.Errorf("%s: no such delivery", op)
+		}
+		return d, -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return d, 1, nil
+}
+
+func scanDelivery(row interface{ Scan(dest ...any) error }) (webhook.Delivery, error) {
+	var d webhook.Delivery
+	var payload []byte
+	err := row.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.Event, &payload, &d.Status, &d.Attempts,
+		&d.NextAttempt, &d.LastStatus, &d.LastError, &d.ReplayOf, &d.Created, &d.DeliveredAt)
+	d.Payload = payload
+	return d, err
+}
+
+// ClaimDeliveries takes the due deliveries of active webhooks for an attempt. The next attempt is moved
+// past the lease, so a dispatcher dying in the middle of a delivery only delays it.
+func (s *Storage) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) (attempts []webhook.Attempt, err error) {
+	const op = "database.postgres.ClaimDeliveries"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE public.webhook_deliveries d
+		SET attempts = d.attempts + 1, next_attempt = NOW() + make_interval(secs => $2)
+		FROM public.webhooks w
+		WHERE w.id = d.webhook_id AND d.id IN (
+			SELECT dd.id FROM public.webhook_deliveries dd
+				JOIN public.webhooks ww ON ww.id = dd.webhook_id
+			WHERE dd.status = 'pending' AND dd.next_attempt <= NOW() AND ww.active
+			ORDER BY dd.next_attempt
+			LIMIT $1
+			FOR UPDATE OF dd SKIP LOCKED
+		)
+		RETURNING d.id, d.event, w.url, w.secret, d.payload, d.attempts
+	`, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	var result []webhook.Attempt
+	for rows.Next() {
+		var a webhook.Attempt
+		if err := rows.Scan(&a.ID, &a.Event, &a.URL, &a.Secret, &a.Payload, &a.Attempt); err != nil {
+			return nil, fmt.Errorf("%s: %v", op, err)
+		}
+
+		result = append(result, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return result, nil
+}
+
+func (s *Storage) DeliverySucceeded(ctx context.Context, id int64, code int) (err error) {
+	const op = "database.postgres.DeliverySucceeded"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE public.webhook_deliveries
+		SET status = 'delivered', last_status = $2, last_error = '', delivered_at = NOW()
+		WHERE id = $1
+	`, id, code)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	return nil
+}
+
+// DeliveryFailed records a failed attempt. Without a retry the delivery goes to the dead letters.
+func (s *Storage) DeliveryFailed(ctx context.Context, id int64, code int, msg string, retry *time.Time) (err error) {
+	const op = "database.postgres.DeliveryFailed"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE public.webhook_deliveries
+		SET status = CASE WHEN $4::TIMESTAMPTZ IS NULL THEN 'dead' ELSE 'pending' END,
+			next_attempt = COALESCE($4, next_attempt), last_status = NULLIF($2, 0), last_error = $3
+		WHERE id = $1
+	`, id, code, msg, retry)
+	if err != nil {
+		return fmt.Errorf("%s: %v", op, err)
+	}
+
+	return nil
+}
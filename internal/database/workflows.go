@@ -0,0 +1,177 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+	"github.com/sabbatD/srest-api/internal/lib/workflow"
+)
+
+// querier is satisfied by both *sql.DB and *sql.Tx.
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func (s *Storage) Workflow(ctx context.Context, listID int) (wf workflow.Workflow, err error) {
+	const op = "database.postgres.Workflow"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM public.lists WHERE id = $1)`, listID).Scan(&exists); err != nil {
+		return workflow.Workflow{}, fmt.Errorf("%s: %v", op, err)
+	}
+	if !exists {
+		return workflow.Workflow{}, fmt.Errorf("%s: no such list", op)
+	}
+
+	w, err := listWorkflow(ctx, s.db, &listID)
+	if err != nil {
+		return workflow.Workflow{}, fmt.Errorf("%s: %v", op, err)
+	}
+
+	return w, nil
+}
+
+func (s *Storage) SetWorkflow(ctx context.Context, listID int, w workflow.Workflow, actor int) (code int64, err error) {
+	const op = "database.postgres.SetWorkflow"
+	ctx, end := s.observe(ctx, op)
+	defer end(&err)
+
+	definition, err := json.Marshal(w)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO public.workflows (list_id, definition)
+		VALUES ($1, $2)
+		ON CONFLICT (list_id)
+		DO UPDATE SET definition = EXCLUDED.definition
+	`, listID, definition)
+	if err != nil {
+		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23503" {
+			return 0, fmt.Errorf("%s: no such list", op)
+		}
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT `+todoFields+` FROM public.todos WHERE list_id = $1 ORDER BY rank FOR UPDATE`, listID)
+	if err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+	defer rows.Close()
+
+	todos, err := scanTodos(op, rows)
+	if err != nil {
+		return -1, err
+	}
+
+	if err := applyWorkflow(ctx, tx, w, todos, actor); err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return -1, fmt.Errorf("%s: %v", op, err)
+	}
+
+	s.published()
+
+	return 1, nil
+}
+
+// applyWorkflow keeps the tasks of a list valid in its new workflow within the transaction tx. Tasks in a status
+// the workflow does not have fall back to its first open or terminal status, the others keep theirs and
+// follow whether it is terminal. A task the change would complete while it is blocked by open tasks is
+// completed after its blockers or, if they stay open, falls back to the first open status.
+func applyWorkflow(ctx context.Context, tx *sql.Tx, w workflow.Workflow, todos []t.Todo, actor int) error {
+	apply := func(before t.Todo, status string, done bool) error {
+		if status == before.Status && done == before.IsDone {
+			return nil
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE public.todos SET status = $2, is_done = $3 WHERE id = $1`, before.ID, status, done); err != nil {
+			return err
+		}
+
+		return recordEvent(ctx, tx, int(before.ID), "update", actor, &before)
+	}
+
+	for pending := todos; len(pending) > 0; {
+		var blocked []t.Todo
+		progress := false
+
+		for _, before := range pending {
+			status := before.Status
+			done, ok := w.Terminal(status)
+			if !ok {
+				status, done = w.StatusFor(before.IsDone), before.IsDone
+			}
+
+			if done && !before.IsDone {
+				open, err := hasOpenBlockers(ctx, tx, int(before.ID))
+				if err != nil {
+					return err
+				}
+				if open {
+					blocked = append(blocked, before)
+					continue
+				}
+			}
+
+			if err := apply(before, status, done); err != nil {
+				return err
+			}
+			progress = true
+		}
+
+		if !progress {
+			for _, before := range blocked {
+				if err := apply(before, w.StatusFor(false), false); err != nil {
+					return err
+				}
+			}
+			break
+		}
+		pending = blocked
+	}
+
+	return nil
+}
+
+// listWorkflow returns the workflow of a list, or the default one for tasks without a list
+// and for lists that never got their own workflow.
+func listWorkflow(ctx context.Context, q querier, listID *int) (workflow.Workflow, error) {
+	if listID == nil {
+		return workflow.Default, nil
+	}
+
+	var definition []byte
+	err := q.QueryRowContext(ctx, `SELECT definition FROM public.workflows WHERE list_id = $1`, *listID).Scan(&definition)
+	if errors.Is(err, sql.ErrNoRows) {
+		return workflow.Default, nil
+	}
+	if err != nil {
+		return workflow.Workflow{}, err
+	}
+
+	var w workflow.Workflow
+	if err := json.Unmarshal(definition, &w); err != nil {
+		return workflow.Workflow{}, err
+	}
+
+	return w, nil
+}
@@ -0,0 +1,52 @@
+package health
+
+import (
+	"runtime/debug"
+	"sync"
+)
+
+// Version follows the @version of the API annotations in cmd/sapi. Commit and BuildTime are set at build time
+// with -ldflags "-X github.com/sabbatD/srest-api/internal/health.Commit=...", without them the commit and
+// its time stamped by the go command are reported.
+var (
+	Version   = "v0.3.2"
+	Commit    = ""
+	BuildTime = ""
+)
+
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"buildTime"`
+	GoVersion string `json:"goVersion"`
+}
+
+var buildInfo = sync.OnceValue(func() BuildInfo {
+	info := BuildInfo{Version: Version, Commit: Commit, BuildTime: BuildTime}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		info.GoVersion = bi.GoVersion
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = s.Value
+			case s.Key == "vcs.time" && info.BuildTime == "":
+				info.BuildTime = s.Value
+			}
+		}
+	}
+
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildTime == "" {
+		info.BuildTime = "unknown"
+	}
+
+	return info
+})
+
+// Build returns the version of the build.
+func Build() BuildInfo {
+	return buildInfo()
+}
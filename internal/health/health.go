@@ -0,0 +1,101 @@
+// Package health tells whether the service is ready to serve requests and which build it is.
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK       = "ok"
+	StatusFailing  = "failing"
+	StatusReady    = "ready"
+	StatusNotReady = "not ready"
+)
+
+// ErrDraining fails the readiness once the shutdown begins.
+var ErrDraining = errors.New("shutting down")
+
+// Check returns details worth showing, if any, and an error if the service can not serve because of it.
+type Check func(ctx context.Context) (any, error)
+
+type Result struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Detail any    `json:"detail,omitempty"`
+}
+
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Ready tells whether every check passed.
+func (r Report) Ready() bool {
+	return r.Status == StatusReady
+}
+
+// Checker runs the readiness checks.
+type Checker struct {
+	timeout  time.Duration
+	names    []string
+	checks   []Check
+	draining atomic.Bool
+}
+
+// NewChecker returns a checker giving the checks timeout to complete.
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Add adds a named check, it is not safe to call once the checker is in use.
+func (c *Checker) Add(name string, check Check) {
+	c.names = append(c.names, name)
+	c.checks = append(c.checks, check)
+}
+
+// Drain makes the service not ready from now on.
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Check runs the checks at once.
+func (c *Checker) Check(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	results := make([]Result, len(c.checks))
+
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+
+			detail, err := check(ctx)
+			results[i] = Result{Status: StatusOK, Detail: detail}
+			if err != nil {
+				results[i].Status, results[i].Error = StatusFailing, err.Error()
+			}
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusReady, Checks: make(map[string]Result, len(results)+1)}
+	for i, r := range results {
+		report.Checks[c.names[i]] = r
+		if r.Status != StatusOK {
+			report.Status = StatusNotReady
+		}
+	}
+
+	if c.draining.Load() {
+		report.Status = StatusNotReady
+		report.Checks["shutdown"] = Result{Status: StatusFailing, Error: ErrDraining.Error()}
+	}
+
+	return report
+}
@@ -0,0 +1,55 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestChecker(t *testing.T) {
+	c := NewChecker(time.Second)
+	c.Add("database", func(ctx context.Context) (any, error) { return nil, nil })
+	c.Add("workers", func(ctx context.Context) (any, error) { return map[string]int{"running": 4}, nil })
+
+	report := c.Check(context.Background())
+	if !report.Ready() || len(report.Checks) != 2 || report.Checks["workers"].Detail == nil {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	c.Add("migrations", func(ctx context.Context) (any, error) { return nil, errors.New("behind") })
+
+	report = c.Check(context.Background())
+	if report.Ready() || report.Checks["migrations"].Status != StatusFailing || report.Checks["migrations"].Error != "behind" {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+}
+
+func TestCheckerTimeout(t *testing.T) {
+	c := NewChecker(10 * time.Millisecond)
+	c.Add("slow", func(ctx context.Context) (any, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	if report := c.Check(context.Background()); report.Ready() {
+		t.Fatalf("a check past the timeout should fail: %+v", report)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	c := NewChecker(time.Second)
+	c.Add("database", func(ctx context.Context) (any, error) { return nil, nil })
+	c.Drain()
+
+	report := c.Check(context.Background())
+	if report.Ready() || report.Checks["shutdown"].Status != StatusFailing {
+		t.Fatalf("a draining service should not be ready: %+v", report)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	if b := Build(); b.Version != Version || b.Commit == "" || b.BuildTime == "" {
+		t.Fatalf("unexpected build info: %+v", b)
+	}
+}
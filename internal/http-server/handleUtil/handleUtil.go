@@ -1,21 +1,36 @@
 package handleutil
 
 import (
+	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/sabbatD/srest-api/internal/lib/api/access"
+	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+	"github.com/sabbatD/srest-api/internal/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Shortcut for logging
 func SlogWith(op string, r *http.Request) []any {
-	return []any{
+	attrs := []any{
 		slog.String("op", op),
 		slog.String("request_id", middleware.GetReqID(r.Context())),
-		slog.String("\n", ""),
 	}
+	attrs = append(attrs, tracing.LogAttrs(r.Context())...)
+
+	return append(attrs, slog.String("\n", ""))
+}
+
+// Trace starts the span of a handler, the returned request carries it to the storage
+func Trace(r *http.Request, op string) (*http.Request, trace.Span) {
+	ctx, span := tracing.Start(r.Context(), op)
+	return r.WithContext(ctx), span
 }
 
 // Shortcut for InternalError
@@ -33,3 +48,75 @@ func GetUrlParam(w http.ResponseWriter, r *http.Request, log *slog.Logger) int {
 	}
 	return id
 }
+
+// Shortcut for GetNamedUrlParam
+func GetNamedUrlParam(r *http.Request, name string) int {
+	id, err := strconv.Atoi(chi.URLParam(r, name))
+	if err != nil || id < 1 {
+		return 0
+	}
+	return id
+}
+
+// ETag formats a row version as a strong entity tag.
+func ETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// NotModified sets the ETag header and reports whether the If-None-Match header of the request
+// matches it. In that case 304 Not Modified is already written.
+func NotModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+
+	match := r.Header.Get("If-None-Match")
+	if match == "" {
+		return false
+	}
+
+	// If-None-Match uses the weak comparison, so a W/ prefix is ignored.
+	for _, tag := range strings.Split(match, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+
+	return false
+}
+
+// IfMatch returns the version required by the If-Match header of the request, 0 if any version will do.
+// ok is false for a header that can not match any version.
+func IfMatch(r *http.Request) (version int, ok bool) {
+	match := strings.TrimSpace(r.Header.Get("If-Match"))
+	if match == "" || match == "*" {
+		return 0, true
+	}
+
+	version, err := strconv.Atoi(strings.Trim(match, `"`))
+	if err != nil || version < 1 || match != ETag(version) {
+		return 0, false
+	}
+
+	return version, true
+}
+
+// Authorize reports whether an access level role to a task or list is enough for need, admins pass with any level.
+// Otherwise it writes 403 Forbidden, or 404 Not Found with the missing message for a resource the caller
+// can not see at all, so its existence is not revealed.
+func Authorize(w http.ResponseWriter, r *http.Request, log *slog.Logger, role, need int, missing string) bool {
+	userContext, _ := r.Context().Value(access.CxtKey("userContext")).(access.UserContext)
+
+	switch {
+	case role >= need || slices.Contains(userContext.Roles, "ADMIN"):
+		return true
+	case role == t.NoAccess:
+		log.Info(fmt.Sprintf("user %v has no access", userContext.UserId))
+		http.Error(w, missing, http.StatusNotFound)
+	default:
+		log.Info(fmt.Sprintf("user %v has access level %v, %v is required", userContext.UserId, role, need))
+		http.Error(w, "Access denied", http.StatusForbidden)
+	}
+
+	return false
+}
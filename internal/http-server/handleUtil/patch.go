@@ -0,0 +1,71 @@
+package handleutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/sabbatD/srest-api/internal/lib/api/patch"
+	"github.com/sabbatD/srest-api/internal/lib/api/validation"
+	"github.com/sabbatD/srest-api/internal/lib/logger/sl"
+)
+
+// ApplyPatch applies the merge patch or JSON patch in the request body to current
+// and validates the result. It writes the error response itself.
+func ApplyPatch[T any](w http.ResponseWriter, r *http.Request, log *slog.Logger, current T) (T, bool) {
+	var result T
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Error("failed to read request", sl.Err(err))
+		http.Error(w, "failed to read request", http.StatusBadRequest)
+		return result, false
+	}
+
+	doc, err := json.Marshal(current)
+	if err != nil {
+		InternalError(w, r, log, err)
+		return result, false
+	}
+
+	doc, err = patch.Apply(r.Header.Get("Content-Type"), doc, body)
+	if err != nil {
+		log.Info("failed to apply patch", sl.Err(err))
+
+		switch {
+		case errors.Is(err, patch.ErrUnsupportedMediaType):
+			http.Error(w, fmt.Sprintf("Content-Type must be %s or %s", patch.MergePatch, patch.JSONPatch), http.StatusUnsupportedMediaType)
+		case errors.Is(err, patch.ErrTestFailed):
+			http.Error(w, "Patch test failed", http.StatusConflict)
+		default:
+			http.Error(w, fmt.Sprintf("Invalid patch: %v", err.Error()), http.StatusBadRequest)
+		}
+
+		return result, false
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&result); err != nil {
+		log.Info("failed to decode patched document", sl.Err(err))
+		http.Error(w, fmt.Sprintf("Invalid input: %v", err.Error()), http.StatusBadRequest)
+		return result, false
+	}
+
+	validation.InitValidator()
+	if err := validation.ValidateStruct(result); err != nil {
+		log.Debug(fmt.Sprintf("validation failed: %v", err.Error()))
+
+		http.Error(w, fmt.Sprintf("Invalid input: %v", err.Error()), http.StatusBadRequest)
+
+		return result, false
+	}
+
+	log.Info("patch applied")
+
+	return result, true
+}
@@ -1,6 +1,7 @@
 package admin
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -21,12 +22,12 @@ type UpdateRequest struct {
 }
 
 type AdminHandler interface {
-	UpdateField(field string, id int, val any) (int64, error)
-	UpdateRoles(id int, roles []string) (int64, error)
-	All(q u.GetAllQuery) (result u.MetaResponse, E error)
-	Remove(id int) (int64, error)
-	Get(id int) (u.TableUser, error)
-	UpdateUser(u u.PutUser, id int) (int64, error)
+	UpdateField(ctx context.Context, field string, id int, val any) (int64, error)
+	UpdateRoles(ctx context.Context, id int, roles []string) (int64, error)
+	All(ctx context.Context, q u.GetAllQuery) (result u.MetaResponse, E error)
+	Remove(ctx context.Context, id int) (int64, error)
+	Get(ctx context.Context, id int) (u.TableUser, error)
+	UpdateUser(ctx context.Context, u u.PutUser, id int, version int) (int64, error)
 }
 
 // All godoc
@@ -51,7 +52,10 @@ func All(log *slog.Logger, Users AdminHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "http-server.handlers.admin.GetAll"
 
-		log.With(util.SlogWith(op, r)...)
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
 
 		roles, err := contextAdmin(r)
 		if err != nil {
@@ -104,7 +108,7 @@ func All(log *slog.Logger, Users AdminHandler) http.HandlerFunc {
 			q.Offset = 0
 		}
 
-		metaResponse, err := Users.All(q)
+		metaResponse, err := Users.All(r.Context(), q)
 		if err != nil {
 			util.InternalError(w, r, log, err)
 			return
@@ -136,7 +140,10 @@ func Profile(log *slog.Logger, User AdminHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "http-server.handlers.user.Profile"
 
-		log.With(util.SlogWith(op, r)...)
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
 
 		roles, err := contextAdmin(r)
 		if err != nil {
@@ -155,7 +162,7 @@ func Profile(log *slog.Logger, User AdminHandler) http.HandlerFunc {
 			return
 		}
 
-		user, err := User.Get(id)
+		user, err := User.Get(r.Context(), id)
 		if err != nil {
 			if err.Error() == "database.postgres.Get: no such user" {
 				log.Info(err.Error())
@@ -197,7 +204,10 @@ func UpdateUser(log *slog.Logger, User AdminHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "http-server.handlers.admin.UpdateUser"
 
-		log.With(util.SlogWith(op, r)...)
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
 
 		roles, err := contextAdmin(r)
 		if err != nil {
@@ -239,7 +249,7 @@ func UpdateUser(log *slog.Logger, User AdminHandler) http.HandlerFunc {
 			return
 		}
 
-		n, err := User.UpdateUser(req, id)
+		n, err := User.UpdateUser(r.Context(), req, id, 0)
 		if err != nil {
 			if n == 0 {
 				log.Info(err.Error())
@@ -259,7 +269,7 @@ func UpdateUser(log *slog.Logger, User AdminHandler) http.HandlerFunc {
 			return
 		}
 
-		user, err := User.Get(id)
+		user, err := User.Get(r.Context(), id)
 		if err != nil {
 			util.InternalError(w, r, log, err)
 		}
@@ -290,7 +300,10 @@ func Remove(log *slog.Logger, User AdminHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "http-server.handlers.admin.Remove"
 
-		log.With(util.SlogWith(op, r)...)
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
 
 		roles, err := contextAdmin(r)
 		if err != nil {
@@ -309,7 +322,7 @@ func Remove(log *slog.Logger, User AdminHandler) http.HandlerFunc {
 			return
 		}
 
-		n, err := User.Remove(id)
+		n, err := User.Remove(r.Context(), id)
 		if err != nil {
 			if n == 0 {
 				log.Info(err.Error())
@@ -388,7 +401,10 @@ func Update(log *slog.Logger, User AdminHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "http-server.handlers.admin.Update"
 
-		log.With(util.SlogWith(op, r)...)
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
 
 		roles, err := contextAdmin(r)
 		if err != nil {
@@ -420,7 +436,7 @@ func Update(log *slog.Logger, User AdminHandler) http.HandlerFunc {
 			return
 		}
 
-		if n, err := User.UpdateRoles(id, req.Roles); err != nil {
+		if n, err := User.UpdateRoles(r.Context(), id, req.Roles); err != nil {
 			if n == 0 {
 				log.Info(err.Error())
 
@@ -438,7 +454,7 @@ func Update(log *slog.Logger, User AdminHandler) http.HandlerFunc {
 			return
 		}
 
-		user, err := User.Get(id)
+		user, err := User.Get(r.Context(), id)
 		if err != nil {
 			util.InternalError(w, r, log, err)
 			return
@@ -461,7 +477,10 @@ func contextAdmin(r *http.Request) ([]string, error) {
 }
 
 func changeField(w http.ResponseWriter, r *http.Request, log *slog.Logger, User AdminHandler, op, field string, value bool) {
-	log.With(util.SlogWith(op, r)...)
+	r, span := util.Trace(r, op)
+	defer span.End()
+
+	log = log.With(util.SlogWith(op, r)...)
 
 	roles, err := contextAdmin(r)
 	if err != nil {
@@ -480,7 +499,7 @@ func changeField(w http.ResponseWriter, r *http.Request, log *slog.Logger, User
 		return
 	}
 
-	if n, err := User.UpdateField(field, id, value); err != nil {
+	if n, err := User.UpdateField(r.Context(), field, id, value); err != nil {
 		if n == 0 {
 			log.Info(err.Error())
 
@@ -494,7 +513,7 @@ func changeField(w http.ResponseWriter, r *http.Request, log *slog.Logger, User
 		return
 	}
 
-	user, err := User.Get(id)
+	user, err := User.Get(r.Context(), id)
 	if err != nil {
 		util.InternalError(w, r, log, err)
 		return
@@ -0,0 +1,273 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/render"
+	util "github.com/sabbatD/srest-api/internal/http-server/handleUtil"
+	"github.com/sabbatD/srest-api/internal/jobs"
+)
+
+type JobHandler interface {
+	Jobs(ctx context.Context, q jobs.Query) ([]jobs.Job, error)
+	GetJob(ctx context.Context, id int64) (jobs.Job, error)
+	RetryJob(ctx context.Context, id int64) (int64, error)
+	DeleteJob(ctx context.Context, id int64) (int64, error)
+}
+
+// Jobs godoc
+// @Summary List background jobs
+// @Description Lists background jobs, latest first. status=failed lists the jobs that ran out of attempts. Only for admins.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "queued, running, succeeded or failed"
+// @Param kind query string false "Only jobs of the kind"
+// @Param limit query int false "Number of jobs, 50 by default, at most 500"
+// @Param offset query int false "Number of jobs to skip"
+// @Success 200 {array} jobs.Job "Jobs retrieved successfully."
+// @Failure 400 {object} string "Invalid filter."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 403 {object} string "Insufficient permissions."
+// @Failure 500 {object} string "Internal server error."
+// @Router /admin/jobs [get]
+func Jobs(log *slog.Logger, queue JobHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.handlers.admin.Jobs"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		if !adminOnly(w, r) {
+			return
+		}
+
+		query := r.URL.Query()
+		q := jobs.Query{Status: query.Get("status"), Kind: query.Get("kind"), Limit: 50}
+
+		switch q.Status {
+		case "", jobs.Queued, jobs.Running, jobs.Succeeded, jobs.Failed:
+		default:
+			log.Info(fmt.Sprintf("invalid status: %q", q.Status))
+			http.Error(w, "Invalid status", http.StatusBadRequest)
+			return
+		}
+
+		if s := query.Get("limit"); s != "" {
+			limit, err := strconv.Atoi(s)
+			if err != nil || limit < 1 || limit > 500 {
+				log.Info(fmt.Sprintf("invalid limit: %q", s))
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			q.Limit = limit
+		}
+
+		if s := query.Get("offset"); s != "" {
+			offset, err := strconv.Atoi(s)
+			if err != nil || offset < 0 {
+				log.Info(fmt.Sprintf("invalid offset: %q", s))
+				http.Error(w, "Invalid offset", http.StatusBadRequest)
+				return
+			}
+			q.Offset = offset
+		}
+
+		result, err := queue.Jobs(r.Context(), q)
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		if result == nil {
+			result = []jobs.Job{}
+		}
+
+		log.Info("jobs successfully retrieved")
+
+		render.JSON(w, r, result)
+	}
+}
+
+// GetJob godoc
+// @Summary Retrieve a background job
+// @Description Retrieves a job with its payload and the error of its last attempt. Only for admins.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID of the job"
+// @Success 200 {object} jobs.Job "Job retrieved successfully."
+// @Failure 400 {object} string "Invalid or missing job ID."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 403 {object} string "Insufficient permissions."
+// @Failure 404 {object} string "Job not found."
+// @Failure 500 {object} string "Internal server error."
+// @Router /admin/jobs/{id} [get]
+func GetJob(log *slog.Logger, queue JobHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.handlers.admin.GetJob"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		if !adminOnly(w, r) {
+			return
+		}
+
+		id := util.GetUrlParam(w, r, log)
+		if id == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		job, err := queue.GetJob(r.Context(), int64(id))
+		if err != nil {
+			if err.Error() == "database.postgres.GetJob: no such job" {
+				log.Info(err.Error())
+
+				http.Error(w, "No such job", http.StatusNotFound)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info("job successfully retrieved")
+
+		render.JSON(w, r, job)
+	}
+}
+
+// RetryJob godoc
+// @Summary Retry a failed background job
+// @Description Queues a job that ran out of attempts to run now with a fresh set of attempts. Only for admins.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID of the job"
+// @Success 200 {object} jobs.Job "Job queued."
+// @Failure 400 {object} string "Invalid or missing job ID."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 403 {object} string "Insufficient permissions."
+// @Failure 404 {object} string "Job not found."
+// @Failure 409 {object} string "Job did not fail or a job with the same unique key is pending."
+// @Failure 500 {object} string "Internal server error."
+// @Router /admin/jobs/{id}/retry [post]
+func RetryJob(log *slog.Logger, queue JobHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.handlers.admin.RetryJob"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		if !adminOnly(w, r) {
+			return
+		}
+
+		id := util.GetUrlParam(w, r, log)
+		if id == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		n, err := queue.RetryJob(r.Context(), int64(id))
+		if err != nil {
+			switch n {
+			case 0:
+				log.Info(err.Error())
+
+				http.Error(w, "No such job", http.StatusNotFound)
+			case -2:
+				log.Info(err.Error())
+
+				http.Error(w, "Only failed jobs can be retried", http.StatusConflict)
+			case -3:
+				log.Info(err.Error())
+
+				http.Error(w, "Job with the same unique key is pending", http.StatusConflict)
+			default:
+				util.InternalError(w, r, log, err)
+			}
+			return
+		}
+
+		job, err := queue.GetJob(r.Context(), int64(id))
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info(fmt.Sprintf("job %v queued for retry", id))
+
+		render.JSON(w, r, job)
+	}
+}
+
+// DeleteJob godoc
+// @Summary Delete a background job
+// @Description Deletes a job that is not running, a queued job is cancelled. Only for admins.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID of the job"
+// @Success 200 {object} string "Job deleted successfully."
+// @Failure 400 {object} string "Invalid or missing job ID."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 403 {object} string "Insufficient permissions."
+// @Failure 404 {object} string "Job not found."
+// @Failure 409 {object} string "Job is running."
+// @Failure 500 {object} string "Internal server error."
+// @Router /admin/jobs/{id} [delete]
+func DeleteJob(log *slog.Logger, queue JobHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.handlers.admin.DeleteJob"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		if !adminOnly(w, r) {
+			return
+		}
+
+		id := util.GetUrlParam(w, r, log)
+		if id == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		n, err := queue.DeleteJob(r.Context(), int64(id))
+		if err != nil {
+			switch n {
+			case 0:
+				log.Info(err.Error())
+
+				http.Error(w, "No such job", http.StatusNotFound)
+			case -2:
+				log.Info(err.Error())
+
+				http.Error(w, "Job is running", http.StatusConflict)
+			default:
+				util.InternalError(w, r, log, err)
+			}
+			return
+		}
+
+		log.Info(fmt.Sprintf("job %v deleted", id))
+	}
+}
@@ -0,0 +1,491 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/go-chi/render"
+	util "github.com/sabbatD/srest-api/internal/http-server/handleUtil"
+	"github.com/sabbatD/srest-api/internal/lib/api/validation"
+	"github.com/sabbatD/srest-api/internal/lib/logger/sl"
+	"github.com/sabbatD/srest-api/internal/webhook"
+)
+
+type WebhookHandler interface {
+	Webhooks(ctx context.Context) ([]webhook.Webhook, error)
+	GetWebhook(ctx context.Context, id int) (webhook.Webhook, error)
+	CreateWebhook(ctx context.Context, req webhook.Request, secret string) (webhook.Webhook, error)
+	UpdateWebhook(ctx context.Context, id int, req webhook.Request) (int64, error)
+	DeleteWebhook(ctx context.Context, id int) (int64, error)
+	Deliveries(ctx context.Context, q webhook.DeliveryQuery) ([]webhook.Delivery, error)
+	ReplayDelivery(ctx context.Context, id int64) (webhook.Delivery, int64, error)
+}
+
+// Webhooks godoc
+// @Summary List webhooks
+// @Description Lists every webhook subscription without its secret. Only for admins.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} webhook.Webhook "Webhooks retrieved successfully."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 403 {object} string "Insufficient permissions."
+// @Failure 500 {object} string "Internal server error."
+// @Router /admin/webhooks [get]
+func Webhooks(log *slog.Logger, hooks WebhookHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.handlers.admin.Webhooks"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		if !adminOnly(w, r) {
+			return
+		}
+
+		result, err := hooks.Webhooks(r.Context())
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		if result == nil {
+			result = []webhook.Webhook{}
+		}
+
+		log.Info("webhooks successfully retrieved")
+
+		render.JSON(w, r, result)
+	}
+}
+
+// GetWebhook godoc
+// @Summary Retrieve a webhook
+// @Description Retrieves a webhook subscription without its secret. Only for admins.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID of the webhook"
+// @Success 200 {object} webhook.Webhook "Webhook retrieved successfully."
+// @Failure 400 {object} string "Invalid or missing webhook ID."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 403 {object} string "Insufficient permissions."
+// @Failure 404 {object} string "Webhook not found."
+// @Failure 500 {object} string "Internal server error."
+// @Router /admin/webhooks/{id} [get]
+func GetWebhook(log *slog.Logger, hooks WebhookHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.handlers.admin.GetWebhook"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		if !adminOnly(w, r) {
+			return
+		}
+
+		id := util.GetUrlParam(w, r, log)
+		if id == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		hook, err := hooks.GetWebhook(r.Context(), id)
+		if err != nil {
+			if err.Error() == "database.postgres.GetWebhook: no such webhook" {
+				log.Info(err.Error())
+
+				http.Error(w, "No such webhook", http.StatusNotFound)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info("webhook successfully retrieved")
+
+		render.JSON(w, r, hook)
+	}
+}
+
+// CreateWebhook godoc
+// @Summary Create a webhook
+// @Description Subscribes a URL to events, "*" subscribes it to every event. Deliveries are signed with the secret
+// of the webhook, a secret is generated if none is given. The response is the only one showing the secret. Only for admins.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param WebhookData body webhook.Request true "Webhook"
+// @Success 201 {object} webhook.Webhook "Webhook created successfully."
+// @Failure 400 {object} string "Invalid request body or unknown event."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 403 {object} string "Insufficient permissions."
+// @Failure 500 {object} string "Internal server error."
+// @Router /admin/webhooks [post]
+func CreateWebhook(log *slog.Logger, hooks WebhookHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.handlers.admin.CreateWebhook"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		if !adminOnly(w, r) {
+			return
+		}
+
+		req, ok := decodeWebhook(w, r, log)
+		if !ok {
+			return
+		}
+
+		secret := req.Secret
+		if secret == "" {
+			var err error
+			if secret, err = webhook.NewSecret(); err != nil {
+				util.InternalError(w, r, log, err)
+				return
+			}
+		}
+
+		hook, err := hooks.CreateWebhook(r.Context(), req, secret)
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info(fmt.Sprintf("webhook %v successfully created", hook.ID))
+
+		w.WriteHeader(http.StatusCreated)
+		render.JSON(w, r, hook)
+	}
+}
+
+// UpdateWebhook godoc
+// @Summary Replace a webhook
+// @Description Replaces the URL, events, description and state of a webhook. A given secret replaces the current one,
+// without it the webhook keeps its secret. Only for admins.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID of the webhook"
+// @Param WebhookData body webhook.Request true "Webhook"
+// @Success 200 {object} webhook.Webhook "Webhook updated successfully."
+// @Failure 400 {object} string "Invalid request body, ID or unknown event."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 403 {object} string "Insufficient permissions."
+// @Failure 404 {object} string "Webhook not found."
+// @Failure 500 {object} string "Internal server error."
+// @Router /admin/webhooks/{id} [put]
+func UpdateWebhook(log *slog.Logger, hooks WebhookHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.handlers.admin.UpdateWebhook"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		if !adminOnly(w, r) {
+			return
+		}
+
+		id := util.GetUrlParam(w, r, log)
+		if id == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		req, ok := decodeWebhook(w, r, log)
+		if !ok {
+			return
+		}
+
+		n, err := hooks.UpdateWebhook(r.Context(), id, req)
+		if err != nil {
+			if n == 0 {
+				log.Info(err.Error())
+
+				http.Error(w, "No such webhook", http.StatusNotFound)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		hook, err := hooks.GetWebhook(r.Context(), id)
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info(fmt.Sprintf("webhook %v successfully updated", id))
+
+		render.JSON(w, r, hook)
+	}
+}
+
+// DeleteWebhook godoc
+// @Summary Delete a webhook
+// @Description Deletes a webhook together with its delivery log. Only for admins.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID of the webhook"
+// @Success 200 {object} string "Webhook deleted successfully."
+// @Failure 400 {object} string "Invalid or missing webhook ID."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 403 {object} string "Insufficient permissions."
+// @Failure 404 {object} string "Webhook not found."
+// @Failure 500 {object} string "Internal server error."
+// @Router /admin/webhooks/{id} [delete]
+func DeleteWebhook(log *slog.Logger, hooks WebhookHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.handlers.admin.DeleteWebhook"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		if !adminOnly(w, r) {
+			return
+		}
+
+		id := util.GetUrlParam(w, r, log)
+		if id == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		n, err := hooks.DeleteWebhook(r.Context(), id)
+		if err != nil {
+			if n == 0 {
+				log.Info(err.Error())
+
+				http.Error(w, "No such webhook", http.StatusNotFound)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info(fmt.Sprintf("webhook %v successfully deleted", id))
+	}
+}
+
+// Deliveries godoc
+// @Summary Retrieve the delivery log
+// @Description Retrieves deliveries, latest first. Dead deliveries ran out of attempts, status=dead lists the dead letters.
+// /admin/webhooks/{id}/deliveries returns the log of one webhook. Only for admins.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param webhookId query int false "Only deliveries of the webhook"
+// @Param status query string false "pending, delivered or dead"
+// @Param event query string false "Only deliveries of the event"
+// @Param limit query int false "Number of deliveries, 50 by default, at most 500"
+// @Param offset query int false "Number of deliveries to skip"
+// @Success 200 {array} webhook.Delivery "Deliveries retrieved successfully."
+// @Failure 400 {object} string "Invalid filter."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 403 {object} string "Insufficient permissions."
+// @Failure 500 {object} string "Internal server error."
+// @Router /admin/webhooks/deliveries [get]
+func Deliveries(log *slog.Logger, hooks WebhookHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.handlers.admin.Deliveries"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		if !adminOnly(w, r) {
+			return
+		}
+
+		query := r.URL.Query()
+		q := webhook.DeliveryQuery{
+			WebhookID: util.GetUrlParam(w, r, log),
+			Status:    query.Get("status"),
+			Event:     query.Get("event"),
+			Limit:     50,
+		}
+
+		if q.WebhookID == 0 && query.Get("webhookId") != "" {
+			id, err := strconv.Atoi(query.Get("webhookId"))
+			if err != nil || id < 1 {
+				log.Info("invalid webhook id")
+				http.Error(w, "Invalid webhookId", http.StatusBadRequest)
+				return
+			}
+			q.WebhookID = id
+		}
+
+		switch q.Status {
+		case "", webhook.Pending, webhook.Delivered, webhook.Dead:
+		default:
+			log.Info(fmt.Sprintf("invalid status: %q", q.Status))
+			http.Error(w, "Invalid status", http.StatusBadRequest)
+			return
+		}
+
+		if s := query.Get("limit"); s != "" {
+			limit, err := strconv.Atoi(s)
+			if err != nil || limit < 1 || limit > 500 {
+				log.Info(fmt.Sprintf("invalid limit: %q", s))
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			q.Limit = limit
+		}
+
+		if s := query.Get("offset"); s != "" {
+			offset, err := strconv.Atoi(s)
+			if err != nil || offset < 0 {
+				log.Info(fmt.Sprintf("invalid offset: %q", s))
+				http.Error(w, "Invalid offset", http.StatusBadRequest)
+				return
+			}
+			q.Offset = offset
+		}
+
+		result, err := hooks.Deliveries(r.Context(), q)
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		if result == nil {
+			result = []webhook.Delivery{}
+		}
+
+		log.Info("deliveries successfully retrieved")
+
+		render.JSON(w, r, result)
+	}
+}
+
+// ReplayDelivery godoc
+// @Summary Replay a delivery
+// @Description Sends the payload of a logged delivery again as a new delivery with its own attempts,
+// for example a dead letter after the receiver is fixed. The original stays in the log. Only for admins.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID of the delivery"
+// @Success 202 {object} webhook.Delivery "Delivery queued."
+// @Failure 400 {object} string "Invalid or missing delivery ID."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 403 {object} string "Insufficient permissions."
+// @Failure 404 {object} string "Delivery not found."
+// @Failure 500 {object} string "Internal server error."
+// @Router /admin/webhooks/deliveries/{id}/replay [post]
+func ReplayDelivery(log *slog.Logger, hooks WebhookHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.handlers.admin.ReplayDelivery"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		if !adminOnly(w, r) {
+			return
+		}
+
+		id := util.GetUrlParam(w, r, log)
+		if id == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		delivery, n, err := hooks.ReplayDelivery(r.Context(), int64(id))
+		if err != nil {
+			if n == 0 {
+				log.Info(err.Error())
+
+				http.Error(w, "No such delivery", http.StatusNotFound)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info(fmt.Sprintf("delivery %v replayed as %v", id, delivery.ID))
+
+		w.WriteHeader(http.StatusAccepted)
+		render.JSON(w, r, delivery)
+	}
+}
+
+// adminOnly writes 401 or 403 unless the caller is an admin. Webhooks and jobs touch every user
+// and task, so moderators can not manage them.
+func adminOnly(w http.ResponseWriter, r *http.Request) bool {
+	roles, err := contextAdmin(r)
+	if err != nil {
+		http.Error(w, "User context not found", http.StatusUnauthorized)
+		return false
+	}
+
+	if !slices.Contains(roles, "ADMIN") {
+		http.Error(w, "not enough rights", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+func decodeWebhook(w http.ResponseWriter, r *http.Request, log *slog.Logger) (webhook.Request, bool) {
+	var req webhook.Request
+	if err := render.DecodeJSON(r.Body, &req); err != nil {
+		log.Error("failed to decode request", sl.Err(err))
+
+		http.Error(w, "failed to deserialize json request", http.StatusBadRequest)
+
+		return req, false
+	}
+
+	log.Info("request body decoded")
+
+	validation.InitValidator()
+	if err := validation.ValidateStruct(req); err != nil {
+		log.Debug(fmt.Sprintf("validation failed: %v", err.Error()))
+
+		http.Error(w, fmt.Sprintf("Invalid input: %v", err.Error()), http.StatusBadRequest)
+
+		return req, false
+	}
+
+	if !webhook.ValidEvents(req.Events) {
+		log.Info(fmt.Sprintf("unknown events: %v", req.Events))
+
+		http.Error(w, fmt.Sprintf("Unknown event, known events are: %v", webhook.Events), http.StatusBadRequest)
+
+		return req, false
+	}
+
+	log.Info("input validated")
+
+	return req, true
+}
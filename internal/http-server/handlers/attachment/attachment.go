@@ -0,0 +1,430 @@
+package attachment
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/go-chi/render"
+	"github.com/sabbatD/srest-api/internal/blob"
+	util "github.com/sabbatD/srest-api/internal/http-server/handleUtil"
+	"github.com/sabbatD/srest-api/internal/lib/api/access"
+	"github.com/sabbatD/srest-api/internal/lib/logger/sl"
+	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+)
+
+// basePath prefixes the signed download URLs.
+const basePath = "/api/v1"
+
+type AttachmentHandler interface {
+	CreateAttachment(ctx context.Context, a t.Attachment, quota int64) (int64, error)
+	DeleteAttachment(ctx context.Context, id int) (int64, error)
+	GetAttachment(ctx context.Context, id int) (t.Attachment, error)
+	Attachments(ctx context.Context, todoID int) ([]t.Attachment, error)
+	AttachmentUsage(ctx context.Context, ownerID int) (int64, error)
+	TodoRole(ctx context.Context, id, user int) (int, error)
+}
+
+// Limits bounds the size of a single upload and the total size of the attachments of a user.
+type Limits struct {
+	MaxSize int64
+	Quota   int64
+}
+
+// Upload godoc
+// @Summary Attach a file to a task
+// @Description Uploads a file as multipart/form-data in the "file" field. The content type is sniffed from the file contents.
+// A single file is limited by the configured max size and all attachments of a user by the configured quota.
+// @Tags attachment
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID of the task"
+// @Param file formData file true "File to attach"
+// @Success 201 {object} t.Attachment "Attachment successfully created."
+// @Failure 400 {object} string "Invalid request body or ID."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 403 {object} string "Access denied."
+// @Failure 404 {object} string "Task not found."
+// @Failure 413 {object} string "File too large or quota exceeded."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/{id}/attachments [post]
+func Upload(log *slog.Logger, storage AttachmentHandler, blobs blob.BlobStore, signer *blob.Signer, limits Limits) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.attachment.Upload"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		userContext, ok := r.Context().Value(access.CxtKey("userContext")).(access.UserContext)
+		if !ok {
+			http.Error(w, "User context not found", http.StatusUnauthorized)
+			return
+		}
+
+		id := util.GetUrlParam(w, r, log)
+		if id == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		if !authorize(w, r, log, storage, id, userContext.UserId, t.EditAccess) {
+			return
+		}
+
+		// The multipart envelope takes a few bytes on top of the file itself.
+		r.Body = http.MaxBytesReader(w, r.Body, limits.MaxSize+1<<20)
+
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			log.Info("failed to read file", sl.Err(err))
+			http.Error(w, "Missing file", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		if header.Size > limits.MaxSize {
+			http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		used, err := storage.AttachmentUsage(r.Context(), userContext.UserId)
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+		if used+header.Size > limits.Quota {
+			log.Info("attachment quota exceeded")
+			http.Error(w, "Attachment quota exceeded", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		contentType, err := sniff(file)
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		key, err := blobKey(id)
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		if err := blobs.Put(r.Context(), key, file, header.Size, contentType); err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		a := t.Attachment{
+			TodoID:      id,
+			OwnerID:     userContext.UserId,
+			Filename:    filepath.Base(header.Filename),
+			ContentType: contentType,
+			Size:        header.Size,
+			BlobKey:     key,
+		}
+
+		attachmentID, err := storage.CreateAttachment(r.Context(), a, limits.Quota)
+		if err != nil {
+			if err := blobs.Delete(r.Context(), key); err != nil {
+				log.Error("failed to delete orphaned blob", sl.Err(err))
+			}
+
+			switch attachmentID {
+			case 0:
+				log.Info(err.Error())
+				http.Error(w, "No such task", http.StatusNotFound)
+			case -2:
+				log.Info(err.Error())
+				http.Error(w, "Attachment quota exceeded", http.StatusRequestEntityTooLarge)
+			default:
+				util.InternalError(w, r, log, err)
+			}
+			return
+		}
+
+		a, err = storage.GetAttachment(r.Context(), int(attachmentID))
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+		a.URL = signer.URL(basePath, a.ID)
+
+		log.Info("successfully uploaded attachment")
+
+		w.WriteHeader(http.StatusCreated)
+		render.JSON(w, r, a)
+	}
+}
+
+// List godoc
+// @Summary Retrieve attachments of a task
+// @Description Retrieves the attachments of a task, each with a signed download URL valid for a limited time.
+// @Tags attachment
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID of the task"
+// @Success 200 {array} t.Attachment "Attachments retrieved successfully."
+// @Failure 400 {object} string "Invalid or missing task ID."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 403 {object} string "Access denied."
+// @Failure 404 {object} string "Task not found."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/{id}/attachments [get]
+func List(log *slog.Logger, storage AttachmentHandler, signer *blob.Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.attachment.List"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		id := util.GetUrlParam(w, r, log)
+		if id == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		userContext, _ := r.Context().Value(access.CxtKey("userContext")).(access.UserContext)
+		if !authorize(w, r, log, storage, id, userContext.UserId, t.ViewAccess) {
+			return
+		}
+
+		attachments, err := storage.Attachments(r.Context(), id)
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		if attachments == nil {
+			attachments = []t.Attachment{}
+		}
+		for i := range attachments {
+			attachments[i].URL = signer.URL(basePath, attachments[i].ID)
+		}
+
+		log.Info("successfully retrieved attachments")
+
+		render.JSON(w, r, attachments)
+	}
+}
+
+// Delete godoc
+// @Summary Delete an attachment
+// @Description Deletes an attachment and its contents. Only the uploader or an ADMIN can delete an attachment.
+// @Tags attachment
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID of the task"
+// @Param attachmentId path int true "ID of the attachment"
+// @Success 200 {object} string "Attachment successfully deleted."
+// @Failure 400 {object} string "Invalid or missing ID."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 403 {object} string "Insufficient permissions."
+// @Failure 404 {object} string "Attachment not found."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/{id}/attachments/{attachmentId} [delete]
+func Delete(log *slog.Logger, storage AttachmentHandler, blobs blob.BlobStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.attachment.Delete"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		userContext, ok := r.Context().Value(access.CxtKey("userContext")).(access.UserContext)
+		if !ok {
+			http.Error(w, "User context not found", http.StatusUnauthorized)
+			return
+		}
+
+		id := util.GetUrlParam(w, r, log)
+		attachmentID := util.GetNamedUrlParam(r, "attachmentId")
+		if id == 0 || attachmentID == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		a, err := storage.GetAttachment(r.Context(), attachmentID)
+		if err != nil {
+			if err.Error() == "database.postgres.GetAttachment: no such attachment" {
+				log.Info(err.Error())
+
+				http.Error(w, "No such attachment", http.StatusNotFound)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		if a.TodoID != id {
+			log.Info(fmt.Sprintf("attachment %v does not belong to task %v", attachmentID, id))
+			http.Error(w, "No such attachment", http.StatusNotFound)
+			return
+		}
+
+		if a.OwnerID != userContext.UserId && !slices.Contains(userContext.Roles, "ADMIN") {
+			http.Error(w, "not enough rights", http.StatusForbidden)
+			return
+		}
+
+		n, err := storage.DeleteAttachment(r.Context(), attachmentID)
+		if err != nil {
+			if n == 0 {
+				log.Info(err.Error())
+
+				http.Error(w, "No such attachment", http.StatusNotFound)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		// The row is gone already, a failure here only leaves an unreachable blob behind.
+		if err := blobs.Delete(r.Context(), a.BlobKey); err != nil {
+			log.Error("failed to delete blob", sl.Err(err))
+		}
+
+		log.Info("successfully deleted attachment")
+	}
+}
+
+// Download godoc
+// @Summary Download an attachment
+// @Description Streams the contents of an attachment. The URL must carry a valid signature
+// as returned by the upload and list endpoints, no Authorization header is needed.
+// @Tags attachment
+// @Produce octet-stream
+// @Param id path int true "ID of the attachment"
+// @Param expires query int true "Expiry of the URL as unix time"
+// @Param signature query string true "Signature of the URL"
+// @Success 200 {file} file "Attachment contents."
+// @Failure 403 {object} string "Invalid or expired signature."
+// @Failure 404 {object} string "Attachment not found."
+// @Failure 500 {object} string "Internal server error."
+// @Router /attachments/{id}/download [get]
+func Download(log *slog.Logger, storage AttachmentHandler, blobs blob.BlobStore, signer *blob.Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.attachment.Download"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		id := util.GetUrlParam(w, r, log)
+		if id == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		q := r.URL.Query()
+		if !signer.Verify(id, q.Get("expires"), q.Get("signature")) {
+			log.Info("invalid or expired signature")
+			http.Error(w, "Invalid or expired link", http.StatusForbidden)
+			return
+		}
+
+		a, err := storage.GetAttachment(r.Context(), id)
+		if err != nil {
+			if err.Error() == "database.postgres.GetAttachment: no such attachment" {
+				log.Info(err.Error())
+
+				http.Error(w, "No such attachment", http.StatusNotFound)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		rc, err := blobs.Get(r.Context(), a.BlobKey)
+		if err != nil {
+			if errors.Is(err, blob.ErrNotFound) {
+				log.Info(err.Error())
+
+				http.Error(w, "No such attachment", http.StatusNotFound)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+		defer rc.Close()
+
+		w.Header().Set("Content-Type", a.ContentType)
+		w.Header().Set("Content-Length", strconv.FormatInt(a.Size, 10))
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename}))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+
+		if _, err := io.Copy(w, rc); err != nil {
+			log.Error("failed to stream attachment", sl.Err(err))
+			return
+		}
+
+		log.Info("successfully downloaded attachment")
+	}
+}
+
+// authorize checks that the user has at least the access level need to the task id.
+// It writes the error response itself.
+func authorize(w http.ResponseWriter, r *http.Request, log *slog.Logger, storage AttachmentHandler, id, user, need int) bool {
+	role, err := storage.TodoRole(r.Context(), id, user)
+	if err != nil {
+		util.InternalError(w, r, log, err)
+		return false
+	}
+
+	return util.Authorize(w, r, log, role, need, "No such task")
+}
+
+// sniff detects the content type from the content of the file and rewinds it.
+// Office documents and archives are told apart, not reported as application/zip.
+func sniff(file io.ReadSeeker) (string, error) {
+	mtype, err := mimetype.DetectReader(file)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	return mtype.String(), nil
+}
+
+func blobKey(todoID int) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("todos/%d/%s", todoID, hex.EncodeToString(b)), nil
+}
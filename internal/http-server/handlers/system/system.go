@@ -0,0 +1,65 @@
+// Package system serves the probes of the load balancer and the process manager and the build info.
+// They are requested often, so only failures are logged.
+package system
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/render"
+
+	"github.com/sabbatD/srest-api/internal/health"
+)
+
+type Status struct {
+	Status string `json:"status"`
+}
+
+// Healthz godoc
+// @Summary Liveness probe
+// @Description Answers as long as the process serves requests, nothing else is checked.
+// @Tags system
+// @Produce json
+// @Success 200 {object} Status "Alive."
+// @Router /healthz [get]
+func Healthz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, Status{Status: health.StatusOK})
+	}
+}
+
+// Readyz godoc
+// @Summary Readiness probe
+// @Description Checks the database connection, that the migrations are applied and that the job workers run.
+// Fails from the beginning of the shutdown, so the load balancer stops sending requests.
+// @Tags system
+// @Produce json
+// @Success 200 {object} health.Report "Ready."
+// @Failure 503 {object} health.Report "Not ready, the failing checks have errors."
+// @Router /readyz [get]
+func Readyz(log *slog.Logger, checker *health.Checker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.handlers.system.Readyz"
+
+		report := checker.Check(r.Context())
+		if !report.Ready() {
+			log.Warn("not ready", slog.String("op", op), slog.Any("checks", report.Checks))
+			render.Status(r, http.StatusServiceUnavailable)
+		}
+
+		render.JSON(w, r, report)
+	}
+}
+
+// Version godoc
+// @Summary Build info
+// @Description Returns the API version, the git commit and the time the service was built.
+// @Tags system
+// @Produce json
+// @Success 200 {object} health.BuildInfo "Build info."
+// @Router /version [get]
+func Version() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, health.Build())
+	}
+}
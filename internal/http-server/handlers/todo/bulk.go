@@ -0,0 +1,114 @@
+package todo
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/render"
+	util "github.com/sabbatD/srest-api/internal/http-server/handleUtil"
+	"github.com/sabbatD/srest-api/internal/lib/api/validation"
+	"github.com/sabbatD/srest-api/internal/lib/logger/sl"
+	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+)
+
+// Bulk godoc
+// @Summary Apply an action to many tasks
+// @Description Completes, uncompletes, deletes, moves or tags the tasks with the given IDs or, without IDs,
+// all tasks matching "where" like the query parameters of GetAll. Everything runs in one transaction.
+// Every task gets its own result with the status the single request would have returned,
+// a task that can not take the action does not stop the others. Filters only match the tasks the caller can edit,
+// tasks the caller can only view get 403. Returns the updated counters as well.
+// @Tags todo
+// @Accept json
+// @Produce json
+// @Param BulkData body t.BulkRequest true "Action and the tasks to apply it to"
+// @Success 200 {object} t.BulkResponse "Action applied, returns the per task results and counters."
+// @Failure 400 {object} string "Invalid request body."
+// @Failure 403 {object} string "Target list is read only."
+// @Failure 404 {object} string "Target list not found."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/bulk [post]
+func Bulk(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.Bulk"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		var req t.BulkRequest
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.Error("failed to decode request", sl.Err(err))
+
+			http.Error(w, "failed to deserialize json request", http.StatusBadRequest)
+
+			return
+		}
+
+		log.Info("request body decoded")
+		log.Debug("req: ", slog.Any("request", req))
+
+		validation.InitValidator()
+		if err := validation.ValidateStruct(req); err != nil {
+			log.Debug(fmt.Sprintf("validation failed: %v", err.Error()))
+
+			http.Error(w, fmt.Sprintf("Invalid input: %v", err.Error()), http.StatusBadRequest)
+
+			return
+		}
+
+		log.Info("input validated")
+
+		resp, n, err := todo.Bulk(r.Context(), req, actor(r))
+		if err != nil {
+			if n == 0 {
+				log.Info(err.Error())
+
+				http.Error(w, "No such list", http.StatusNotFound)
+
+				return
+			} else if n == -2 {
+				log.Info(err.Error())
+
+				http.Error(w, "Access denied", http.StatusForbidden)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		for i := range resp.Results {
+			resp.Results[i].Status, resp.Results[i].Error = bulkStatus(resp.Results[i].Code)
+		}
+		if resp.Results == nil {
+			resp.Results = []t.BulkResult{}
+		}
+
+		log.Info(fmt.Sprintf("successfully applied %v to %v tasks", req.Action, len(resp.Results)))
+
+		render.JSON(w, r, resp)
+	}
+}
+
+// bulkStatus maps the return code of a single operation to the status and error of its bulk result.
+func bulkStatus(code int64) (int, string) {
+	switch code {
+	case 1:
+		return http.StatusOK, ""
+	case 0:
+		return http.StatusNotFound, "No such task"
+	case -2:
+		return http.StatusConflict, "Task is blocked by open tasks"
+	case -3:
+		return http.StatusBadRequest, "No such status in the list workflow"
+	case -4:
+		return http.StatusConflict, "Status transition is not allowed"
+	case -6:
+		return http.StatusForbidden, "Access denied"
+	default:
+		return http.StatusInternalServerError, "Internal Server Error"
+	}
+}
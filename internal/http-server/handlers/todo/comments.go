@@ -0,0 +1,323 @@
+package todo
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/render"
+	util "github.com/sabbatD/srest-api/internal/http-server/handleUtil"
+	"github.com/sabbatD/srest-api/internal/lib/api/access"
+	"github.com/sabbatD/srest-api/internal/lib/api/validation"
+	"github.com/sabbatD/srest-api/internal/lib/logger/sl"
+	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+)
+
+// Comments godoc
+// @Summary Retrieve comments of a task
+// @Description Retrieves all comments of a task in the order they were written.
+// @Tags todo
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID of the task"
+// @Success 200 {array} t.Comment "Comments retrieved successfully."
+// @Failure 400 {object} string "Invalid or missing task ID."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 403 {object} string "Access denied."
+// @Failure 404 {object} string "Task not found."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/{id}/comments [get]
+func Comments(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.Comments"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		id := util.GetUrlParam(w, r, log)
+		if id == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		if !authorize(w, r, log, todo, id, t.ViewAccess) {
+			return
+		}
+
+		comments, err := todo.Comments(r.Context(), id)
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		if comments == nil {
+			comments = []t.Comment{}
+		}
+
+		log.Info("successfully retrieved comments")
+
+		render.JSON(w, r, comments)
+	}
+}
+
+// CreateComment godoc
+// @Summary Comment on a task
+// @Description Adds a markdown comment to a task on behalf of the authenticated user.
+// Every user @mentioned by username gets a notification.
+// @Tags todo
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID of the task"
+// @Param CommentData body t.CommentRequest true "Comment body"
+// @Success 201 {object} t.Comment "Comment successfully created."
+// @Failure 400 {object} string "Invalid request body or ID."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 403 {object} string "Access denied."
+// @Failure 404 {object} string "Task not found."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/{id}/comments [post]
+func CreateComment(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.CreateComment"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		userContext, ok := r.Context().Value(access.CxtKey("userContext")).(access.UserContext)
+		if !ok {
+			http.Error(w, "User context not found", http.StatusUnauthorized)
+			return
+		}
+
+		id := util.GetUrlParam(w, r, log)
+		if id == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		if !authorize(w, r, log, todo, id, t.EditAccess) {
+			return
+		}
+
+		req, ok := decodeComment(w, r, log)
+		if !ok {
+			return
+		}
+
+		commentID, err := todo.CreateComment(r.Context(), id, userContext.UserId, req)
+		if err != nil {
+			if commentID == 0 {
+				log.Info(err.Error())
+
+				http.Error(w, "No such task", http.StatusNotFound)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		comment, err := todo.GetComment(r.Context(), int(commentID))
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info("successfully created comment")
+
+		w.WriteHeader(http.StatusCreated)
+		render.JSON(w, r, comment)
+	}
+}
+
+// UpdateComment godoc
+// @Summary Edit a comment
+// @Description Replaces the body of a comment. Only the author or an ADMIN can edit a comment.
+// Users @mentioned for the first time by the edit get a notification.
+// @Tags todo
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID of the task"
+// @Param commentId path int true "ID of the comment"
+// @Param CommentData body t.CommentRequest true "New comment body"
+// @Success 200 {object} t.Comment "Comment successfully updated."
+// @Failure 400 {object} string "Invalid request body or ID."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 403 {object} string "Insufficient permissions."
+// @Failure 404 {object} string "Comment not found."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/{id}/comments/{commentId} [put]
+func UpdateComment(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.UpdateComment"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		commentID, ok := ownComment(w, r, log, todo)
+		if !ok {
+			return
+		}
+
+		req, ok := decodeComment(w, r, log)
+		if !ok {
+			return
+		}
+
+		n, err := todo.UpdateComment(r.Context(), commentID, req)
+		if err != nil {
+			if n == 0 {
+				log.Info(err.Error())
+
+				http.Error(w, "No such comment", http.StatusNotFound)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		comment, err := todo.GetComment(r.Context(), commentID)
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info("successfully updated comment")
+
+		render.JSON(w, r, comment)
+	}
+}
+
+// DeleteComment godoc
+// @Summary Delete a comment
+// @Description Deletes a comment. Only the author or an ADMIN can delete a comment.
+// @Tags todo
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID of the task"
+// @Param commentId path int true "ID of the comment"
+// @Success 200 {object} string "Comment successfully deleted."
+// @Failure 400 {object} string "Invalid or missing ID."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 403 {object} string "Insufficient permissions."
+// @Failure 404 {object} string "Comment not found."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/{id}/comments/{commentId} [delete]
+func DeleteComment(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.DeleteComment"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		commentID, ok := ownComment(w, r, log, todo)
+		if !ok {
+			return
+		}
+
+		n, err := todo.DeleteComment(r.Context(), commentID)
+		if err != nil {
+			if n == 0 {
+				log.Info(err.Error())
+
+				http.Error(w, "No such comment", http.StatusNotFound)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info("successfully deleted comment")
+	}
+}
+
+// ownComment resolves the comment from the URL and checks that the authenticated user
+// is its author or an ADMIN. It writes the error response itself.
+func ownComment(w http.ResponseWriter, r *http.Request, log *slog.Logger, todo TodoHandler) (int, bool) {
+	userContext, ok := r.Context().Value(access.CxtKey("userContext")).(access.UserContext)
+	if !ok {
+		http.Error(w, "User context not found", http.StatusUnauthorized)
+		return 0, false
+	}
+
+	id := util.GetUrlParam(w, r, log)
+	commentID := util.GetNamedUrlParam(r, "commentId")
+	if id == 0 || commentID == 0 {
+		log.Info("missing or wrong id")
+		http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+		return 0, false
+	}
+
+	if !authorize(w, r, log, todo, id, t.ViewAccess) {
+		return 0, false
+	}
+
+	comment, err := todo.GetComment(r.Context(), commentID)
+	if err != nil {
+		if err.Error() == "database.postgres.GetComment: no such comment" {
+			log.Info(err.Error())
+
+			http.Error(w, "No such comment", http.StatusNotFound)
+
+			return 0, false
+		}
+		util.InternalError(w, r, log, err)
+		return 0, false
+	}
+
+	if comment.TodoID != id {
+		log.Info(fmt.Sprintf("comment %v does not belong to task %v", commentID, id))
+		http.Error(w, "No such comment", http.StatusNotFound)
+		return 0, false
+	}
+
+	isAuthor := comment.AuthorID != nil && *comment.AuthorID == userContext.UserId
+	if !isAuthor && !slices.Contains(userContext.Roles, "ADMIN") {
+		http.Error(w, "not enough rights", http.StatusForbidden)
+		return 0, false
+	}
+
+	return commentID, true
+}
+
+func decodeComment(w http.ResponseWriter, r *http.Request, log *slog.Logger) (t.CommentRequest, bool) {
+	var req t.CommentRequest
+	if err := render.DecodeJSON(r.Body, &req); err != nil {
+		log.Error("failed to decode request", sl.Err(err))
+
+		http.Error(w, "failed to deserialize json request", http.StatusBadRequest)
+
+		return req, false
+	}
+
+	log.Info("request body decoded")
+	log.Debug("req: ", slog.Any("request", req))
+
+	validation.InitValidator()
+	if err := validation.ValidateStruct(req); err != nil {
+		log.Debug(fmt.Sprintf("validation failed: %v", err.Error()))
+
+		http.Error(w, fmt.Sprintf("Invalid input: %v", err.Error()), http.StatusBadRequest)
+
+		return req, false
+	}
+
+	log.Info("input validated")
+
+	return req, true
+}
@@ -0,0 +1,242 @@
+package todo
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/render"
+	util "github.com/sabbatD/srest-api/internal/http-server/handleUtil"
+	"github.com/sabbatD/srest-api/internal/lib/api/validation"
+	"github.com/sabbatD/srest-api/internal/lib/logger/sl"
+	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+)
+
+// AddDependency godoc
+// @Summary Mark a task as blocked by another task
+// @Description Links the task from the URL to a blocking task. Links that would create a dependency cycle are rejected.
+// @Tags todo
+// @Accept json
+// @Produce json
+// @Param id path int true "ID of the blocked task"
+// @Param DependencyData body t.DependencyRequest true "ID of the blocking task"
+// @Success 200 {array} t.Todo "Dependency created, returns all tasks blocking the task."
+// @Failure 400 {object} string "Invalid request body or ID."
+// @Failure 403 {object} string "Access denied."
+// @Failure 404 {object} string "Task not found."
+// @Failure 409 {object} string "Dependency creates a cycle."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/{id}/dependencies [post]
+func AddDependency(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.AddDependency"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		id := util.GetUrlParam(w, r, log)
+		if id == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		if !authorize(w, r, log, todo, id, t.EditAccess) {
+			return
+		}
+
+		var req t.DependencyRequest
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.Error("failed to decode request", sl.Err(err))
+
+			http.Error(w, "failed to deserialize json request", http.StatusBadRequest)
+
+			return
+		}
+
+		log.Info("request body decoded")
+		log.Debug("req: ", slog.Any("request", req))
+
+		validation.InitValidator()
+		if err := validation.ValidateStruct(req); err != nil {
+			log.Debug(fmt.Sprintf("validation failed: %v", err.Error()))
+
+			http.Error(w, fmt.Sprintf("Invalid input: %v", err.Error()), http.StatusBadRequest)
+
+			return
+		}
+
+		log.Info("input validated")
+
+		if !authorize(w, r, log, todo, req.BlockedBy, t.ViewAccess) {
+			return
+		}
+
+		n, err := todo.AddDependency(r.Context(), id, req.BlockedBy)
+		if err != nil {
+			if n == 0 {
+				log.Info(err.Error())
+
+				http.Error(w, "No such task", http.StatusNotFound)
+
+				return
+			} else if n == -2 {
+				log.Info(err.Error())
+
+				http.Error(w, "Dependency creates a cycle", http.StatusConflict)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		blockers, err := todo.Dependencies(r.Context(), id, actor(r))
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		if blockers == nil {
+			blockers = []t.Todo{}
+		}
+
+		log.Info("successfully added dependency")
+
+		render.JSON(w, r, blockers)
+	}
+}
+
+// RemoveDependency godoc
+// @Summary Remove a blocking task
+// @Description Unlinks the blocking task from the task in the URL.
+// @Tags todo
+// @Produce json
+// @Param id path int true "ID of the blocked task"
+// @Param blockerId path int true "ID of the blocking task"
+// @Success 200 {object} string "Dependency removed successfully."
+// @Failure 400 {object} string "Invalid or missing task ID."
+// @Failure 403 {object} string "Access denied."
+// @Failure 404 {object} string "Dependency not found."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/{id}/dependencies/{blockerId} [delete]
+func RemoveDependency(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.RemoveDependency"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		id := util.GetUrlParam(w, r, log)
+		blockerID := util.GetNamedUrlParam(r, "blockerId")
+		if id == 0 || blockerID == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		if !authorize(w, r, log, todo, id, t.EditAccess) {
+			return
+		}
+
+		n, err := todo.RemoveDependency(r.Context(), id, blockerID)
+		if err != nil {
+			if n == 0 {
+				log.Info(err.Error())
+
+				http.Error(w, "No such dependency", http.StatusNotFound)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info("successfully removed dependency")
+	}
+}
+
+// Dependencies godoc
+// @Summary Retrieve tasks blocking a task
+// @Description Retrieves every task the task in the URL is blocked by, except the ones the caller can not see.
+// @Tags todo
+// @Produce json
+// @Param id path int true "ID of the blocked task"
+// @Success 200 {array} t.Todo "Blocking tasks retrieved successfully."
+// @Failure 400 {object} string "Invalid or missing task ID."
+// @Failure 403 {object} string "Access denied."
+// @Failure 404 {object} string "Task not found."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/{id}/dependencies [get]
+func Dependencies(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.Dependencies"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		id := util.GetUrlParam(w, r, log)
+		if id == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		if !authorize(w, r, log, todo, id, t.ViewAccess) {
+			return
+		}
+
+		blockers, err := todo.Dependencies(r.Context(), id, actor(r))
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		if blockers == nil {
+			blockers = []t.Todo{}
+		}
+
+		log.Info("successfully retrieved dependencies")
+
+		render.JSON(w, r, blockers)
+	}
+}
+
+// Ready godoc
+// @Summary Retrieve tasks ready to work on
+// @Description Retrieves open tasks the caller can see whose blocking tasks are all done.
+// @Tags todo
+// @Produce json
+// @Success 200 {array} t.Todo "Ready tasks retrieved successfully."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/ready [get]
+func Ready(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.Ready"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		todos, err := todo.Ready(r.Context(), actor(r))
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		if todos == nil {
+			todos = []t.Todo{}
+		}
+
+		log.Info("successfully retrieved ready tasks")
+
+		render.JSON(w, r, todos)
+	}
+}
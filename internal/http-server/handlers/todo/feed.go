@@ -0,0 +1,78 @@
+package todo
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	util "github.com/sabbatD/srest-api/internal/http-server/handleUtil"
+	"github.com/sabbatD/srest-api/internal/lib/api/access"
+	"github.com/sabbatD/srest-api/internal/lib/logger/sl"
+	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+	"github.com/sabbatD/srest-api/internal/lib/todoio"
+)
+
+type FeedHandler interface {
+	FeedUser(ctx context.Context, hash string) (int, error)
+	DueTodos(ctx context.Context, user int) ([]t.Todo, error)
+}
+
+// Feed godoc
+// @Summary Calendar feed of tasks with due dates
+// @Description Serves the own and shared tasks with due dates as an iCalendar subscription for calendar apps. The feed is
+// authenticated by the secret token from the link created with POST /user/feed instead of the Authorization header.
+// By default every task is an event at its due date, type=todo serves VTODO components instead.
+// @Tags todo
+// @Produce text/calendar
+// @Param token path string true "Feed token from the feed link"
+// @Param type query string false "Component type: event (default) or todo"
+// @Success 200 {file} file "iCalendar feed."
+// @Failure 404 {object} string "No such feed."
+// @Failure 500 {object} string "Internal server error."
+// @Router /feed/{token}.ics [get]
+func Feed(log *slog.Logger, feed FeedHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.Feed"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		userID, err := feed.FeedUser(r.Context(), access.HashFeedToken(chi.URLParam(r, "token")))
+		if err != nil {
+			if err.Error() == "database.postgres.FeedUser: no such feed" {
+				log.Info(err.Error())
+
+				http.Error(w, "No such feed", http.StatusNotFound)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		component := todoio.VEVENT
+		if r.URL.Query().Get("type") == "todo" {
+			component = todoio.VTODO
+		}
+
+		todos, err := feed.DueTodos(r.Context(), userID)
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+
+		if err := todoio.WriteFeed(w, todos, time.Now(), "sAPI tasks", component); err != nil {
+			log.Error("failed to write feed", sl.Err(err))
+			return
+		}
+
+		log.Info(fmt.Sprintf("successfully served the feed of user %v with %v tasks", userID, len(todos)))
+	}
+}
@@ -0,0 +1,144 @@
+package todo
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/render"
+	util "github.com/sabbatD/srest-api/internal/http-server/handleUtil"
+	"github.com/sabbatD/srest-api/internal/lib/api/access"
+	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+)
+
+// History godoc
+// @Summary Retrieve the history of a task
+// @Description Retrieves every version of a task, oldest first, with the changed fields and the user who made the change.
+// Changes made without a token have no actor.
+// @Tags todo
+// @Produce json
+// @Param id path int true "ID of the task"
+// @Success 200 {array} t.TodoEvent "History retrieved successfully."
+// @Failure 400 {object} string "Invalid or missing task ID."
+// @Failure 403 {object} string "Access denied."
+// @Failure 404 {object} string "Task not found."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/{id}/history [get]
+func History(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.History"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		id := util.GetUrlParam(w, r, log)
+		if id == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		if !authorize(w, r, log, todo, id, t.ViewAccess) {
+			return
+		}
+
+		events, err := todo.History(r.Context(), id)
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		if events == nil {
+			events = []t.TodoEvent{}
+		}
+
+		log.Info("successfully retrieved history")
+
+		render.JSON(w, r, events)
+	}
+}
+
+// Revert godoc
+// @Summary Revert a task to an earlier version
+// @Description Restores the state a task had after the given version of its history. The revert is recorded
+// as a new version, so it can be undone the same way. A trashed task is restored unless it was trashed at that version.
+// Going back to another list needs the same access as a move, a task whose list was deleted since stays in its current list.
+// @Tags todo
+// @Produce json
+// @Param id path int true "ID of the task"
+// @Param version query int true "Version to revert to"
+// @Success 200 {object} t.Todo "Task reverted successfully, returns the task."
+// @Failure 400 {object} string "Invalid or missing task ID or version."
+// @Failure 403 {object} string "Access denied to the task or to the list of that version."
+// @Failure 404 {object} string "Task or version not found."
+// @Failure 409 {object} string "The task can not be completed while blocked by open tasks."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/{id}/revert [post]
+func Revert(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.Revert"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		id := util.GetUrlParam(w, r, log)
+		version, err := strconv.Atoi(r.URL.Query().Get("version"))
+		if id == 0 || err != nil || version < 1 {
+			log.Info("missing or wrong id or version")
+			http.Error(w, "Missing or wrong id or version", http.StatusBadRequest)
+			return
+		}
+
+		if !authorize(w, r, log, todo, id, t.EditAccess) {
+			return
+		}
+
+		n, err := todo.Revert(r.Context(), id, version, actor(r))
+		if err != nil {
+			switch n {
+			case 0:
+				log.Info(err.Error())
+				http.Error(w, "No such task", http.StatusNotFound)
+			case -2:
+				log.Info(err.Error())
+				http.Error(w, "No such version", http.StatusNotFound)
+			case -3:
+				log.Info(err.Error())
+				http.Error(w, "Task is blocked by open tasks", http.StatusConflict)
+			case -6:
+				log.Info(err.Error())
+				http.Error(w, "Access denied to the list of that version", http.StatusForbidden)
+			default:
+				util.InternalError(w, r, log, err)
+			}
+			return
+		}
+
+		task, err := todo.GetTodo(r.Context(), id)
+		if err != nil {
+			if err.Error() == "database.postgres.GetTodo: no such task" {
+				log.Info("task reverted to the trash")
+
+				render.JSON(w, r, "Task reverted to the trash")
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info("successfully reverted task")
+
+		render.JSON(w, r, task)
+	}
+}
+
+// actor returns the ID of the authenticated user, 0 for anonymous requests.
+func actor(r *http.Request) int {
+	userContext, _ := r.Context().Value(access.CxtKey("userContext")).(access.UserContext)
+	return userContext.UserId
+}
@@ -0,0 +1,244 @@
+package todo
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/render"
+	util "github.com/sabbatD/srest-api/internal/http-server/handleUtil"
+	"github.com/sabbatD/srest-api/internal/lib/api/validation"
+	"github.com/sabbatD/srest-api/internal/lib/logger/sl"
+	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+	"github.com/sabbatD/srest-api/internal/lib/workflow"
+)
+
+// CreateList godoc
+// @Summary Create a new list
+// @Description Creates a new list of tasks. A list created by an authenticated user is owned by them,
+// anonymous lists stay public.
+// @Tags todo
+// @Accept json
+// @Produce json
+// @Param ListData body t.ListRequest true "List data"
+// @Success 200 {object} t.List "List successfully created."
+// @Failure 400 {object} string "Invalid request body or missing/incorrect fields."
+// @Failure 500 {object} string "Internal server error."
+// @Router /lists [post]
+func CreateList(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.CreateList"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		var req t.ListRequest
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.Error("failed to decode request", sl.Err(err))
+
+			http.Error(w, "failed to deserialize json request", http.StatusBadRequest)
+
+			return
+		}
+
+		log.Info("request body decoded")
+		log.Debug("req: ", slog.Any("request", req))
+
+		validation.InitValidator()
+		if err := validation.ValidateStruct(req); err != nil {
+			log.Debug(fmt.Sprintf("validation failed: %v", err.Error()))
+
+			http.Error(w, fmt.Sprintf("Invalid input: %v", err.Error()), http.StatusBadRequest)
+
+			return
+		}
+
+		log.Info("input validated")
+
+		list, err := todo.CreateList(r.Context(), req, actor(r))
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info("successfully created list")
+
+		render.JSON(w, r, list)
+	}
+}
+
+// Lists godoc
+// @Summary Retrieve all lists
+// @Description Retrieves the lists of tasks the caller can see: own, shared and public ones.
+// @Tags todo
+// @Produce json
+// @Success 200 {array} t.List "Lists retrieved successfully."
+// @Failure 500 {object} string "Internal server error."
+// @Router /lists [get]
+func Lists(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.Lists"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		lists, err := todo.Lists(r.Context(), actor(r))
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		if lists == nil {
+			lists = []t.List{}
+		}
+
+		log.Info("successfully retrieved lists")
+
+		render.JSON(w, r, lists)
+	}
+}
+
+// Workflow godoc
+// @Summary Retrieve a list workflow
+// @Description Retrieves statuses and allowed transitions of a list. Lists without their own workflow use the default todo/done one.
+// @Tags todo
+// @Produce json
+// @Param id path int true "ID of the list"
+// @Success 200 {object} workflow.Workflow "Workflow retrieved successfully."
+// @Failure 400 {object} string "Invalid or missing list ID."
+// @Failure 403 {object} string "Access denied."
+// @Failure 404 {object} string "List not found."
+// @Failure 500 {object} string "Internal server error."
+// @Router /lists/{id}/workflow [get]
+func Workflow(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.Workflow"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		id := util.GetUrlParam(w, r, log)
+		if id == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		if !authorizeList(w, r, log, todo, id, t.ViewAccess) {
+			return
+		}
+
+		wf, err := todo.Workflow(r.Context(), id)
+		if err != nil {
+			if err.Error() == "database.postgres.Workflow: no such list" {
+				log.Info(err.Error())
+
+				http.Error(w, "No such list", http.StatusNotFound)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info("successfully retrieved workflow")
+
+		render.JSON(w, r, wf)
+	}
+}
+
+// SetWorkflow godoc
+// @Summary Replace a list workflow
+// @Description Replaces statuses and allowed transitions of a list. Statuses are listed in board order,
+// a workflow needs at least one open and one terminal status. Without transitions any move is allowed.
+// Tasks in a removed status fall back to the first open or terminal status.
+// @Tags todo
+// @Accept json
+// @Produce json
+// @Param id path int true "ID of the list"
+// @Param WorkflowData body workflow.Workflow true "New workflow"
+// @Success 200 {object} workflow.Workflow "Workflow replaced successfully."
+// @Failure 400 {object} string "Invalid request body or workflow."
+// @Failure 403 {object} string "Access denied."
+// @Failure 404 {object} string "List not found."
+// @Failure 500 {object} string "Internal server error."
+// @Router /lists/{id}/workflow [put]
+func SetWorkflow(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.SetWorkflow"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		id := util.GetUrlParam(w, r, log)
+		if id == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		if !authorizeList(w, r, log, todo, id, t.EditAccess) {
+			return
+		}
+
+		var req workflow.Workflow
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.Error("failed to decode request", sl.Err(err))
+
+			http.Error(w, "failed to deserialize json request", http.StatusBadRequest)
+
+			return
+		}
+
+		log.Info("request body decoded")
+		log.Debug("req: ", slog.Any("request", req))
+
+		validation.InitValidator()
+		if err := validation.ValidateStruct(req); err != nil {
+			log.Debug(fmt.Sprintf("validation failed: %v", err.Error()))
+
+			http.Error(w, fmt.Sprintf("Invalid input: %v", err.Error()), http.StatusBadRequest)
+
+			return
+		}
+
+		if err := req.Check(); err != nil {
+			log.Debug(fmt.Sprintf("validation failed: %v", err.Error()))
+
+			http.Error(w, fmt.Sprintf("Invalid input: %v", err.Error()), http.StatusBadRequest)
+
+			return
+		}
+
+		if req.Transitions == nil {
+			req.Transitions = []workflow.Transition{}
+		}
+
+		log.Info("input validated")
+
+		n, err := todo.SetWorkflow(r.Context(), id, req, actor(r))
+		if err != nil {
+			if n == 0 {
+				log.Info(err.Error())
+
+				http.Error(w, "No such list", http.StatusNotFound)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info("successfully replaced workflow")
+
+		render.JSON(w, r, req)
+	}
+}
@@ -0,0 +1,141 @@
+package todo
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/render"
+	util "github.com/sabbatD/srest-api/internal/http-server/handleUtil"
+	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+)
+
+// Patch godoc
+// @Summary Partially update a task
+// @Description Applies a JSON Merge Patch (application/merge-patch+json) or a JSON Patch (application/json-patch+json)
+// to the task fields title, isDone, status, due, priority and tags. Unlike PUT a patch can clear the due date.
+// The result is validated like a PUT request and saved only if the task was not changed in the meantime.
+// @Tags todo
+// @Accept json
+// @Produce json
+// @Param id path int true "ID of the task to update"
+// @Param If-Match header string false "ETag of the task the patch is based on"
+// @Param Patch body object true "Merge patch object or JSON Patch operations"
+// @Success 200 {object}  t.Todo "Task updated successfully, returns the updated task."
+// @Failure 400 {object} string "Invalid patch, patched task or ID."
+// @Failure 403 {object} string "Access denied."
+// @Failure 404 {object} string "Task not found."
+// @Failure 409 {object} string "A test operation failed, the task is blocked or the status transition is not allowed."
+// @Failure 412 {object} string "Task was changed since the ETag in If-Match."
+// @Failure 415 {object} string "Unsupported patch content type."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/{id} [patch]
+func Patch(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.Patch"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		id := util.GetUrlParam(w, r, log)
+		if id == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		if !authorize(w, r, log, todo, id, t.EditAccess) {
+			return
+		}
+
+		version, ok := util.IfMatch(r)
+		if !ok {
+			log.Info("invalid If-Match header")
+			http.Error(w, "Task was changed", http.StatusPreconditionFailed)
+			return
+		}
+
+		task, err := todo.GetTodo(r.Context(), id)
+		if err != nil {
+			if err.Error() == "database.postgres.GetTodo: no such task" {
+				log.Info(err.Error())
+
+				http.Error(w, "No such task", http.StatusNotFound)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		if version != 0 && version != task.Version {
+			log.Info(fmt.Sprintf("task %v has version %v, not %v", id, task.Version, version))
+			http.Error(w, "Task was changed", http.StatusPreconditionFailed)
+			return
+		}
+
+		current := t.TodoPatch{Title: task.Title, IsDone: task.IsDone, Status: task.Status, Due: task.Due, Priority: task.Priority, Tags: task.Tags}
+
+		patched, ok := util.ApplyPatch(w, r, log, current)
+		if !ok {
+			return
+		}
+
+		// The version the patch was applied to is checked again when saving,
+		// so a concurrent change can not be overwritten.
+		n, err := todo.Update(r.Context(), id, patchRequest(current, patched), task.Version, actor(r))
+		if err != nil {
+			updateError(w, r, log, n, err)
+			return
+		}
+
+		task, err = todo.GetTodo(r.Context(), id)
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info("successfully patched task")
+
+		w.Header().Set("ETag", util.ETag(task.Version))
+		render.JSON(w, r, task)
+	}
+}
+
+// patchRequest turns the difference of two patch documents into an update request.
+// A status change wins over isDone, as in a PUT request.
+func patchRequest(current, patched t.TodoPatch) t.TodoRequest {
+	var req t.TodoRequest
+
+	if patched.Title != current.Title {
+		req.Title = patched.Title
+	}
+
+	if patched.Status != current.Status {
+		req.Status = &patched.Status
+	} else if patched.IsDone != current.IsDone {
+		req.IsDone = &patched.IsDone
+	}
+
+	if patched.Priority != current.Priority {
+		req.Priority = &patched.Priority
+	}
+
+	// Empty tags are sent as an empty list, nil would leave them unchanged.
+	if !slices.Equal(patched.Tags, current.Tags) {
+		req.Tags = append([]string{}, patched.Tags...)
+	}
+
+	switch {
+	case patched.Due == nil && current.Due != nil:
+		cleared := ""
+		req.Due = &cleared
+	case patched.Due != nil && (current.Due == nil || *patched.Due != *current.Due):
+		req.Due = patched.Due
+	}
+
+	return req
+}
@@ -0,0 +1,410 @@
+package todo
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/render"
+	util "github.com/sabbatD/srest-api/internal/http-server/handleUtil"
+	"github.com/sabbatD/srest-api/internal/lib/api/access"
+	"github.com/sabbatD/srest-api/internal/lib/api/validation"
+	"github.com/sabbatD/srest-api/internal/lib/logger/sl"
+	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+)
+
+// authorize checks that the caller has at least the access level need to the task id.
+// It writes the error response itself.
+func authorize(w http.ResponseWriter, r *http.Request, log *slog.Logger, todo TodoHandler, id, need int) bool {
+	role, err := todo.TodoRole(r.Context(), id, actor(r))
+	if err != nil {
+		util.InternalError(w, r, log, err)
+		return false
+	}
+
+	return util.Authorize(w, r, log, role, need, "No such task")
+}
+
+// authorizeList is authorize for the list id.
+func authorizeList(w http.ResponseWriter, r *http.Request, log *slog.Logger, todo TodoHandler, id, need int) bool {
+	role, err := todo.ListRole(r.Context(), id, actor(r))
+	if err != nil {
+		util.InternalError(w, r, log, err)
+		return false
+	}
+
+	return util.Authorize(w, r, log, role, need, "No such list")
+}
+
+// Shares godoc
+// @Summary Retrieve the shares of a task
+// @Description Retrieves the users the task is shared with, their roles and whether they accepted. Only the owner can see them.
+// @Tags share
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID of the task"
+// @Success 200 {array} t.Share "Shares retrieved successfully."
+// @Failure 400 {object} string "Invalid or missing task ID."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 403 {object} string "Access denied."
+// @Failure 404 {object} string "Task not found."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/{id}/shares [get]
+func Shares(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return listShares(log, "http-server.hanlders.todo.Shares", authorize, todo.TodoShares, todo)
+}
+
+// Share godoc
+// @Summary Share a task
+// @Description Offers a user the viewer or editor role on the task. The share works once the user accepts it.
+// Sharing with the same user again changes the role, a declined share is offered again. Only the owner can share.
+// @Tags share
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID of the task"
+// @Param ShareData body t.ShareRequest true "User and role"
+// @Success 200 {object} t.Share "Task shared successfully."
+// @Failure 400 {object} string "Invalid request body or ID, or sharing with the owner."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 403 {object} string "Access denied."
+// @Failure 404 {object} string "Task or user not found."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/{id}/shares [post]
+func Share(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return share(log, "http-server.hanlders.todo.Share", authorize, todo.ShareTodo, todo)
+}
+
+// Unshare godoc
+// @Summary Stop sharing a task
+// @Description Removes the share of a task with a user. The owner can remove any share, a user can leave a share of their own.
+// @Tags share
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID of the task"
+// @Param userId path int true "ID of the user the task is shared with"
+// @Success 200 {object} string "Share removed successfully."
+// @Failure 400 {object} string "Invalid or missing ID."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 403 {object} string "Access denied."
+// @Failure 404 {object} string "Task or share not found."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/{id}/shares/{userId} [delete]
+func Unshare(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return unshare(log, "http-server.hanlders.todo.Unshare", authorize, todo.UnshareTodo, todo)
+}
+
+// ListShares godoc
+// @Summary Retrieve the shares of a list
+// @Description Retrieves the users the list is shared with, their roles and whether they accepted. Only the owner can see them.
+// @Tags share
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID of the list"
+// @Success 200 {array} t.Share "Shares retrieved successfully."
+// @Failure 400 {object} string "Invalid or missing list ID."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 403 {object} string "Access denied."
+// @Failure 404 {object} string "List not found."
+// @Failure 500 {object} string "Internal server error."
+// @Router /lists/{id}/shares [get]
+func ListShares(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return listShares(log, "http-server.hanlders.todo.ListShares", authorizeList, todo.ListShares, todo)
+}
+
+// ShareList godoc
+// @Summary Share a list
+// @Description Offers a user the viewer or editor role on the list and all of its tasks. The share works once the user accepts it.
+// Sharing with the same user again changes the role, a declined share is offered again. Only the owner can share.
+// @Tags share
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID of the list"
+// @Param ShareData body t.ShareRequest true "User and role"
+// @Success 200 {object} t.Share "List shared successfully."
+// @Failure 400 {object} string "Invalid request body or ID, or sharing with the owner."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 403 {object} string "Access denied."
+// @Failure 404 {object} string "List or user not found."
+// @Failure 500 {object} string "Internal server error."
+// @Router /lists/{id}/shares [post]
+func ShareList(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return share(log, "http-server.hanlders.todo.ShareList", authorizeList, todo.ShareList, todo)
+}
+
+// UnshareList godoc
+// @Summary Stop sharing a list
+// @Description Removes the share of a list with a user. The owner can remove any share, a user can leave a share of their own.
+// @Tags share
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID of the list"
+// @Param userId path int true "ID of the user the list is shared with"
+// @Success 200 {object} string "Share removed successfully."
+// @Failure 400 {object} string "Invalid or missing ID."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 403 {object} string "Access denied."
+// @Failure 404 {object} string "List or share not found."
+// @Failure 500 {object} string "Internal server error."
+// @Router /lists/{id}/shares/{userId} [delete]
+func UnshareList(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return unshare(log, "http-server.hanlders.todo.UnshareList", authorizeList, todo.UnshareList, todo)
+}
+
+type authorizer func(w http.ResponseWriter, r *http.Request, log *slog.Logger, todo TodoHandler, id, need int) bool
+
+func listShares(log *slog.Logger, op string, auth authorizer, get func(ctx context.Context, id int) ([]t.Share, error), todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		id := util.GetUrlParam(w, r, log)
+		if id == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		if !auth(w, r, log, todo, id, t.OwnerAccess) {
+			return
+		}
+
+		shares, err := get(r.Context(), id)
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		if shares == nil {
+			shares = []t.Share{}
+		}
+
+		log.Info("successfully retrieved shares")
+
+		render.JSON(w, r, shares)
+	}
+}
+
+func share(log *slog.Logger, op string, auth authorizer, create func(ctx context.Context, id int, req t.ShareRequest, by int) (t.Share, int64, error), todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		id := util.GetUrlParam(w, r, log)
+		if id == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		if !auth(w, r, log, todo, id, t.OwnerAccess) {
+			return
+		}
+
+		var req t.ShareRequest
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.Error("failed to decode request", sl.Err(err))
+
+			http.Error(w, "failed to deserialize json request", http.StatusBadRequest)
+
+			return
+		}
+
+		log.Info("request body decoded")
+		log.Debug("req: ", slog.Any("request", req))
+
+		validation.InitValidator()
+		if err := validation.ValidateStruct(req); err != nil {
+			log.Debug(fmt.Sprintf("validation failed: %v", err.Error()))
+
+			http.Error(w, fmt.Sprintf("Invalid input: %v", err.Error()), http.StatusBadRequest)
+
+			return
+		}
+
+		log.Info("input validated")
+
+		sh, n, err := create(r.Context(), id, req, actor(r))
+		if err != nil {
+			switch n {
+			case 0:
+				log.Info(err.Error())
+				http.Error(w, "No such user", http.StatusNotFound)
+			case -2:
+				log.Info(err.Error())
+				http.Error(w, "Can not share with the owner", http.StatusBadRequest)
+			default:
+				util.InternalError(w, r, log, err)
+			}
+			return
+		}
+
+		log.Info(fmt.Sprintf("successfully shared with user %v as %v", req.UserID, req.Role))
+
+		render.JSON(w, r, sh)
+	}
+}
+
+func unshare(log *slog.Logger, op string, auth authorizer, remove func(ctx context.Context, id, user int) (int64, error), todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		id := util.GetUrlParam(w, r, log)
+		userID := util.GetNamedUrlParam(r, "userId")
+		if id == 0 || userID == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		// Leaving a share does not need the owner.
+		if userID != actor(r) && !auth(w, r, log, todo, id, t.OwnerAccess) {
+			return
+		}
+
+		n, err := remove(r.Context(), id, userID)
+		if err != nil {
+			if n == 0 {
+				log.Info(err.Error())
+
+				http.Error(w, "No such share", http.StatusNotFound)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info(fmt.Sprintf("successfully removed the share of user %v", userID))
+	}
+}
+
+// IncomingShares godoc
+// @Summary Retrieve shares offered to the user
+// @Description Retrieves the tasks and lists shared with the authenticated user, newest first.
+// @Tags share
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "Filter by status: pending, accepted or declined"
+// @Success 200 {array} t.Share "Shares retrieved successfully."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 500 {object} string "Internal server error."
+// @Router /user/shares [get]
+func IncomingShares(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.IncomingShares"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		userContext, ok := r.Context().Value(access.CxtKey("userContext")).(access.UserContext)
+		if !ok {
+			http.Error(w, "User context not found", http.StatusUnauthorized)
+			return
+		}
+
+		status := r.URL.Query().Get("status")
+		switch status {
+		case "", "pending", "accepted", "declined":
+		default:
+			status = ""
+		}
+
+		shares, err := todo.IncomingShares(r.Context(), userContext.UserId, status)
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		if shares == nil {
+			shares = []t.Share{}
+		}
+
+		log.Info("successfully retrieved incoming shares")
+
+		render.JSON(w, r, shares)
+	}
+}
+
+// AcceptShare godoc
+// @Summary Accept a share
+// @Description Accepts a task or list shared with the authenticated user, it becomes visible in scope=shared.
+// @Tags share
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID of the share"
+// @Success 200 {object} string "Share accepted."
+// @Failure 400 {object} string "Invalid or missing share ID."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 404 {object} string "Share not found."
+// @Failure 500 {object} string "Internal server error."
+// @Router /user/shares/{id}/accept [post]
+func AcceptShare(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return respondShare(log, "http-server.hanlders.todo.AcceptShare", todo, true)
+}
+
+// DeclineShare godoc
+// @Summary Decline a share
+// @Description Declines a task or list shared with the authenticated user, an accepted share stops working.
+// A declined share can still be accepted later.
+// @Tags share
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID of the share"
+// @Success 200 {object} string "Share declined."
+// @Failure 400 {object} string "Invalid or missing share ID."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 404 {object} string "Share not found."
+// @Failure 500 {object} string "Internal server error."
+// @Router /user/shares/{id}/decline [post]
+func DeclineShare(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return respondShare(log, "http-server.hanlders.todo.DeclineShare", todo, false)
+}
+
+func respondShare(log *slog.Logger, op string, todo TodoHandler, accept bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		userContext, ok := r.Context().Value(access.CxtKey("userContext")).(access.UserContext)
+		if !ok {
+			http.Error(w, "User context not found", http.StatusUnauthorized)
+			return
+		}
+
+		id := util.GetUrlParam(w, r, log)
+		if id == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		n, err := todo.RespondShare(r.Context(), id, userContext.UserId, accept)
+		if err != nil {
+			if n == 0 {
+				log.Info(err.Error())
+
+				http.Error(w, "No such share", http.StatusNotFound)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info(fmt.Sprintf("successfully responded to share %v, accepted: %v", id, accept))
+	}
+}
@@ -0,0 +1,253 @@
+package todo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	util "github.com/sabbatD/srest-api/internal/http-server/handleUtil"
+	"github.com/sabbatD/srest-api/internal/lib/api/access"
+	"github.com/sabbatD/srest-api/internal/lib/logger/sl"
+	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+	"github.com/sabbatD/srest-api/internal/stream"
+	"golang.org/x/net/websocket"
+)
+
+// streamBatch bounds a single read of events, a stream catching up reads several batches.
+const streamBatch = 100
+
+type StreamHandler interface {
+	StreamEvents(ctx context.Context, user int, after int64, limit int) (events []t.StreamEvent, next int64, err error)
+	LastEventID(ctx context.Context) (int64, error)
+}
+
+// Stream godoc
+// @Summary Stream task changes over Server-Sent Events
+// @Description Pushes an event for every created, updated, moved, deleted, restored or reverted task the user can see.
+// The SSE event name is the type of the change, the data is the t.StreamEvent with the task after the change.
+// A reconnecting EventSource sends the Last-Event-ID header and gets the events it missed, without it the stream
+// starts with the next change. EventSource can not send headers, so the token can be passed as access_token.
+// @Tags todo
+// @Produce text/event-stream
+// @Security BearerAuth
+// @Param access_token query string false "Access token, instead of the Authorization header"
+// @Param Last-Event-ID header string false "ID of the last event received"
+// @Param lastEventId query string false "ID of the last event received, instead of the header"
+// @Success 200 {object} t.StreamEvent "Stream of events."
+// @Failure 400 {object} string "Invalid last event ID."
+// @Failure 401 {object} string "Unauthorized access. Token missing or invalid."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/stream [get]
+func Stream(log *slog.Logger, events StreamHandler, broker stream.Broker, heartbeat time.Duration, closing <-chan struct{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.Stream"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		userContext, ok := r.Context().Value(access.CxtKey("userContext")).(access.UserContext)
+		if !ok {
+			http.Error(w, "User context not found", http.StatusUnauthorized)
+			return
+		}
+
+		header := r.Header.Get("Last-Event-ID")
+		if header == "" {
+			header = r.URL.Query().Get("lastEventId")
+		}
+
+		last, ok := lastEventID(w, r, log, events, header)
+		if !ok {
+			return
+		}
+
+		// The stream outlives the timeouts of the server.
+		rc := http.NewResponseController(w)
+		if err := rc.SetReadDeadline(time.Time{}); err != nil {
+			log.Warn("failed to clear read deadline", sl.Err(err))
+		}
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+			log.Warn("failed to clear write deadline", sl.Err(err))
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		if _, err := fmt.Fprintf(w, "retry: %d\n\n", 3000); err != nil {
+			return
+		}
+
+		log.Info(fmt.Sprintf("streaming events of user %v after %v", userContext.UserId, last))
+
+		send := func(e t.StreamEvent) error {
+			data, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+			return err
+		}
+		ping := func() error {
+			_, err := io.WriteString(w, ": ping\n\n")
+			return err
+		}
+
+		if err := follow(r.Context(), closing, events, broker, userContext.UserId, last, heartbeat, send, ping, rc.Flush); err != nil {
+			log.Error("stream stopped", sl.Err(err))
+			return
+		}
+
+		log.Info("stream closed")
+	}
+}
+
+// StreamWS godoc
+// @Summary Stream task changes over WebSocket
+// @Description Sends the same events as the SSE stream as JSON text messages, {"type": "ping"} messages keep the
+// connection alive. Browsers can not send headers with WebSocket, so the token is passed as access_token and
+// the last event received as lastEventId. Messages from the client are ignored.
+// @Tags todo
+// @Security BearerAuth
+// @Param access_token query string false "Access token, instead of the Authorization header"
+// @Param lastEventId query string false "ID of the last event received"
+// @Success 101 {object} t.StreamEvent "Switching to WebSocket."
+// @Failure 400 {object} string "Invalid last event ID or not a WebSocket handshake."
+// @Failure 401 {object} string "Unauthorized access. Token missing or invalid."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/stream/ws [get]
+func StreamWS(log *slog.Logger, events StreamHandler, broker stream.Broker, heartbeat time.Duration, closing <-chan struct{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.StreamWS"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		userContext, ok := r.Context().Value(access.CxtKey("userContext")).(access.UserContext)
+		if !ok {
+			http.Error(w, "User context not found", http.StatusUnauthorized)
+			return
+		}
+
+		last, ok := lastEventID(w, r, log, events, r.URL.Query().Get("lastEventId"))
+		if !ok {
+			return
+		}
+
+		// websocket.Server does not check Origin, CORSMiddleware governs the origins like for the rest of the API.
+		websocket.Server{Handler: func(ws *websocket.Conn) {
+			// The hijacked connection keeps the deadlines of the server.
+			if err := ws.SetDeadline(time.Time{}); err != nil {
+				log.Warn("failed to clear deadline", sl.Err(err))
+			}
+
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+
+			// Reading notices the client going away.
+			go func() {
+				io.Copy(io.Discard, ws)
+				cancel()
+			}()
+
+			log.Info(fmt.Sprintf("streaming events of user %v after %v over websocket", userContext.UserId, last))
+
+			send := func(e t.StreamEvent) error {
+				return websocket.JSON.Send(ws, e)
+			}
+			ping := func() error {
+				return websocket.JSON.Send(ws, map[string]string{"type": "ping"})
+			}
+			flush := func() error { return nil }
+
+			if err := follow(ctx, closing, events, broker, userContext.UserId, last, heartbeat, send, ping, flush); err != nil && ctx.Err() == nil {
+				log.Error("stream stopped", sl.Err(err))
+				return
+			}
+
+			log.Info("stream closed")
+		}}.ServeHTTP(w, r)
+	}
+}
+
+// lastEventID parses the ID a stream resumes after. Without one the stream starts after the latest event.
+// It writes the error response itself.
+func lastEventID(w http.ResponseWriter, r *http.Request, log *slog.Logger, events StreamHandler, s string) (int64, bool) {
+	if s == "" {
+		last, err := events.LastEventID(r.Context())
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return 0, false
+		}
+		return last, true
+	}
+
+	last, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || last < 0 {
+		log.Info(fmt.Sprintf("invalid last event id: %q", s))
+
+		http.Error(w, "Invalid last event ID", http.StatusBadRequest)
+
+		return 0, false
+	}
+
+	return last, true
+}
+
+// follow sends the events of the user after last until ctx is done, closing is closed or sending fails. It reads
+// new events when the broker wakes it up and pings every heartbeat, which also reads events a missed wake-up left behind.
+func follow(ctx context.Context, closing <-chan struct{}, events StreamHandler, broker stream.Broker, user int, last int64, heartbeat time.Duration,
+	send func(t.StreamEvent) error, ping func() error, flush func() error) error {
+	wake, unsubscribe := broker.Subscribe()
+	defer unsubscribe()
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	for {
+		for {
+			batch, next, err := events.StreamEvents(ctx, user, last, streamBatch)
+			if err != nil {
+				return err
+			}
+
+			for _, e := range batch {
+				if err := send(e); err != nil {
+					return err
+				}
+			}
+
+			// The cursor passes the events the user can not see as well, so they are not scanned again.
+			if next == last {
+				break
+			}
+			last = next
+		}
+
+		if err := flush(); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-closing:
+			return nil
+		case <-wake:
+		case <-ticker.C:
+			if err := ping(); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,579 @@
+package todo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/render"
+	util "github.com/sabbatD/srest-api/internal/http-server/handleUtil"
+	"github.com/sabbatD/srest-api/internal/lib/api/access"
+	"github.com/sabbatD/srest-api/internal/lib/api/validation"
+	"github.com/sabbatD/srest-api/internal/lib/logger/sl"
+	"github.com/sabbatD/srest-api/internal/lib/timetrack"
+	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+)
+
+// StartTimer godoc
+// @Summary Start a timer on a task
+// @Description Starts tracking time on the task. A user runs one timer at a time, the timer running on another task is stopped.
+// @Tags time
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID of the task"
+// @Param TimerData body t.TimerRequest false "Note of the time entry"
+// @Success 200 {object} t.TimeEntry "Timer started, returns the running entry."
+// @Failure 400 {object} string "Invalid request body or ID."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 403 {object} string "Access denied."
+// @Failure 404 {object} string "Task not found."
+// @Failure 409 {object} string "Timer of the task is running already."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/{id}/timer [post]
+func StartTimer(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.StartTimer"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		userContext, ok := r.Context().Value(access.CxtKey("userContext")).(access.UserContext)
+		if !ok {
+			http.Error(w, "User context not found", http.StatusUnauthorized)
+			return
+		}
+
+		id := util.GetUrlParam(w, r, log)
+		if id == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		if !authorize(w, r, log, todo, id, t.EditAccess) {
+			return
+		}
+
+		// The body is optional, a timer can be started without a note.
+		var req t.TimerRequest
+		if err := render.DecodeJSON(r.Body, &req); err != nil && !errors.Is(err, io.EOF) {
+			log.Error("failed to decode request", sl.Err(err))
+
+			http.Error(w, "failed to deserialize json request", http.StatusBadRequest)
+
+			return
+		}
+
+		validation.InitValidator()
+		if err := validation.ValidateStruct(req); err != nil {
+			log.Debug(fmt.Sprintf("validation failed: %v", err.Error()))
+
+			http.Error(w, fmt.Sprintf("Invalid input: %v", err.Error()), http.StatusBadRequest)
+
+			return
+		}
+
+		entry, n, err := todo.StartTimer(r.Context(), id, userContext.UserId, req.Note)
+		if err != nil {
+			switch n {
+			case 0:
+				log.Info(err.Error())
+				http.Error(w, "No such task", http.StatusNotFound)
+			case -2:
+				log.Info(err.Error())
+				http.Error(w, "Timer is running already", http.StatusConflict)
+			default:
+				util.InternalError(w, r, log, err)
+			}
+			return
+		}
+
+		log.Info(fmt.Sprintf("successfully started timer on task %v", id))
+
+		render.JSON(w, r, entry)
+	}
+}
+
+// StopTimer godoc
+// @Summary Stop the timer on a task
+// @Description Stops the timer the authenticated user has running on the task.
+// @Tags time
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID of the task"
+// @Success 200 {object} t.TimeEntry "Timer stopped, returns the entry."
+// @Failure 400 {object} string "Invalid or missing task ID."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 404 {object} string "No timer is running on the task."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/{id}/timer [delete]
+func StopTimer(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.StopTimer"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		userContext, ok := r.Context().Value(access.CxtKey("userContext")).(access.UserContext)
+		if !ok {
+			http.Error(w, "User context not found", http.StatusUnauthorized)
+			return
+		}
+
+		id := util.GetUrlParam(w, r, log)
+		if id == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		// A timer can always be stopped by its user, even after the task stopped being shared.
+		entry, n, err := todo.StopTimer(r.Context(), id, userContext.UserId)
+		if err != nil {
+			if n == 0 {
+				log.Info(err.Error())
+
+				http.Error(w, "No running timer", http.StatusNotFound)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info(fmt.Sprintf("successfully stopped timer on task %v", id))
+
+		render.JSON(w, r, entry)
+	}
+}
+
+// ActiveTimer godoc
+// @Summary Retrieve the running timer
+// @Description Retrieves the timer the authenticated user has running.
+// @Tags time
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} t.TimeEntry "Running timer."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 404 {object} string "No timer is running."
+// @Failure 500 {object} string "Internal server error."
+// @Router /user/timer [get]
+func ActiveTimer(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.ActiveTimer"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		userContext, ok := r.Context().Value(access.CxtKey("userContext")).(access.UserContext)
+		if !ok {
+			http.Error(w, "User context not found", http.StatusUnauthorized)
+			return
+		}
+
+		entry, err := todo.ActiveTimer(r.Context(), userContext.UserId)
+		if err != nil {
+			if err.Error() == "database.postgres.ActiveTimer: no running timer" {
+				log.Info(err.Error())
+
+				http.Error(w, "No running timer", http.StatusNotFound)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info("successfully retrieved running timer")
+
+		render.JSON(w, r, entry)
+	}
+}
+
+// AddTime godoc
+// @Summary Add tracked time to a task
+// @Description Records time tracked without a timer. The entry has to end after it starts and can not end in the future.
+// @Tags time
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID of the task"
+// @Param TimeData body t.TimeEntryRequest true "Start and end of the tracked time in RFC 3339"
+// @Success 201 {object} t.TimeEntry "Time entry created."
+// @Failure 400 {object} string "Invalid request body, times or ID."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 403 {object} string "Access denied."
+// @Failure 404 {object} string "Task not found."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/{id}/time [post]
+func AddTime(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.AddTime"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		userContext, ok := r.Context().Value(access.CxtKey("userContext")).(access.UserContext)
+		if !ok {
+			http.Error(w, "User context not found", http.StatusUnauthorized)
+			return
+		}
+
+		id := util.GetUrlParam(w, r, log)
+		if id == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		if !authorize(w, r, log, todo, id, t.EditAccess) {
+			return
+		}
+
+		var req t.TimeEntryRequest
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.Error("failed to decode request", sl.Err(err))
+
+			http.Error(w, "failed to deserialize json request", http.StatusBadRequest)
+
+			return
+		}
+
+		log.Info("request body decoded")
+		log.Debug("req: ", slog.Any("request", req))
+
+		validation.InitValidator()
+		if err := validation.ValidateStruct(req); err != nil {
+			log.Debug(fmt.Sprintf("validation failed: %v", err.Error()))
+
+			http.Error(w, fmt.Sprintf("Invalid input: %v", err.Error()), http.StatusBadRequest)
+
+			return
+		}
+
+		started, err1 := time.Parse(time.RFC3339, req.Started)
+		stopped, err2 := time.Parse(time.RFC3339, req.Stopped)
+		if err1 != nil || err2 != nil {
+			http.Error(w, "Invalid input: started and stopped must be RFC 3339 times", http.StatusBadRequest)
+			return
+		}
+
+		if !stopped.After(started) {
+			http.Error(w, "Invalid input: stopped must be after started", http.StatusBadRequest)
+			return
+		}
+
+		if stopped.After(time.Now()) {
+			http.Error(w, "Invalid input: stopped is in the future", http.StatusBadRequest)
+			return
+		}
+
+		log.Info("input validated")
+
+		entry, n, err := todo.AddTimeEntry(r.Context(), id, userContext.UserId, started, stopped, req.Note)
+		if err != nil {
+			if n == 0 {
+				log.Info(err.Error())
+
+				http.Error(w, "No such task", http.StatusNotFound)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info(fmt.Sprintf("successfully added %v seconds to task %v", entry.Seconds, id))
+
+		render.Status(r, http.StatusCreated)
+		render.JSON(w, r, entry)
+	}
+}
+
+// DeleteTime godoc
+// @Summary Delete a time entry
+// @Description Deletes tracked time. Only the user who tracked it or an ADMIN can delete an entry.
+// @Tags time
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID of the task"
+// @Param entryId path int true "ID of the time entry"
+// @Success 200 {object} string "Time entry deleted."
+// @Failure 400 {object} string "Invalid or missing ID."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 403 {object} string "Insufficient permissions."
+// @Failure 404 {object} string "Time entry not found."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/{id}/time/{entryId} [delete]
+func DeleteTime(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.DeleteTime"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		userContext, ok := r.Context().Value(access.CxtKey("userContext")).(access.UserContext)
+		if !ok {
+			http.Error(w, "User context not found", http.StatusUnauthorized)
+			return
+		}
+
+		id := util.GetUrlParam(w, r, log)
+		entryID := util.GetNamedUrlParam(r, "entryId")
+		if id == 0 || entryID == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		entry, err := todo.GetTimeEntry(r.Context(), entryID)
+		if err != nil {
+			if err.Error() == "database.postgres.GetTimeEntry: no such entry" {
+				log.Info(err.Error())
+
+				http.Error(w, "No such time entry", http.StatusNotFound)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		if entry.TodoID != id {
+			log.Info(fmt.Sprintf("time entry %v does not belong to task %v", entryID, id))
+			http.Error(w, "No such time entry", http.StatusNotFound)
+			return
+		}
+
+		if entry.UserID != userContext.UserId && !slices.Contains(userContext.Roles, "ADMIN") {
+			http.Error(w, "not enough rights", http.StatusForbidden)
+			return
+		}
+
+		n, err := todo.DeleteTimeEntry(r.Context(), entryID)
+		if err != nil {
+			if n == 0 {
+				log.Info(err.Error())
+
+				http.Error(w, "No such time entry", http.StatusNotFound)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info("successfully deleted time entry")
+	}
+}
+
+// TaskTime godoc
+// @Summary Retrieve the time tracked on a task
+// @Description Retrieves the time entries of the task by every user with the total and the totals per day.
+// Running timers count up to now.
+// @Tags time
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID of the task"
+// @Param tz query string false "IANA time zone of the days, e.g. Europe/Moscow. Default is UTC."
+// @Success 200 {object} t.TimeSummary "Tracked time retrieved successfully."
+// @Failure 400 {object} string "Invalid or missing task ID or time zone."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 403 {object} string "Access denied."
+// @Failure 404 {object} string "Task not found."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/{id}/time [get]
+func TaskTime(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.TaskTime"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		id := util.GetUrlParam(w, r, log)
+		if id == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		loc, ok := location(w, r, log)
+		if !ok {
+			return
+		}
+
+		if !authorize(w, r, log, todo, id, t.ViewAccess) {
+			return
+		}
+
+		entries, err := todo.TimeEntries(r.Context(), id)
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		tracked, err := todo.TrackedTime(r.Context(), t.TimeQuery{TodoID: &id})
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		now := time.Now()
+		days, err := timetrack.Aggregate(tracked, timetrack.ByDay, time.Time{}, time.Time{}, now, loc)
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		if entries == nil {
+			entries = []t.TimeEntry{}
+		}
+
+		log.Info("successfully retrieved tracked time")
+
+		render.JSON(w, r, t.TimeSummary{Total: timetrack.Total(tracked, time.Time{}, time.Time{}, now), Days: days, Entries: entries})
+	}
+}
+
+// TimeReport godoc
+// @Summary Report tracked time
+// @Description Sums the time the authenticated user tracked by task, list, tag or day. Only the part of an entry
+// inside the range counts, running timers count up to now. A task with several tags counts in each of them,
+// tasks without tags are grouped under an empty tag. Days are sorted in order, other groups longest first.
+// @Tags time
+// @Produce json
+// @Produce text/csv
+// @Security BearerAuth
+// @Param groupBy query string false "Group by task, list, tag or day (default)"
+// @Param from query string false "Start of the range, a date or an RFC 3339 time"
+// @Param to query string false "End of the range, a date (included) or an RFC 3339 time"
+// @Param tz query string false "IANA time zone of dates and days, e.g. Europe/Moscow. Default is UTC."
+// @Param listId query int false "Only the tasks of a list"
+// @Param tag query string false "Only the tasks with a tag"
+// @Param format query string false "json (default) or csv"
+// @Success 200 {object} t.TimeReport "Report of the tracked time."
+// @Failure 400 {object} string "Invalid group, range, time zone or format."
+// @Failure 401 {object} string "Unauthorized access. Bearer token missing or invalid."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/time/report [get]
+func TimeReport(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.TimeReport"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		userContext, ok := r.Context().Value(access.CxtKey("userContext")).(access.UserContext)
+		if !ok {
+			http.Error(w, "User context not found", http.StatusUnauthorized)
+			return
+		}
+
+		loc, ok := location(w, r, log)
+		if !ok {
+			return
+		}
+
+		groupBy := r.URL.Query().Get("groupBy")
+		if groupBy == "" {
+			groupBy = timetrack.ByDay
+		}
+
+		format := r.URL.Query().Get("format")
+		if format != "" && format != "json" && format != "csv" {
+			http.Error(w, "Unknown format", http.StatusBadRequest)
+			return
+		}
+
+		from, to, err := timetrack.ParseRange(r.URL.Query().Get("from"), r.URL.Query().Get("to"), loc)
+		if err != nil {
+			log.Info(err.Error())
+
+			http.Error(w, fmt.Sprintf("Invalid range: %v", err), http.StatusBadRequest)
+
+			return
+		}
+
+		q := t.TimeQuery{UserID: userContext.UserId, Tag: r.URL.Query().Get("tag"), From: from, To: to}
+		if listID, err := strconv.Atoi(r.URL.Query().Get("listId")); err == nil && listID > 0 {
+			q.ListID = &listID
+		}
+
+		tracked, err := todo.TrackedTime(r.Context(), q)
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		now := time.Now()
+		rows, err := timetrack.Aggregate(tracked, groupBy, from, to, now, loc)
+		if err != nil {
+			log.Info(fmt.Sprintf("unknown group: %v", groupBy))
+
+			http.Error(w, "Unknown groupBy, use task, list, tag or day", http.StatusBadRequest)
+
+			return
+		}
+
+		log.Info(fmt.Sprintf("successfully reported %v entries by %v", len(tracked), groupBy))
+
+		if format == "csv" {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="time-by-%s.csv"`, groupBy))
+
+			if err := timetrack.WriteCSV(w, rows); err != nil {
+				log.Error("failed to write report", sl.Err(err))
+			}
+			return
+		}
+
+		report := t.TimeReport{GroupBy: groupBy, Total: timetrack.Total(tracked, from, to, now), Rows: rows}
+		if !from.IsZero() {
+			report.From = from.In(loc).Format(time.RFC3339)
+		}
+		if !to.IsZero() {
+			report.To = to.In(loc).Format(time.RFC3339)
+		}
+
+		render.JSON(w, r, report)
+	}
+}
+
+// location resolves the tz parameter, UTC by default. It writes the error response itself.
+func location(w http.ResponseWriter, r *http.Request, log *slog.Logger) (*time.Location, bool) {
+	tz := r.URL.Query().Get("tz")
+	if tz == "" {
+		return time.UTC, true
+	}
+
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		log.Info(fmt.Sprintf("unknown time zone: %v", tz))
+
+		http.Error(w, "Unknown time zone", http.StatusBadRequest)
+
+		return nil, false
+	}
+
+	return loc, true
+}
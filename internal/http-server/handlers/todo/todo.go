@@ -4,24 +4,70 @@
 package todo
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
 	util "github.com/sabbatD/srest-api/internal/http-server/handleUtil"
 	"github.com/sabbatD/srest-api/internal/lib/api/validation"
 	"github.com/sabbatD/srest-api/internal/lib/logger/sl"
+	"github.com/sabbatD/srest-api/internal/lib/timetrack"
 	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+	"github.com/sabbatD/srest-api/internal/lib/workflow"
 )
 
 type TodoHandler interface {
-	Create(t t.TodoRequest) (int64, error)
-	Update(id int, t t.TodoRequest) (int64, error)
-	Delete(id int) (int64, error)
-	GetTodo(id int) (t.Todo, error)
-	OutputAll(filter string) ([]t.Todo, t.TodoInfo, int, error)
+	Create(ctx context.Context, t t.TodoRequest, actor int) (int64, error)
+	Update(ctx context.Context, id int, t t.TodoRequest, version int, actor int) (int64, error)
+	Delete(ctx context.Context, id int, actor int) (int64, error)
+	GetTodo(ctx context.Context, id int) (t.Todo, error)
+	OutputAll(ctx context.Context, q t.GetAllQuery) (t.MetaResponse, error)
+	Move(ctx context.Context, id int, m t.MoveRequest, actor int) (int64, error)
+	CreateList(ctx context.Context, l t.ListRequest, owner int) (t.List, error)
+	Lists(ctx context.Context, user int) ([]t.List, error)
+	AddDependency(ctx context.Context, id, blockerID int) (int64, error)
+	RemoveDependency(ctx context.Context, id, blockerID int) (int64, error)
+	Dependencies(ctx context.Context, id, user int) ([]t.Todo, error)
+	Ready(ctx context.Context, user int) ([]t.Todo, error)
+	Workflow(ctx context.Context, listID int) (workflow.Workflow, error)
+	SetWorkflow(ctx context.Context, listID int, w workflow.Workflow, actor int) (int64, error)
+	CreateComment(ctx context.Context, todoID, authorID int, c t.CommentRequest) (int64, error)
+	UpdateComment(ctx context.Context, id int, c t.CommentRequest) (int64, error)
+	DeleteComment(ctx context.Context, id int) (int64, error)
+	GetComment(ctx context.Context, id int) (t.Comment, error)
+	Comments(ctx context.Context, todoID int) ([]t.Comment, error)
+	Trash(ctx context.Context, user int) ([]t.Todo, error)
+	Restore(ctx context.Context, id int, actor int) (int64, error)
+	PurgeTrash(ctx context.Context, age time.Duration) (int64, []string, error)
+	EmptyTrash(ctx context.Context, user int) (int64, []string, error)
+	History(ctx context.Context, todoID int) ([]t.TodoEvent, error)
+	Revert(ctx context.Context, id, version int, actor int) (int64, error)
+	Bulk(ctx context.Context, b t.BulkRequest, actor int) (t.BulkResponse, int64, error)
+	Export(ctx context.Context, listID *int, user int) ([]t.Todo, error)
+	Import(ctx context.Context, todos []t.TodoRequest, dryRun bool, actor int) ([]t.ImportResult, error)
+	TodoRole(ctx context.Context, id, user int) (int, error)
+	ListRole(ctx context.Context, id, user int) (int, error)
+	ShareTodo(ctx context.Context, id int, req t.ShareRequest, by int) (t.Share, int64, error)
+	ShareList(ctx context.Context, id int, req t.ShareRequest, by int) (t.Share, int64, error)
+	TodoShares(ctx context.Context, id int) ([]t.Share, error)
+	ListShares(ctx context.Context, id int) ([]t.Share, error)
+	UnshareTodo(ctx context.Context, id, user int) (int64, error)
+	UnshareList(ctx context.Context, id, user int) (int64, error)
+	IncomingShares(ctx context.Context, user int, status string) ([]t.Share, error)
+	RespondShare(ctx context.Context, id, user int, accept bool) (int64, error)
+	StartTimer(ctx context.Context, todoID, user int, note string) (t.TimeEntry, int64, error)
+	StopTimer(ctx context.Context, todoID, user int) (t.TimeEntry, int64, error)
+	ActiveTimer(ctx context.Context, user int) (t.TimeEntry, error)
+	AddTimeEntry(ctx context.Context, todoID, user int, started, stopped time.Time, note string) (t.TimeEntry, int64, error)
+	GetTimeEntry(ctx context.Context, id int) (t.TimeEntry, error)
+	DeleteTimeEntry(ctx context.Context, id int) (int64, error)
+	TimeEntries(ctx context.Context, todoID int) ([]t.TimeEntry, error)
+	TrackedTime(ctx context.Context, q t.TimeQuery) ([]timetrack.Entry, error)
 }
 
 // Create godoc
@@ -32,14 +78,19 @@ type TodoHandler interface {
 // @Produce json
 // @Param UserData body t.TodoRequest true "Task data for creating a new task"
 // @Success 200 {object}  t.Todo "Task successfully created, returns the created task."
-// @Failure 400 {object} string "Invalid request body or missing/incorrect fields."
+// @Failure 400 {object} string "Invalid request body, missing/incorrect fields or unknown status."
+// @Failure 403 {object} string "Access denied."
+// @Failure 404 {object} string "List not found."
 // @Failure 500 {object} string "Internal server error."
 // @Router /todos [post]
 func Create(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "http-server.hanlders.todo.Create"
 
-		log.With(util.SlogWith(op, r)...)
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
 
 		var req t.TodoRequest
 		if err := render.DecodeJSON(r.Body, &req); err != nil {
@@ -53,13 +104,41 @@ func Create(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
 		log.Info("request body decoded")
 		log.Debug("req: ", slog.Any("request", req))
 
-		id, err := todo.Create(req)
+		validation.InitValidator()
+		if err := validation.ValidateStruct(req); err != nil {
+			log.Debug(fmt.Sprintf("validation failed: %v", err.Error()))
+
+			http.Error(w, fmt.Sprintf("Invalid input: %v", err.Error()), http.StatusBadRequest)
+
+			return
+		}
+
+		log.Info("input validated")
+
+		if req.ListID != nil && !authorizeList(w, r, log, todo, *req.ListID, t.EditAccess) {
+			return
+		}
+
+		id, err := todo.Create(r.Context(), req, actor(r))
 		if err != nil {
+			if err.Error() == "database.postgres.CreateTodo: no such list" {
+				log.Info(err.Error())
+
+				http.Error(w, "No such list", http.StatusNotFound)
+
+				return
+			} else if err.Error() == "database.postgres.CreateTodo: no such status" {
+				log.Info(err.Error())
+
+				http.Error(w, "No such status in the list workflow", http.StatusBadRequest)
+
+				return
+			}
 			util.InternalError(w, r, log, err)
 			return
 		}
 
-		task, err := todo.GetTodo(int(id))
+		task, err := todo.GetTodo(r.Context(), int(id))
 		if err != nil {
 			util.InternalError(w, r, log, err)
 			return
@@ -73,40 +152,94 @@ func Create(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
 
 // Get All godoc
 // @Summary Retrieve all tasks
-// @Description Retrieves all tasks with optional filtering by status (e.g., completed or in-progress).
+// @Description Retrieves a page of tasks with optional filtering by status (e.g., completed or in-progress),
+// full-text search and sorting. Info counters cover the list and search scope, meta.totalAmount also honors the status filter.
+// Pass meta.nextCursor back as cursor to get the next page. Only the tasks the caller can see are returned.
 // @Tags todo
 // @Produce json
+// @Param scope query string false "Own tasks (mine), tasks shared with the caller (shared) or both with public tasks (all, default)"
 // @Param filter query string false "Filter tasks by status: all, completed, or inWork"
+// @Param status query string false "Filter tasks by workflow status name"
+// @Param listId query int false "Retrieve tasks of a single list"
+// @Param search query string false "Full-text search in task titles"
+// @Param sortBy query string false "Sort by 'rank' (manual order), 'created', 'title', 'due' or 'priority'. Default is 'rank'."
+// @Param sortOrder query string false "Sort order: 'asc' or 'desc'. Default is 'asc'."
+// @Param limit query int false "Limit the number of tasks returned (default is 20, max is 100)"
+// @Param cursor query string false "Cursor from meta.nextCursor of the previous page"
 // @Success 200 {object} t.MetaResponse "Tasks retrieved successfully."
+// @Failure 400 {object} string "Invalid cursor."
 // @Failure 500 {object} string "Internal server error."
 // @Router /todos [get]
 func GetAll(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "http-server.hanlders.todo.GetAll"
 
-		log.With(util.SlogWith(op, r)...)
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
 
-		filter := r.URL.Query().Get("filter")
+		var q t.GetAllQuery
+		var E error
+
+		q.Filter = r.URL.Query().Get("filter")
+		q.Status = r.URL.Query().Get("status")
+		q.SearchTerm = strings.TrimSpace(r.URL.Query().Get("search"))
+		q.Cursor = r.URL.Query().Get("cursor")
+		q.UserID = actor(r)
+
+		q.Scope = r.URL.Query().Get("scope")
+		switch q.Scope {
+		case "mine", "shared", "all":
+		default:
+			q.Scope = "all"
+		}
+
+		if listID, err := strconv.Atoi(r.URL.Query().Get("listId")); err == nil && listID > 0 {
+			q.ListID = &listID
+		}
 
-		todos, info, n, err := todo.OutputAll(filter)
+		q.SortBy = strings.ToLower(r.URL.Query().Get("sortBy"))
+		switch q.SortBy {
+		case "rank", "created", "title", "due", "priority":
+		default:
+			q.SortBy = "rank"
+		}
+
+		q.SortOrder = strings.ToUpper(r.URL.Query().Get("sortOrder"))
+		switch q.SortOrder {
+		case "ASC", "DESC":
+		default:
+			q.SortOrder = "ASC"
+		}
+
+		q.Limit, E = strconv.Atoi(r.URL.Query().Get("limit"))
+		if E != nil || q.Limit < 1 {
+			q.Limit = 20
+		}
+		if q.Limit > 100 {
+			q.Limit = 100
+		}
+
+		response, err := todo.OutputAll(r.Context(), q)
 		if err != nil {
+			if err.Error() == "database.postgres.OutputAllTodos: invalid cursor" {
+				log.Info(err.Error())
+
+				http.Error(w, "Invalid cursor", http.StatusBadRequest)
+
+				return
+			}
 			util.InternalError(w, r, log, err)
 			return
 		}
 
-		if todos == nil {
-			todos = []t.Todo{}
-		}
-
-		response := t.MetaResponse{
-			Data: todos,
-			Info: info,
-			Meta: t.Meta{
-				TotalAmount: n,
-			},
+		if response.Data == nil {
+			response.Data = []t.Todo{}
 		}
 
 		log.Info("successfully retrieved tasks")
+		log.Debug(fmt.Sprintf("query: %v", q))
 
 		render.JSON(w, r, response)
 	}
@@ -114,12 +247,15 @@ func GetAll(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
 
 // Get godoc
 // @Summary Retrieve a task by ID
-// @Description Retrieves a specific task by its ID from the URL.
+// @Description Retrieves a specific task by its ID from the URL. The version of the task is sent as the ETag header.
 // @Tags todo
 // @Produce json
 // @Param id path int true "ID of the task to retrieve"
+// @Param If-None-Match header string false "ETag of a cached copy of the task"
 // @Success 200 {object}  t.Todo "Task retrieved successfully."
+// @Success 304 {object} string "Task not modified since the given ETag."
 // @Failure 400 {object} string "Invalid or missing task ID."
+// @Failure 403 {object} string "Access denied."
 // @Failure 404 {object} string "Task not found."
 // @Failure 500 {object} string "Internal server error."
 // @Router /todos/{id} [get]
@@ -127,7 +263,10 @@ func Get(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "http-server.hanlders.todo.Get"
 
-		log.With(util.SlogWith(op, r)...)
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
 
 		id := util.GetUrlParam(w, r, log)
 		if id == 0 {
@@ -136,7 +275,11 @@ func Get(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
 			return
 		}
 
-		task, err := todo.GetTodo(id)
+		if !authorize(w, r, log, todo, id, t.ViewAccess) {
+			return
+		}
+
+		task, err := todo.GetTodo(r.Context(), id)
 		if err != nil {
 			if err.Error() == "database.postgres.GetTodo: no such task" {
 				log.Info(err.Error())
@@ -149,6 +292,11 @@ func Get(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
 			return
 		}
 
+		if util.NotModified(w, r, util.ETag(task.Version)) {
+			log.Info("task not modified")
+			return
+		}
+
 		log.Info("successfully retrieved task")
 
 		render.JSON(w, r, task)
@@ -158,24 +306,31 @@ func Get(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
 // Update godoc
 // @Summary Update an existing task
 // @Description Updates an existing task by accepting a JSON payload with the updated task details.
+// A status must be allowed by the list workflow, isDone follows terminal statuses.
+// With If-Match the task is only updated if it was not changed since the given ETag.
 // @Tags todo
 // @Accept json
 // @Produce json
 // @Param id path int true "ID of the task to update"
+// @Param If-Match header string false "ETag of the task the changes are based on"
 // @Param UserData body t.TodoRequest true "Updated task data"
 // @Success 200 {object}  t.Todo "Task updated successfully, returns the updated task."
 // @Failure 400 {object} string "Invalid request body, missing/incorrect fields, or invalid ID."
+// @Failure 400 {object} string "Status is not part of the list workflow."
+// @Failure 403 {object} string "Access denied."
 // @Failure 404 {object} string "Task not found."
+// @Failure 409 {object} string "Task is blocked by open tasks or the status transition is not allowed."
+// @Failure 412 {object} string "Task was changed since the ETag in If-Match."
 // @Failure 500 {object} string "Internal server error."
 // @Router /todos/{id} [put]
 func Update(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "http-server.hanlders.todo.Update"
 
-		log.With(
-			slog.String("op", op),
-			slog.String("request_id", middleware.GetReqID(r.Context())),
-		)
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
 
 		var req t.TodoRequest
 		if err := render.DecodeJSON(r.Body, &req); err != nil {
@@ -207,20 +362,24 @@ func Update(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
 			return
 		}
 
-		n, err := todo.Update(id, req)
-		if err != nil {
-			if n == 0 {
-				log.Info(err.Error())
+		if !authorize(w, r, log, todo, id, t.EditAccess) {
+			return
+		}
 
-				http.Error(w, "No such task", http.StatusNotFound)
+		version, ok := util.IfMatch(r)
+		if !ok {
+			log.Info("invalid If-Match header")
+			http.Error(w, "Task was changed", http.StatusPreconditionFailed)
+			return
+		}
 
-				return
-			}
-			util.InternalError(w, r, log, err)
+		n, err := todo.Update(r.Context(), id, req, version, actor(r))
+		if err != nil {
+			updateError(w, r, log, n, err)
 			return
 		}
 
-		task, err := todo.GetTodo(id)
+		task, err := todo.GetTodo(r.Context(), id)
 		if err != nil {
 			util.InternalError(w, r, log, err)
 			return
@@ -228,18 +387,44 @@ func Update(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
 
 		log.Info("successfully updated task")
 
+		w.Header().Set("ETag", util.ETag(task.Version))
 		render.JSON(w, r, task)
 	}
 }
 
+// updateError writes the response for a failed Update by its return code.
+func updateError(w http.ResponseWriter, r *http.Request, log *slog.Logger, n int64, err error) {
+	switch n {
+	case 0:
+		log.Info(err.Error())
+		http.Error(w, "No such task", http.StatusNotFound)
+	case -2:
+		log.Info(err.Error())
+		http.Error(w, "Task is blocked by open tasks", http.StatusConflict)
+	case -3:
+		log.Info(err.Error())
+		http.Error(w, "No such status in the list workflow", http.StatusBadRequest)
+	case -4:
+		log.Info(err.Error())
+		http.Error(w, "Status transition is not allowed", http.StatusConflict)
+	case -5:
+		log.Info(err.Error())
+		http.Error(w, "Task was changed", http.StatusPreconditionFailed)
+	default:
+		util.InternalError(w, r, log, err)
+	}
+}
+
 // Delete godoc
-// @Summary Delete a task by ID
-// @Description Deletes a task by its ID from the URL.
+// @Summary Move a task to the trash
+// @Description Moves a task to the trash by its ID from the URL. Trashed tasks can be restored
+// until the trash is emptied or the retention period is over.
 // @Tags todo
 // @Produce json
 // @Param id path int true "ID of the task to delete"
-// @Success 200 {object} string "Task deleted successfully."
+// @Success 200 {object} string "Task moved to the trash successfully."
 // @Failure 400 {object} string "Invalid or missing task ID."
+// @Failure 403 {object} string "Access denied."
 // @Failure 404 {object} string "Task not found."
 // @Failure 500 {object} string "Internal server error."
 // @Router /todos/{id} [delete]
@@ -247,7 +432,10 @@ func Delete(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "http-server.hanlders.todo.Delete"
 
-		log.With(util.SlogWith(op, r)...)
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
 
 		id := util.GetUrlParam(w, r, log)
 		if id == 0 {
@@ -258,7 +446,11 @@ func Delete(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
 			return
 		}
 
-		n, err := todo.Delete(id)
+		if !authorize(w, r, log, todo, id, t.EditAccess) {
+			return
+		}
+
+		n, err := todo.Delete(r.Context(), id, actor(r))
 		if err != nil {
 			if n == 0 {
 				log.Info(err.Error())
@@ -271,6 +463,122 @@ func Delete(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
 			return
 		}
 
-		log.Info("successfully retrieved task")
+		log.Info("successfully deleted task")
+	}
+}
+
+// Move godoc
+// @Summary Move a task
+// @Description Places a task right before or right after an anchor task, taking the anchor's list.
+// Without an anchor the task is moved to the end of the given list. Only the moved task is changed.
+// Moving a task to another list hands it to the owner of that list, so only the owner of the task can do it.
+// @Tags todo
+// @Accept json
+// @Produce json
+// @Param id path int true "ID of the task to move"
+// @Param MoveData body t.MoveRequest true "Anchor task or target list"
+// @Success 200 {object}  t.Todo "Task moved successfully, returns the moved task."
+// @Failure 400 {object} string "Invalid request body, anchor or ID."
+// @Failure 403 {object} string "Access denied."
+// @Failure 404 {object} string "Task, anchor or list not found."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/{id}/move [post]
+func Move(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.Move"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		id := util.GetUrlParam(w, r, log)
+		if id == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		if !authorize(w, r, log, todo, id, t.EditAccess) {
+			return
+		}
+
+		var req t.MoveRequest
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.Error("failed to decode request", sl.Err(err))
+
+			http.Error(w, "failed to deserialize json request", http.StatusBadRequest)
+
+			return
+		}
+
+		log.Info("request body decoded")
+		log.Debug("req: ", slog.Any("request", req))
+
+		validation.InitValidator()
+		if err := validation.ValidateStruct(req); err != nil {
+			log.Debug(fmt.Sprintf("validation failed: %v", err.Error()))
+
+			http.Error(w, fmt.Sprintf("Invalid input: %v", err.Error()), http.StatusBadRequest)
+
+			return
+		}
+
+		if req.Before != nil && req.After != nil {
+			http.Error(w, "Invalid input: only one of before and after can be set", http.StatusBadRequest)
+			return
+		}
+
+		if req.Before == nil && req.After == nil && req.ListID == nil {
+			http.Error(w, "Invalid input: before, after or listId is required", http.StatusBadRequest)
+			return
+		}
+
+		log.Info("input validated")
+
+		// The task lands next to the anchor, so the anchor has to be editable as well.
+		for _, anchor := range []*int{req.Before, req.After} {
+			if anchor != nil && !authorize(w, r, log, todo, *anchor, t.EditAccess) {
+				return
+			}
+		}
+		if req.ListID != nil && !authorizeList(w, r, log, todo, *req.ListID, t.EditAccess) {
+			return
+		}
+
+		n, err := todo.Move(r.Context(), id, req, actor(r))
+		if err != nil {
+			if n == 0 {
+				log.Info(err.Error())
+
+				http.Error(w, "No such task or list", http.StatusNotFound)
+
+				return
+			} else if n == -2 {
+				log.Info(err.Error())
+
+				http.Error(w, "Task can not be its own anchor", http.StatusBadRequest)
+
+				return
+			} else if n == -6 {
+				log.Info(err.Error())
+
+				http.Error(w, "Only the owner can move the task to another list", http.StatusForbidden)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		task, err := todo.GetTodo(r.Context(), id)
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info("successfully moved task")
+
+		render.JSON(w, r, task)
 	}
 }
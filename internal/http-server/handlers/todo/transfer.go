@@ -0,0 +1,285 @@
+package todo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/render"
+	util "github.com/sabbatD/srest-api/internal/http-server/handleUtil"
+	"github.com/sabbatD/srest-api/internal/lib/api/validation"
+	"github.com/sabbatD/srest-api/internal/lib/logger/sl"
+	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+	"github.com/sabbatD/srest-api/internal/lib/todoio"
+)
+
+const (
+	maxImportSize = 5 << 20
+	maxImportRows = 1000
+)
+
+var contentTypes = map[string]string{
+	todoio.JSON: "application/json",
+	todoio.CSV:  "text/csv",
+	todoio.ICS:  "text/calendar",
+}
+
+// Export godoc
+// @Summary Export tasks
+// @Description Exports the tasks of a list or all tasks the caller can see as JSON, CSV or iCalendar VTODO (.ics). Exported files can be imported back.
+// @Tags todo
+// @Produce json
+// @Produce text/csv
+// @Produce text/calendar
+// @Param format query string false "Export format: json (default), csv or ics"
+// @Param listId query int false "Export the tasks of a single list"
+// @Success 200 {file} file "Exported tasks."
+// @Failure 400 {object} string "Unknown format."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/export [get]
+func Export(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.Export"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = todoio.JSON
+		}
+
+		contentType, ok := contentTypes[format]
+		if !ok {
+			log.Info(fmt.Sprintf("unknown format: %v", format))
+
+			http.Error(w, "Unknown format", http.StatusBadRequest)
+
+			return
+		}
+
+		var listID *int
+		if id, err := strconv.Atoi(r.URL.Query().Get("listId")); err == nil && id > 0 {
+			listID = &id
+		}
+
+		todos, err := todo.Export(r.Context(), listID, actor(r))
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType+"; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="todos.%s"`, format))
+
+		switch format {
+		case todoio.CSV:
+			err = todoio.WriteCSV(w, todos)
+		case todoio.ICS:
+			err = todoio.WriteICS(w, todos, time.Now())
+		default:
+			err = todoio.WriteJSON(w, todos)
+		}
+		if err != nil {
+			log.Error("failed to write export", sl.Err(err))
+			return
+		}
+
+		log.Info(fmt.Sprintf("successfully exported %v tasks", len(todos)))
+	}
+}
+
+// Import godoc
+// @Summary Import tasks
+// @Description Creates tasks from a JSON, CSV or iCalendar VTODO file sent as the request body. The format is taken
+// from the format parameter or the Content-Type header. CSV columns are mapped to task fields by a dialect:
+// "sapi" reads the CSV export, "todoist" and "trello" read the CSV exports of those services. The columns parameter
+// maps fields to other columns, e.g. "title:Name,due:Deadline". Every task is validated like the body of Create
+// and gets its own result, a broken task does not stop the others. A dry run reports the results without creating tasks.
+// @Tags todo
+// @Accept json
+// @Accept text/csv
+// @Accept text/calendar
+// @Produce json
+// @Param format query string false "Import format: json, csv or ics. Default is taken from Content-Type."
+// @Param dialect query string false "CSV layout: sapi (default), todoist or trello"
+// @Param columns query string false "CSV column mapping overriding the dialect, e.g. title:Name,due:Deadline"
+// @Param listId query int false "List to import the tasks into, by default tasks are imported without a list"
+// @Param dryRun query bool false "Validate the tasks without creating them"
+// @Success 200 {object} t.ImportResponse "Per task results."
+// @Failure 400 {object} string "Unknown format, dialect or columns, unreadable file or too many tasks."
+// @Failure 403 {object} string "Access denied to the list."
+// @Failure 404 {object} string "List not found."
+// @Failure 413 {object} string "File too large."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/import [post]
+func Import(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.Import"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			for f, contentType := range contentTypes {
+				if mediaType == contentType {
+					format = f
+				}
+			}
+		}
+
+		if _, ok := contentTypes[format]; !ok {
+			log.Info(fmt.Sprintf("unknown format: %q", format))
+
+			http.Error(w, "Unknown format", http.StatusBadRequest)
+
+			return
+		}
+
+		name := r.URL.Query().Get("dialect")
+		if name == "" {
+			name = "sapi"
+		}
+
+		dialect, ok := todoio.Dialects[name]
+		if !ok {
+			log.Info(fmt.Sprintf("unknown dialect: %v", name))
+
+			http.Error(w, "Unknown dialect", http.StatusBadRequest)
+
+			return
+		}
+
+		if s := r.URL.Query().Get("columns"); s != "" {
+			columns, err := todoio.ParseColumns(s)
+			if err != nil {
+				log.Info(err.Error())
+
+				http.Error(w, fmt.Sprintf("Invalid columns: %v", err), http.StatusBadRequest)
+
+				return
+			}
+			dialect = dialect.WithColumns(columns)
+		}
+
+		var listID *int
+		if id, err := strconv.Atoi(r.URL.Query().Get("listId")); err == nil && id > 0 {
+			if !authorizeList(w, r, log, todo, id, t.EditAccess) {
+				return
+			}
+			listID = &id
+		}
+
+		dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				log.Info(err.Error())
+
+				http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+
+				return
+			}
+			log.Error("failed to read request", sl.Err(err))
+
+			http.Error(w, "failed to read request", http.StatusBadRequest)
+
+			return
+		}
+
+		rows, err := todoio.Read(format, bytes.NewReader(body), dialect)
+		if err != nil {
+			log.Info(err.Error())
+
+			http.Error(w, fmt.Sprintf("Invalid file: %v", err), http.StatusBadRequest)
+
+			return
+		}
+
+		if len(rows) > maxImportRows {
+			log.Info(fmt.Sprintf("too many tasks: %v", len(rows)))
+
+			http.Error(w, fmt.Sprintf("Too many tasks, at most %v can be imported at once", maxImportRows), http.StatusBadRequest)
+
+			return
+		}
+
+		log.Info(fmt.Sprintf("read %v tasks", len(rows)))
+
+		resp := t.ImportResponse{DryRun: dryRun, Results: make([]t.ImportResult, len(rows))}
+
+		var todos []t.TodoRequest
+		var valid []int
+
+		validation.InitValidator()
+		for i, row := range rows {
+			resp.Results[i].Row = row.Line
+
+			if row.Err != nil {
+				resp.Results[i].Error = fmt.Sprintf("Invalid task: %v", row.Err)
+				continue
+			}
+
+			row.Todo.ListID = listID
+			if err := validation.ValidateStruct(row.Todo); err != nil {
+				resp.Results[i].Error = fmt.Sprintf("Invalid input: %v", err.Error())
+				continue
+			}
+
+			todos = append(todos, row.Todo)
+			valid = append(valid, i)
+		}
+
+		results, err := todo.Import(r.Context(), todos, dryRun, actor(r))
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		for j, res := range results {
+			i := valid[j]
+			resp.Results[i].ID = res.ID
+			resp.Results[i].Error = importError(res.Error)
+		}
+
+		for _, res := range resp.Results {
+			if res.Error == "" {
+				resp.Imported++
+			} else {
+				resp.Failed++
+			}
+		}
+
+		log.Info(fmt.Sprintf("successfully imported %v tasks, %v failed, dry run: %v", resp.Imported, resp.Failed, dryRun))
+
+		render.JSON(w, r, resp)
+	}
+}
+
+// importError maps the storage error of an imported task to the message Create would have returned.
+func importError(err string) string {
+	switch err {
+	case "":
+		return ""
+	case "no such list":
+		return "No such list"
+	case "no such status":
+		return "No such status in the list workflow"
+	default:
+		return err
+	}
+}
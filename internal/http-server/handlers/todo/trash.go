@@ -0,0 +1,133 @@
+package todo
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/render"
+	"github.com/sabbatD/srest-api/internal/blob"
+	util "github.com/sabbatD/srest-api/internal/http-server/handleUtil"
+	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+	"github.com/sabbatD/srest-api/internal/trash"
+)
+
+// Trash godoc
+// @Summary Retrieve trashed tasks
+// @Description Retrieves the trashed tasks the caller can see, most recently deleted first.
+// @Tags todo
+// @Produce json
+// @Success 200 {array} t.Todo "Trashed tasks retrieved successfully."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/trash [get]
+func Trash(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.Trash"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		todos, err := todo.Trash(r.Context(), actor(r))
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		if todos == nil {
+			todos = []t.Todo{}
+		}
+
+		log.Info("successfully retrieved trash")
+
+		render.JSON(w, r, todos)
+	}
+}
+
+// Restore godoc
+// @Summary Restore a task from the trash
+// @Description Moves a trashed task back to its list at its former position.
+// @Tags todo
+// @Produce json
+// @Param id path int true "ID of the task to restore"
+// @Success 200 {object} t.Todo "Task restored successfully, returns the restored task."
+// @Failure 400 {object} string "Invalid or missing task ID."
+// @Failure 403 {object} string "Access denied."
+// @Failure 404 {object} string "Task not found in the trash."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/{id}/restore [post]
+func Restore(log *slog.Logger, todo TodoHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.Restore"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		id := util.GetUrlParam(w, r, log)
+		if id == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		if !authorize(w, r, log, todo, id, t.EditAccess) {
+			return
+		}
+
+		n, err := todo.Restore(r.Context(), id, actor(r))
+		if err != nil {
+			if n == 0 {
+				log.Info(err.Error())
+
+				http.Error(w, "No such task in trash", http.StatusNotFound)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		task, err := todo.GetTodo(r.Context(), id)
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info("successfully restored task")
+
+		render.JSON(w, r, task)
+	}
+}
+
+// EmptyTrash godoc
+// @Summary Empty the trash
+// @Description Permanently deletes the trashed tasks the caller can edit together with their comments and attachments.
+// @Tags todo
+// @Produce json
+// @Success 200 {object} map[string]int64 "Trash emptied, returns the number of deleted tasks."
+// @Failure 500 {object} string "Internal server error."
+// @Router /todos/trash [delete]
+func EmptyTrash(log *slog.Logger, todo TodoHandler, blobs blob.BlobStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.hanlders.todo.EmptyTrash"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		n, keys, err := todo.EmptyTrash(r.Context(), actor(r))
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		trash.DeleteBlobs(r.Context(), log, blobs, keys)
+
+		log.Info("successfully emptied trash")
+
+		render.JSON(w, r, map[string]int64{"deleted": n})
+	}
+}
@@ -0,0 +1,115 @@
+package user
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/render"
+
+	util "github.com/sabbatD/srest-api/internal/http-server/handleUtil"
+	"github.com/sabbatD/srest-api/internal/lib/api/access"
+	"github.com/sabbatD/srest-api/internal/lib/logger/sl"
+)
+
+type FeedURL struct {
+	URL string `json:"url"`
+}
+
+// RegenerateFeed godoc
+// @Summary Create or regenerate the calendar feed link
+// @Description Creates a new secret link to the .ics feed of the user's tasks with due dates. Calendar apps
+// can not send the Authorization header, so the link itself authenticates the feed. The previous link stops working.
+// The link is shown only once.
+// @Tags user
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} FeedURL "Feed link."
+// @Failure 401 {object} string "User context not found."
+// @Failure 500 {object} string "Internal error."
+// @Router /user/feed [post]
+func RegenerateFeed(log *slog.Logger, User UserHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.handlers.user.RegenerateFeed"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		userContext, ok := r.Context().Value(access.CxtKey("userContext")).(access.UserContext)
+		if !ok {
+			http.Error(w, "User context not found", http.StatusUnauthorized)
+			return
+		}
+
+		token, err := access.NewFeedToken()
+		if err != nil {
+			log.Error("failed to generate feed token", sl.Err(err))
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		if err := User.SaveFeedToken(r.Context(), userContext.UserId, access.HashFeedToken(token)); err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info("Feed token successfully regenerated")
+
+		render.JSON(w, r, FeedURL{URL: feedURL(r, token)})
+	}
+}
+
+// RevokeFeed godoc
+// @Summary Revoke the calendar feed link
+// @Description Disables the .ics feed of the user, calendar apps subscribed to it stop receiving updates.
+// @Tags user
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} string "Feed link revoked."
+// @Failure 401 {object} string "User context not found."
+// @Failure 404 {object} string "No feed link."
+// @Failure 500 {object} string "Internal error."
+// @Router /user/feed [delete]
+func RevokeFeed(log *slog.Logger, User UserHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.handlers.user.RevokeFeed"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		userContext, ok := r.Context().Value(access.CxtKey("userContext")).(access.UserContext)
+		if !ok {
+			http.Error(w, "User context not found", http.StatusUnauthorized)
+			return
+		}
+
+		n, err := User.RevokeFeedToken(r.Context(), userContext.UserId)
+		if err != nil {
+			if n == 0 {
+				log.Info(err.Error())
+
+				http.Error(w, "No feed link", http.StatusNotFound)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info("Feed token successfully revoked")
+	}
+}
+
+// feedURL is the absolute link to the feed, calendar apps are given it as is.
+func feedURL(r *http.Request, token string) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+
+	return fmt.Sprintf("%s://%s/api/v1/feed/%s.ics", scheme, r.Host, token)
+}
@@ -0,0 +1,344 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/render"
+
+	util "github.com/sabbatD/srest-api/internal/http-server/handleUtil"
+	"github.com/sabbatD/srest-api/internal/lib/api/access"
+	"github.com/sabbatD/srest-api/internal/lib/api/validation"
+	"github.com/sabbatD/srest-api/internal/lib/logger/sl"
+	"github.com/sabbatD/srest-api/internal/notify"
+)
+
+type NotificationHandler interface {
+	Notifications(ctx context.Context, user int, q notify.Query) (notify.Inbox, error)
+	ReadNotification(ctx context.Context, id, user int) (int64, error)
+	ReadAllNotifications(ctx context.Context, user int) (int64, error)
+	DeleteNotification(ctx context.Context, id, user int) (int64, error)
+	NotificationPreferences(ctx context.Context, user int) ([]notify.Preference, error)
+	SetNotificationPreferences(ctx context.Context, user int, prefs []notify.Preference) error
+}
+
+type ReadCount struct {
+	Read int64 `json:"read"`
+}
+
+// Notifications godoc
+// @Summary List the notifications of the user
+// @Description Lists the notifications of the user, newest first, with the number of unread ones.
+// Notifications come from task reminders, @mentions, shares and admin actions on the account.
+// @Tags user
+// @Produce json
+// @Security BearerAuth
+// @Param unread query bool false "Only unread notifications"
+// @Param limit query int false "Page size, 50 by default, at most 500"
+// @Param offset query int false "Number of notifications to skip"
+// @Success 200 {object} notify.Inbox "Notifications."
+// @Failure 400 {object} string "Invalid query parameters."
+// @Failure 401 {object} string "User context not found."
+// @Failure 500 {object} string "Internal error."
+// @Router /user/notifications [get]
+func Notifications(log *slog.Logger, User NotificationHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.handlers.user.Notifications"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		userContext, ok := r.Context().Value(access.CxtKey("userContext")).(access.UserContext)
+		if !ok {
+			http.Error(w, "User context not found", http.StatusUnauthorized)
+			return
+		}
+
+		query := r.URL.Query()
+		q := notify.Query{Limit: 50}
+
+		if s := query.Get("unread"); s != "" {
+			unread, err := strconv.ParseBool(s)
+			if err != nil {
+				log.Info(fmt.Sprintf("invalid unread: %q", s))
+				http.Error(w, "Invalid unread", http.StatusBadRequest)
+				return
+			}
+			q.Unread = unread
+		}
+
+		if s := query.Get("limit"); s != "" {
+			limit, err := strconv.Atoi(s)
+			if err != nil || limit < 1 || limit > 500 {
+				log.Info(fmt.Sprintf("invalid limit: %q", s))
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			q.Limit = limit
+		}
+
+		if s := query.Get("offset"); s != "" {
+			offset, err := strconv.Atoi(s)
+			if err != nil || offset < 0 {
+				log.Info(fmt.Sprintf("invalid offset: %q", s))
+				http.Error(w, "Invalid offset", http.StatusBadRequest)
+				return
+			}
+			q.Offset = offset
+		}
+
+		inbox, err := User.Notifications(r.Context(), userContext.UserId, q)
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info("notifications successfully retrieved")
+
+		render.JSON(w, r, inbox)
+	}
+}
+
+// ReadNotification godoc
+// @Summary Mark a notification read
+// @Tags user
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID of the notification"
+// @Success 200 {object} string "Notification marked read."
+// @Failure 400 {object} string "Invalid or missing notification ID."
+// @Failure 401 {object} string "User context not found."
+// @Failure 404 {object} string "Notification not found."
+// @Failure 500 {object} string "Internal error."
+// @Router /user/notifications/{id}/read [post]
+func ReadNotification(log *slog.Logger, User NotificationHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.handlers.user.ReadNotification"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		userContext, ok := r.Context().Value(access.CxtKey("userContext")).(access.UserContext)
+		if !ok {
+			http.Error(w, "User context not found", http.StatusUnauthorized)
+			return
+		}
+
+		id := util.GetUrlParam(w, r, log)
+		if id == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		n, err := User.ReadNotification(r.Context(), id, userContext.UserId)
+		if err != nil {
+			if n == 0 {
+				log.Info(err.Error())
+
+				http.Error(w, "No such notification", http.StatusNotFound)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info("notification marked read")
+	}
+}
+
+// ReadAllNotifications godoc
+// @Summary Mark all notifications read
+// @Tags user
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} ReadCount "Number of notifications marked read."
+// @Failure 401 {object} string "User context not found."
+// @Failure 500 {object} string "Internal error."
+// @Router /user/notifications/read [post]
+func ReadAllNotifications(log *slog.Logger, User NotificationHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.handlers.user.ReadAllNotifications"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		userContext, ok := r.Context().Value(access.CxtKey("userContext")).(access.UserContext)
+		if !ok {
+			http.Error(w, "User context not found", http.StatusUnauthorized)
+			return
+		}
+
+		n, err := User.ReadAllNotifications(r.Context(), userContext.UserId)
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info("notifications marked read")
+
+		render.JSON(w, r, ReadCount{Read: n})
+	}
+}
+
+// DeleteNotification godoc
+// @Summary Delete a notification
+// @Tags user
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID of the notification"
+// @Success 200 {object} string "Notification deleted."
+// @Failure 400 {object} string "Invalid or missing notification ID."
+// @Failure 401 {object} string "User context not found."
+// @Failure 404 {object} string "Notification not found."
+// @Failure 500 {object} string "Internal error."
+// @Router /user/notifications/{id} [delete]
+func DeleteNotification(log *slog.Logger, User NotificationHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.handlers.user.DeleteNotification"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		userContext, ok := r.Context().Value(access.CxtKey("userContext")).(access.UserContext)
+		if !ok {
+			http.Error(w, "User context not found", http.StatusUnauthorized)
+			return
+		}
+
+		id := util.GetUrlParam(w, r, log)
+		if id == 0 {
+			log.Info("missing or wrong id")
+			http.Error(w, "Missing or wrong id", http.StatusBadRequest)
+			return
+		}
+
+		n, err := User.DeleteNotification(r.Context(), id, userContext.UserId)
+		if err != nil {
+			if n == 0 {
+				log.Info(err.Error())
+
+				http.Error(w, "No such notification", http.StatusNotFound)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info("notification deleted")
+	}
+}
+
+// NotificationPreferences godoc
+// @Summary Get the notification preferences
+// @Description Tells for every kind of notifications (reminder, mention, share, account) whether it goes
+// to the inbox and whether it is emailed. By default every kind goes to the inbox and none is emailed.
+// @Tags user
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} notify.Preferences "Preferences."
+// @Failure 401 {object} string "User context not found."
+// @Failure 500 {object} string "Internal error."
+// @Router /user/notifications/preferences [get]
+func NotificationPreferences(log *slog.Logger, User NotificationHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.handlers.user.NotificationPreferences"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		userContext, ok := r.Context().Value(access.CxtKey("userContext")).(access.UserContext)
+		if !ok {
+			http.Error(w, "User context not found", http.StatusUnauthorized)
+			return
+		}
+
+		prefs, err := User.NotificationPreferences(r.Context(), userContext.UserId)
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info("notification preferences successfully retrieved")
+
+		render.JSON(w, r, notify.Preferences{Preferences: prefs})
+	}
+}
+
+// SetNotificationPreferences godoc
+// @Summary Update the notification preferences
+// @Description Saves the preferences of the given kinds, the other kinds keep theirs.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param Preferences body notify.Preferences true "Preferences to save"
+// @Success 200 {object} notify.Preferences "Preferences of every kind."
+// @Failure 400 {object} string "Invalid input."
+// @Failure 401 {object} string "User context not found."
+// @Failure 500 {object} string "Internal error."
+// @Router /user/notifications/preferences [put]
+func SetNotificationPreferences(log *slog.Logger, User NotificationHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.handlers.user.SetNotificationPreferences"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		userContext, ok := r.Context().Value(access.CxtKey("userContext")).(access.UserContext)
+		if !ok {
+			http.Error(w, "User context not found", http.StatusUnauthorized)
+			return
+		}
+
+		var req notify.Preferences
+		if err := render.DecodeJSON(r.Body, &req); err != nil {
+			log.Error("failed to decode request", sl.Err(err))
+
+			http.Error(w, "failed to deserialize json request", http.StatusBadRequest)
+
+			return
+		}
+
+		validation.InitValidator()
+		if err := validation.ValidateStruct(req); err != nil {
+			log.Debug(fmt.Sprintf("validation failed: %v", err.Error()))
+
+			http.Error(w, fmt.Sprintf("Invalid input: %v", err.Error()), http.StatusBadRequest)
+
+			return
+		}
+
+		if err := User.SetNotificationPreferences(r.Context(), userContext.UserId, req.Preferences); err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		prefs, err := User.NotificationPreferences(r.Context(), userContext.UserId)
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info("notification preferences successfully saved")
+
+		render.JSON(w, r, notify.Preferences{Preferences: prefs})
+	}
+}
@@ -1,6 +1,7 @@
 package user
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -12,6 +13,7 @@ import (
 	"github.com/sabbatD/srest-api/internal/lib/api/validation"
 	"github.com/sabbatD/srest-api/internal/lib/logger/sl"
 	u "github.com/sabbatD/srest-api/internal/lib/userConfig"
+	"github.com/sabbatD/srest-api/internal/metrics"
 )
 
 type AccessToken struct {
@@ -27,15 +29,18 @@ type Tokens struct {
 }
 
 type UserHandler interface {
-	Add(u u.User) (int, error)
-	Auth(u u.AuthData) (user u.TableUser, err error)
-	Get(id int) (u.TableUser, error)
-	UpdateUser(u u.PutUser, id int) (int64, error)
-	RefreshToken(token string) (string, int, error)
-	SaveRefreshToken(token string, id int) error
-	ChangePassword(u u.Pwd, id int) (int64, error)
-	Logout(id int) error
-	UserVersion(id int) int
+	Add(ctx context.Context, u u.User) (int, error)
+	Auth(ctx context.Context, u u.AuthData) (user u.TableUser, err error)
+	Get(ctx context.Context, id int) (u.TableUser, error)
+	UpdateUser(ctx context.Context, u u.PutUser, id int, version int) (int64, error)
+	PatchUser(ctx context.Context, p u.PatchUser, id int, version int) (int64, error)
+	RefreshToken(ctx context.Context, token string) (string, int, error)
+	SaveRefreshToken(ctx context.Context, token string, id int) error
+	ChangePassword(ctx context.Context, u u.Pwd, id int) (int64, error)
+	Logout(ctx context.Context, id int) error
+	UserVersion(ctx context.Context, id int) int
+	SaveFeedToken(ctx context.Context, id int, hash string) error
+	RevokeFeedToken(ctx context.Context, id int) (int64, error)
 }
 
 // Register godoc
@@ -56,7 +61,10 @@ func Register(log *slog.Logger, User UserHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "http-server.handlers.user.Register"
 
-		log.With(util.SlogWith(op, r)...)
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
 
 		var req u.User
 		if err := render.DecodeJSON(r.Body, &req); err != nil {
@@ -81,7 +89,7 @@ func Register(log *slog.Logger, User UserHandler) http.HandlerFunc {
 
 		log.Info("input validated")
 
-		id, err := User.Add(req)
+		id, err := User.Add(r.Context(), req)
 		if err != nil {
 			if err.Error() == "database.postgres.Add: user already exists" {
 				log.Info(err.Error())
@@ -94,7 +102,7 @@ func Register(log *slog.Logger, User UserHandler) http.HandlerFunc {
 			return
 		}
 
-		user, err := User.Get(id)
+		user, err := User.Get(r.Context(), id)
 		if err != nil {
 			util.InternalError(w, r, log, err)
 			return
@@ -126,7 +134,10 @@ func Auth(log *slog.Logger, User UserHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "http-server.handlers.user.Auth"
 
-		log.With(util.SlogWith(op, r)...)
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
 
 		var req u.AuthData
 		if err := render.DecodeJSON(r.Body, &req); err != nil {
@@ -151,12 +162,14 @@ func Auth(log *slog.Logger, User UserHandler) http.HandlerFunc {
 
 		log.Info("input validated")
 
-		user, err := User.Auth(req)
+		user, err := User.Auth(r.Context(), req)
 		if err != nil {
+			metrics.SignIn(metrics.Error)
 			util.InternalError(w, r, log, err)
 			return
 		}
 		if user.ID == 0 {
+			metrics.SignIn(metrics.Failure)
 			log.Info("wrong login or password")
 
 			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
@@ -176,11 +189,17 @@ func Auth(log *slog.Logger, User UserHandler) http.HandlerFunc {
 			return
 		}
 
-		if err := User.SaveRefreshToken(refreshToken, user.ID); err != nil {
+		if err := User.SaveRefreshToken(r.Context(), refreshToken, user.ID); err != nil {
 			util.InternalError(w, r, log, err)
 			return
 		}
 
+		if user.IsBlocked {
+			metrics.SignIn(metrics.Blocked)
+		} else {
+			metrics.SignIn(metrics.Success)
+		}
+
 		log.Info("successfully logged in")
 		log.Debug(fmt.Sprintf("user: %v", req))
 
@@ -204,7 +223,10 @@ func Refresh(log *slog.Logger, User UserHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "http-server.handlers.user.Refresh"
 
-		log.With(util.SlogWith(op, r)...)
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
 
 		var req RefreshToken
 		if err := render.DecodeJSON(r.Body, &req); err != nil {
@@ -215,12 +237,14 @@ func Refresh(log *slog.Logger, User UserHandler) http.HandlerFunc {
 			return
 		}
 
-		token, id, err := User.RefreshToken(req.Token)
+		token, id, err := User.RefreshToken(r.Context(), req.Token)
 		if err != nil {
+			metrics.Refresh(metrics.Error)
 			util.InternalError(w, r, log, err)
 			return
 		}
 		if token == "expired" {
+			metrics.Refresh(metrics.Expired)
 			log.Info("token is expired")
 
 			http.Error(w, "Invalid credentials: token is expired - must auth again", http.StatusUnauthorized)
@@ -228,7 +252,7 @@ func Refresh(log *slog.Logger, User UserHandler) http.HandlerFunc {
 			return
 		}
 
-		user, err := User.Get(id)
+		user, err := User.Get(r.Context(), id)
 		if err != nil {
 			util.InternalError(w, r, log, err)
 			return
@@ -245,11 +269,13 @@ func Refresh(log *slog.Logger, User UserHandler) http.HandlerFunc {
 			util.InternalError(w, r, log, fmt.Errorf("could not generate JWT refreshToken"))
 			return
 		}
-		if err := User.SaveRefreshToken(refreshToken, user.ID); err != nil {
+		if err := User.SaveRefreshToken(r.Context(), refreshToken, user.ID); err != nil {
 			util.InternalError(w, r, log, err)
 			return
 		}
 
+		metrics.Refresh(metrics.Success)
+
 		log.Info("successfully refreshed access token")
 		log.Debug(fmt.Sprintf("user: %v", refreshToken))
 
@@ -261,10 +287,13 @@ func Refresh(log *slog.Logger, User UserHandler) http.HandlerFunc {
 // @Summary Get user profile
 // @Description Retrieves the full profile of the currently authenticated user.
 // The user must be logged in and provide a valid JWT token for authentication.
+// The version of the profile is sent as the ETag header.
 // @Tags user
 // @Produce json
 // @Security BearerAuth
+// @Param If-None-Match header string false "ETag of a cached copy of the profile"
 // @Success 200 {object} u.TableUser "Returns the user profile data."
+// @Success 304 {object} string "Profile not modified since the given ETag."
 // @Failure 400 {object} string "No such user."
 // @Failure 500 {object} string "Internal error."
 // @Router /user/profile [get]
@@ -272,7 +301,10 @@ func Profile(log *slog.Logger, User UserHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "http-server.handlers.user.Profile"
 
-		log.With(util.SlogWith(op, r)...)
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
 
 		userContext, ok := r.Context().Value(access.CxtKey("userContext")).(access.UserContext)
 		if !ok {
@@ -280,7 +312,7 @@ func Profile(log *slog.Logger, User UserHandler) http.HandlerFunc {
 			return
 		}
 
-		user, err := User.Get(userContext.UserId)
+		user, err := User.Get(r.Context(), userContext.UserId)
 		if err != nil {
 			if err.Error() == "database.postgres.Get: no such user" {
 				log.Info(err.Error())
@@ -293,6 +325,11 @@ func Profile(log *slog.Logger, User UserHandler) http.HandlerFunc {
 			return
 		}
 
+		if util.NotModified(w, r, util.ETag(user.Version)) {
+			log.Info("User not modified")
+			return
+		}
+
 		log.Info("User successfully retrieved")
 		log.Debug(fmt.Sprintf("user: %v", user))
 
@@ -308,18 +345,23 @@ func Profile(log *slog.Logger, User UserHandler) http.HandlerFunc {
 // @Accept json
 // @Produce json
 // @Param Userdata body u.PutUser true "Updated user's any data"
+// @Param If-Match header string false "ETag of the profile the changes are based on"
 // @Security BearerAuth
 // @Success 200 {object} u.TableUser "Profile successfully updated."
 // @Failure 400 {object} string "failed to deserialize json request."
 // @Failure 400 {object} string "Login or email already used."
 // @Failure 404 {object} string "No such user."
+// @Failure 412 {object} string "Profile was changed since the ETag in If-Match."
 // @Failure 500 {object} string "Internal error."
 // @Router /user/profile [put]
 func UpdateUser(log *slog.Logger, User UserHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "http-server.handlers.user.UpdateUser"
 
-		log.With(util.SlogWith(op, r)...)
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
 
 		var req u.PutUser
 		if err := render.DecodeJSON(r.Body, &req); err != nil {
@@ -339,7 +381,14 @@ func UpdateUser(log *slog.Logger, User UserHandler) http.HandlerFunc {
 			return
 		}
 
-		n, err := User.UpdateUser(req, userContext.UserId)
+		version, ok := util.IfMatch(r)
+		if !ok {
+			log.Info("invalid If-Match header")
+			http.Error(w, "Profile was changed", http.StatusPreconditionFailed)
+			return
+		}
+
+		n, err := User.UpdateUser(r.Context(), req, userContext.UserId, version)
 		if err != nil {
 			if n == 0 {
 				log.Info(err.Error())
@@ -353,13 +402,19 @@ func UpdateUser(log *slog.Logger, User UserHandler) http.HandlerFunc {
 
 				http.Error(w, "Login or email already used", http.StatusBadRequest)
 
+				return
+			} else if n == -3 {
+				log.Info(err.Error())
+
+				http.Error(w, "Profile was changed", http.StatusPreconditionFailed)
+
 				return
 			}
 			util.InternalError(w, r, log, err)
 			return
 		}
 
-		user, err := User.Get(userContext.UserId)
+		user, err := User.Get(r.Context(), userContext.UserId)
 		if err != nil {
 			util.InternalError(w, r, log, err)
 			return
@@ -368,6 +423,105 @@ func UpdateUser(log *slog.Logger, User UserHandler) http.HandlerFunc {
 		log.Info("Successfully updated user")
 		log.Debug(fmt.Sprintf("user: %v to %v with email %v", userContext, req.Username, req.Email))
 
+		w.Header().Set("ETag", util.ETag(user.Version))
+		render.JSON(w, r, user)
+	}
+}
+
+// PatchProfile godoc
+// @Summary Partially update user profile
+// @Description Applies a JSON Merge Patch (application/merge-patch+json) or a JSON Patch (application/json-patch+json)
+// to the profile fields username, email and phoneNumber. Unlike PUT a patch can clear the phone number.
+// The result is validated like a PUT request and saved only if the profile was not changed in the meantime.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param Patch body object true "Merge patch object or JSON Patch operations"
+// @Param If-Match header string false "ETag of the profile the patch is based on"
+// @Security BearerAuth
+// @Success 200 {object} u.TableUser "Profile successfully updated."
+// @Failure 400 {object} string "Invalid patch or patched profile, or email already used."
+// @Failure 404 {object} string "No such user."
+// @Failure 409 {object} string "A test operation failed."
+// @Failure 412 {object} string "Profile was changed since the ETag in If-Match."
+// @Failure 415 {object} string "Unsupported patch content type."
+// @Failure 500 {object} string "Internal error."
+// @Router /user/profile [patch]
+func PatchProfile(log *slog.Logger, User UserHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "http-server.handlers.user.PatchProfile"
+
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
+
+		userContext, ok := r.Context().Value(access.CxtKey("userContext")).(access.UserContext)
+		if !ok {
+			http.Error(w, "User context not found", http.StatusUnauthorized)
+			return
+		}
+
+		version, ok := util.IfMatch(r)
+		if !ok {
+			log.Info("invalid If-Match header")
+			http.Error(w, "Profile was changed", http.StatusPreconditionFailed)
+			return
+		}
+
+		user, err := User.Get(r.Context(), userContext.UserId)
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		if version != 0 && version != user.Version {
+			log.Info(fmt.Sprintf("user %v has version %v, not %v", user.ID, user.Version, version))
+			http.Error(w, "Profile was changed", http.StatusPreconditionFailed)
+			return
+		}
+
+		current := u.PatchUser{Username: user.Username, Email: user.Email, PhoneNumber: user.PhoneNumber}
+
+		patched, ok := util.ApplyPatch(w, r, log, current)
+		if !ok {
+			return
+		}
+
+		n, err := User.PatchUser(r.Context(), patched, userContext.UserId, user.Version)
+		if err != nil {
+			if n == 0 {
+				log.Info(err.Error())
+
+				http.Error(w, "No such user", http.StatusNotFound)
+
+				return
+			} else if n == -2 {
+				log.Info(err.Error())
+
+				http.Error(w, "Login or email already used", http.StatusBadRequest)
+
+				return
+			} else if n == -3 {
+				log.Info(err.Error())
+
+				http.Error(w, "Profile was changed", http.StatusPreconditionFailed)
+
+				return
+			}
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		user, err = User.Get(r.Context(), userContext.UserId)
+		if err != nil {
+			util.InternalError(w, r, log, err)
+			return
+		}
+
+		log.Info("Successfully patched user")
+
+		w.Header().Set("ETag", util.ETag(user.Version))
 		render.JSON(w, r, user)
 	}
 }
@@ -390,7 +544,10 @@ func ChangePassword(log *slog.Logger, User UserHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "http-server.handlers.user.ChangePassword"
 
-		log.With(util.SlogWith(op, r)...)
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
 
 		userContext, ok := r.Context().Value(access.CxtKey("userContext")).(access.UserContext)
 		if !ok {
@@ -407,7 +564,7 @@ func ChangePassword(log *slog.Logger, User UserHandler) http.HandlerFunc {
 			return
 		}
 
-		user, err := User.ChangePassword(req, userContext.UserId)
+		user, err := User.ChangePassword(r.Context(), req, userContext.UserId)
 		if err != nil {
 			if err.Error() == "database.postgres.ChangePassword: no such user" {
 				log.Info(err.Error())
@@ -439,7 +596,10 @@ func Logout(log *slog.Logger, User UserHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "http-server.handlers.user.Logout"
 
-		log.With(util.SlogWith(op, r)...)
+		r, span := util.Trace(r, op)
+		defer span.End()
+
+		log := log.With(util.SlogWith(op, r)...)
 
 		userContext, ok := r.Context().Value(access.CxtKey("userContext")).(access.UserContext)
 		if !ok {
@@ -447,7 +607,7 @@ func Logout(log *slog.Logger, User UserHandler) http.HandlerFunc {
 			return
 		}
 
-		if err := User.Logout(userContext.UserId); err != nil {
+		if err := User.Logout(r.Context(), userContext.UserId); err != nil {
 			util.InternalError(w, r, log, err)
 			return
 		}
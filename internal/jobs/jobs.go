@@ -0,0 +1,247 @@
+// Package jobs runs background jobs stored in the jobs table. Workers claim due jobs with
+// FOR UPDATE SKIP LOCKED, so any number of workers in any number of instances share the queue.
+// A failed job is retried with exponential backoff until it runs out of attempts.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sabbatD/srest-api/internal/lib/backoff"
+	"github.com/sabbatD/srest-api/internal/lib/logger/sl"
+)
+
+// Statuses of a job. A failed job ran out of attempts, it waits to be retried by an admin.
+const (
+	Queued    = "queued"
+	Running   = "running"
+	Succeeded = "succeeded"
+	Failed    = "failed"
+)
+
+// DefaultMaxAttempts is used for jobs enqueued without MaxAttempts.
+const DefaultMaxAttempts = 5
+
+type Job struct {
+	ID          int64           `json:"id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"maxAttempts"`
+	RunAt       string          `json:"runAt"`
+	UniqueKey   *string         `json:"uniqueKey"`
+	LastError   string          `json:"lastError"`
+	Created     string          `json:"created"`
+	StartedAt   *string         `json:"startedAt"`
+	FinishedAt  *string         `json:"finishedAt"`
+}
+
+// Options of an enqueued job. A zero RunAt runs the job now. While a job with a UniqueKey is queued
+// or running, jobs with the same key are not enqueued.
+type Options struct {
+	RunAt       time.Time
+	UniqueKey   string
+	MaxAttempts int
+}
+
+// Query filters the jobs listed for admins, zero values match everything.
+type Query struct {
+	Status string
+	Kind   string
+	Limit  int
+	Offset int
+}
+
+type Enqueuer interface {
+	// EnqueueJob stores a job and returns its ID, 0 if a job with the same unique key is pending.
+	EnqueueJob(ctx context.Context, kind string, payload []byte, opts Options) (int64, error)
+}
+
+// Enqueue stores a job with the payload encoded as JSON. It returns 0 for a job skipped for its unique key.
+func Enqueue(ctx context.Context, q Enqueuer, kind string, payload any, opts Options) (int64, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	if opts.MaxAttempts == 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+
+	return q.EnqueueJob(ctx, kind, b, opts)
+}
+
+type Store interface {
+	// ClaimJob takes the oldest due job of the kinds and marks it running for lease.
+	// A running job whose lease ran out is due again, its worker is gone.
+	ClaimJob(ctx context.Context, kinds []string, lease time.Duration) (Job, bool, error)
+	CompleteJob(ctx context.Context, id int64) error
+	// FailJob records a failed attempt, a nil retry marks the job failed for good.
+	FailJob(ctx context.Context, id int64, msg string, retry *time.Time) error
+}
+
+// Handler runs a job. Jobs may run more than once, so handlers must be safe to repeat.
+type Handler func(ctx context.Context, job Job) error
+
+type WorkerOptions struct {
+	Concurrency  int
+	PollInterval time.Duration
+	Timeout      time.Duration
+	Backoff      time.Duration
+	MaxBackoff   time.Duration
+}
+
+type Worker struct {
+	store    Store
+	log      *slog.Logger
+	opts     WorkerOptions
+	handlers map[string]Handler
+
+	// loops and busy count the running polling loops and the ones running a job.
+	loops, busy atomic.Int32
+}
+
+// WorkerStatus tells how many of the Concurrency loops of a worker are running and how many of them run a job.
+type WorkerStatus struct {
+	Concurrency int `json:"concurrency"`
+	Running     int `json:"running"`
+	Busy        int `json:"busy"`
+}
+
+func (w *Worker) Status() WorkerStatus {
+	return WorkerStatus{Concurrency: w.opts.Concurrency, Running: int(w.loops.Load()), Busy: int(w.busy.Load())}
+}
+
+func NewWorker(store Store, log *slog.Logger, opts WorkerOptions) *Worker {
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+
+	return &Worker{store: store, log: log, opts: opts, handlers: map[string]Handler{}}
+}
+
+// Handle registers the handler of a kind of jobs. Handlers are registered before Run.
+func (w *Worker) Handle(kind string, h Handler) {
+	w.handlers[kind] = h
+}
+
+// Register registers a handler getting the payload of its jobs decoded into T.
+func Register[T any](w *Worker, kind string, h func(ctx context.Context, args T) error) {
+	w.Handle(kind, func(ctx context.Context, job Job) error {
+		var args T
+		if err := json.Unmarshal(job.Payload, &args); err != nil {
+			return fmt.Errorf("decode payload: %v", err)
+		}
+		return h(ctx, args)
+	})
+}
+
+// Run runs jobs with the configured concurrency until ctx is done and returns once the running jobs are over.
+// Only the kinds with handlers are claimed, other kinds are left to other workers.
+func (w *Worker) Run(ctx context.Context) {
+	kinds := make([]string, 0, len(w.handlers))
+	for kind := range w.handlers {
+		kinds = append(kinds, kind)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < w.opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.loop(ctx, kinds)
+		}()
+	}
+	wg.Wait()
+}
+
+func (w *Worker) loop(ctx context.Context, kinds []string) {
+	w.loops.Add(1)
+	defer w.loops.Add(-1)
+
+	ticker := time.NewTicker(w.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// The lease outlasts the timeout of the job, so no other worker takes it meanwhile.
+		job, ok, err := w.store.ClaimJob(ctx, kinds, w.opts.Timeout+time.Minute)
+		if err != nil {
+			w.log.Error("failed to claim job", sl.Err(err))
+		}
+
+		if ok {
+			w.busy.Add(1)
+			w.run(ctx, job)
+			w.busy.Add(-1)
+			if ctx.Err() == nil {
+				continue
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Worker) run(ctx context.Context, job Job) {
+	log := w.log.With(slog.Int64("job", job.ID), slog.String("kind", job.Kind), slog.Int("attempt", job.Attempts))
+
+	// A job started before shutdown is allowed to finish within its timeout.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), w.opts.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := w.call(ctx, job)
+
+	// The outcome is recorded even when the job ran out of its timeout.
+	record := context.WithoutCancel(ctx)
+	if err == nil {
+		if err := w.store.CompleteJob(record, job.ID); err != nil {
+			log.Error("failed to complete job", sl.Err(err))
+			return
+		}
+
+		log.Info("job succeeded", slog.Duration("took", time.Since(start)))
+		return
+	}
+
+	var retry *time.Time
+	if job.Attempts < job.MaxAttempts {
+		next := time.Now().Add(backoff.Exponential(job.Attempts, w.opts.Backoff, w.opts.MaxBackoff))
+		retry = &next
+	}
+
+	log.Error("job failed", slog.Bool("retry", retry != nil), sl.Err(err))
+
+	if err := w.store.FailJob(record, job.ID, err.Error(), retry); err != nil {
+		log.Error("failed to record failed job", sl.Err(err))
+	}
+}
+
+// call runs the handler of the job and turns a panic into an error.
+func (w *Worker) call(ctx context.Context, job Job) (err error) {
+	h, ok := w.handlers[job.Kind]
+	if !ok {
+		return errors.New("no handler")
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			w.log.Debug(string(debug.Stack()))
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return h(ctx, job)
+}
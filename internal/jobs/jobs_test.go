@@ -0,0 +1,141 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+type outcome struct {
+	done  bool
+	msg   string
+	retry *time.Time
+}
+
+type fakeStore struct {
+	mu       sync.Mutex
+	queue    []Job
+	outcomes map[int64]outcome
+	enqueued []Options
+}
+
+func (s *fakeStore) EnqueueJob(_ context.Context, kind string, payload []byte, opts Options) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.enqueued = append(s.enqueued, opts)
+	return int64(len(s.enqueued)), nil
+}
+
+func (s *fakeStore) ClaimJob(_ context.Context, kinds []string, lease time.Duration) (Job, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.queue) == 0 {
+		return Job{}, false, nil
+	}
+	job := s.queue[0]
+	s.queue = s.queue[1:]
+	job.Attempts++
+	return job, true, nil
+}
+
+func (s *fakeStore) CompleteJob(_ context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.outcomes[id] = outcome{done: true}
+	return nil
+}
+
+func (s *fakeStore) FailJob(_ context.Context, id int64, msg string, retry *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.outcomes[id] = outcome{msg: msg, retry: retry}
+	return nil
+}
+
+func TestEnqueue(t *testing.T) {
+	store := &fakeStore{}
+
+	if _, err := Enqueue(context.Background(), store, "email", map[string]string{"to": "user@example.com"}, Options{UniqueKey: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if store.enqueued[0].MaxAttempts != DefaultMaxAttempts || store.enqueued[0].UniqueKey != "a" {
+		t.Errorf("got %+v", store.enqueued[0])
+	}
+
+	if _, err := Enqueue(context.Background(), store, "email", func() {}, Options{}); err == nil {
+		t.Error("expected an error for a payload that can not be encoded")
+	}
+}
+
+func TestWorker(t *testing.T) {
+	store := &fakeStore{
+		outcomes: map[int64]outcome{},
+		queue: []Job{
+			{ID: 1, Kind: "email", Payload: []byte(`{"to":"user@example.com"}`), MaxAttempts: 3},
+			{ID: 2, Kind: "email", Payload: []byte(`{"to":""}`), MaxAttempts: 3},
+			{ID: 3, Kind: "email", Payload: []byte(`{"to":""}`), Attempts: 2, MaxAttempts: 3},
+			{ID: 4, Kind: "panic", Payload: []byte(`{}`), MaxAttempts: 3},
+			{ID: 5, Kind: "unknown", Payload: []byte(`{}`), MaxAttempts: 3},
+			{ID: 6, Kind: "email", Payload: []byte(`[]`), MaxAttempts: 3},
+		},
+	}
+
+	w := NewWorker(store, slog.New(slog.NewTextHandler(io.Discard, nil)), WorkerOptions{
+		Concurrency: 2, PollInterval: 10 * time.Millisecond, Timeout: time.Second, Backoff: time.Minute, MaxBackoff: time.Hour,
+	})
+
+	var mu sync.Mutex
+	var sent []string
+	Register(w, "email", func(ctx context.Context, args struct{ To string }) error {
+		if args.To == "" {
+			return errors.New("no recipient")
+		}
+		mu.Lock()
+		sent = append(sent, args.To)
+		mu.Unlock()
+		return nil
+	})
+	w.Handle("panic", func(ctx context.Context, job Job) error { panic("boom") })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for {
+			store.mu.Lock()
+			n := len(store.outcomes)
+			store.mu.Unlock()
+			if n == 6 {
+				cancel()
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+	w.Run(ctx)
+
+	if len(sent) != 1 || sent[0] != "user@example.com" || !store.outcomes[1].done {
+		t.Errorf("job 1: sent %v, outcome %+v", sent, store.outcomes[1])
+	}
+	if o := store.outcomes[2]; o.done || o.retry == nil || o.msg != "no recipient" {
+		t.Errorf("job 2 should be retried: %+v", o)
+	}
+	if o := store.outcomes[3]; o.done || o.retry != nil {
+		t.Errorf("job 3 ran out of attempts: %+v", o)
+	}
+	if o := store.outcomes[4]; o.done || o.msg != "panic: boom" {
+		t.Errorf("job 4: %+v", o)
+	}
+	if o := store.outcomes[5]; o.done || o.msg != "no handler" {
+		t.Errorf("job 5: %+v", o)
+	}
+	if o := store.outcomes[6]; o.done || o.retry == nil {
+		t.Errorf("job 6 has a payload of the wrong type: %+v", o)
+	}
+}
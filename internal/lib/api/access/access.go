@@ -2,6 +2,10 @@ package access
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"github.com/sabbatD/srest-api/internal/database"
 	"net/http"
 	"strconv"
@@ -59,6 +63,74 @@ func NewRefreshToken() (string, error) {
 	return tokenString, nil
 }
 
+// NewFeedToken returns a random calendar feed token. Only its hash is stored, see HashFeedToken.
+func NewFeedToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func HashFeedToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// OptionalJWTAuthMiddleware lets anonymous requests through without a user context.
+// A request that does send a token is authenticated like by JWTAuthMiddleware.
+func OptionalJWTAuthMiddleware(next http.Handler) http.Handler {
+	auth := JWTAuthMiddleware(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		auth.ServeHTTP(w, r)
+	})
+}
+
+// StripQueryToken moves the access_token query parameter from the URL to the request context,
+// so that the request log does not show the token. It has to run before the logger.
+func StripQueryToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if !query.Has("access_token") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := query.Get("access_token")
+		query.Del("access_token")
+
+		r = r.WithContext(context.WithValue(r.Context(), CxtKey("queryToken"), token))
+		url := *r.URL
+		url.RawQuery = query.Encode()
+		r.URL = &url
+		r.RequestURI = url.RequestURI()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// QueryJWTAuthMiddleware also takes the token from the access_token query parameter, which StripQueryToken
+// moved to the context, for EventSource and WebSocket clients that can not send the Authorization header.
+func QueryJWTAuthMiddleware(next http.Handler) http.Handler {
+	auth := JWTAuthMiddleware(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token, _ := r.Context().Value(CxtKey("queryToken")).(string); token != "" && r.Header.Get("Authorization") == "" {
+			r = r.Clone(r.Context())
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		auth.ServeHTTP(w, r)
+	})
+}
+
 func JWTAuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
@@ -0,0 +1,27 @@
+package access
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStripQueryToken(t *testing.T) {
+	var got *http.Request
+	h := StripQueryToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/todos/stream?access_token=secret&lastEventId=7", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got.RequestURI != "/api/v1/todos/stream?lastEventId=7" || got.URL.RawQuery != "lastEventId=7" {
+		t.Errorf("got %q, %q", got.RequestURI, got.URL.RawQuery)
+	}
+	if token, _ := got.Context().Value(CxtKey("queryToken")).(string); token != "secret" {
+		t.Errorf("got token %q", token)
+	}
+	if req.URL.RawQuery != "access_token=secret&lastEventId=7" {
+		t.Errorf("the original request changed: %q", req.URL.RawQuery)
+	}
+}
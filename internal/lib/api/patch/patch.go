@@ -0,0 +1,47 @@
+// Package patch applies JSON Merge Patch (RFC 7396) and JSON Patch (RFC 6902) documents.
+package patch
+
+import (
+	"errors"
+	"mime"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+const (
+	MergePatch = "application/merge-patch+json"
+	JSONPatch  = "application/json-patch+json"
+)
+
+var (
+	ErrUnsupportedMediaType = errors.New("unsupported patch media type")
+	// ErrTestFailed is returned when a test operation of a JSON Patch does not match the document.
+	ErrTestFailed = errors.New("patch test operation failed")
+)
+
+// Apply applies the patch of the given content type to the JSON document doc.
+func Apply(contentType string, doc, patch []byte) ([]byte, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, ErrUnsupportedMediaType
+	}
+
+	switch mediaType {
+	case MergePatch:
+		return jsonpatch.MergePatch(doc, patch)
+	case JSONPatch:
+		p, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := p.Apply(doc)
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			return nil, ErrTestFailed
+		}
+
+		return result, err
+	default:
+		return nil, ErrUnsupportedMediaType
+	}
+}
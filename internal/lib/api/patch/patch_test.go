@@ -0,0 +1,73 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	doc := `{"title":"a","due":"2026-10-20T00:00:00Z","priority":1}`
+
+	tests := []struct {
+		name        string
+		contentType string
+		patch       string
+		want        string
+		wantErr     error
+	}{
+		{
+			name:        "merge patch clears a field",
+			contentType: MergePatch,
+			patch:       `{"due":null,"title":"b"}`,
+			want:        `{"title":"b","priority":1}`,
+		},
+		{
+			name:        "merge patch with charset",
+			contentType: MergePatch + "; charset=utf-8",
+			patch:       `{"priority":2}`,
+			want:        `{"title":"a","due":"2026-10-20T00:00:00Z","priority":2}`,
+		},
+		{
+			name:        "json patch",
+			contentType: JSONPatch,
+			patch:       `[{"op":"test","path":"/title","value":"a"},{"op":"replace","path":"/title","value":"b"},{"op":"remove","path":"/due"}]`,
+			want:        `{"title":"b","priority":1}`,
+		},
+		{
+			name:        "json patch failed test",
+			contentType: JSONPatch,
+			patch:       `[{"op":"test","path":"/title","value":"x"}]`,
+			wantErr:     ErrTestFailed,
+		},
+		{
+			name:        "plain json",
+			contentType: "application/json",
+			patch:       `{}`,
+			wantErr:     ErrUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply(tt.contentType, []byte(doc), []byte(tt.patch))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Apply() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+
+			var gotV, wantV any
+			json.Unmarshal(got, &gotV)
+			json.Unmarshal([]byte(tt.want), &wantV)
+			if !reflect.DeepEqual(gotV, wantV) {
+				t.Errorf("Apply() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
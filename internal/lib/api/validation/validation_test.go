@@ -160,3 +160,53 @@ func TestValidateStruct2(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateBulkRequest(t *testing.T) {
+	InitValidator()
+
+	tests := []struct {
+		name    string
+		args    todoconfig.BulkRequest
+		wantErr bool
+	}{
+		{
+			name: "ids",
+			args: todoconfig.BulkRequest{Action: "complete", IDs: []int{1, 2}},
+		},
+		{
+			name: "where",
+			args: todoconfig.BulkRequest{Action: "delete", Where: &todoconfig.BulkWhere{Filter: "completed"}},
+		},
+		{
+			name:    "no targets",
+			args:    todoconfig.BulkRequest{Action: "delete"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown action",
+			args:    todoconfig.BulkRequest{Action: "archive", IDs: []int{1}},
+			wantErr: true,
+		},
+		{
+			name:    "tag without tags",
+			args:    todoconfig.BulkRequest{Action: "tag", IDs: []int{1}},
+			wantErr: true,
+		},
+		{
+			name: "tag",
+			args: todoconfig.BulkRequest{Action: "tag", IDs: []int{1}, Tags: []string{"home"}},
+		},
+		{
+			name:    "invalid filter",
+			args:    todoconfig.BulkRequest{Action: "complete", Where: &todoconfig.BulkWhere{Filter: "done"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateStruct(tt.args); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateStruct() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+// Package backoff computes the delays between retries.
+package backoff
+
+import "time"
+
+// Exponential returns the delay before the retry following the given attempt: base doubled
+// with every failed attempt, at most max.
+func Exponential(attempt int, base, max time.Duration) time.Duration {
+	d := base
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if d >= max {
+			return max
+		}
+	}
+	return min(d, max)
+}
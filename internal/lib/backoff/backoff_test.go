@@ -0,0 +1,25 @@
+package backoff
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExponential(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{4, 4 * time.Minute},
+		{10, time.Hour},
+		{100, time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := Exponential(tt.attempt, 30*time.Second, time.Hour); got != tt.want {
+			t.Errorf("Exponential(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
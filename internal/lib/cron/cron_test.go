@@ -0,0 +1,62 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	// Monday.
+	from := time.Date(2026, 10, 19, 12, 34, 56, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2026, 10, 19, 12, 35, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, 10, 19, 13, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2026, 10, 20, 3, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 10, 19, 12, 45, 0, 0, time.UTC)},
+		{"30 9-17/4 * * *", time.Date(2026, 10, 19, 13, 30, 0, 0, time.UTC)},
+		{"0 0 * * sun", time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 jan *", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 31 * *", time.Date(2026, 10, 31, 12, 0, 0, 0, time.UTC)},
+		{"0 12 30 2 *", time.Time{}},
+		{"0 12 29 2 *", time.Date(2028, 2, 29, 12, 0, 0, 0, time.UTC)},
+		// Day of month or day of week when both are restricted: Wednesday comes before the 1st.
+		{"0 0 1 * wed", time.Date(2026, 10, 21, 0, 0, 0, 0, time.UTC)},
+		{"5,10 12 * * *", time.Date(2026, 10, 20, 12, 5, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestNextLocation(t *testing.T) {
+	msk := time.FixedZone("UTC+3", 3*3600)
+	s, _ := Parse("0 3 * * *")
+
+	got := s.Next(time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC).In(msk))
+	if want := time.Date(2026, 10, 20, 3, 0, 0, 0, msk); !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8",
+		"*/0 * * * *", "5-1 * * * *", "a * * * *", "* * * foo *", "@never"} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q): expected an error", expr)
+		}
+	}
+}
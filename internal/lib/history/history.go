@@ -0,0 +1,66 @@
+// Package history computes the field level changes recorded for every version of a task.
+package history
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// Change is the value of a field before and after an event.
+type Change struct {
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+// ignored fields never change or only change together with another field.
+var ignored = map[string]bool{"id": true, "created": true}
+
+// Diff returns the changed fields of before and after by their JSON names.
+// A nil before is a creation, every set field of after is reported as changed.
+func Diff(before, after any) (map[string]Change, error) {
+	old, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]Change)
+	for name, val := range cur {
+		if ignored[name] || reflect.DeepEqual(old[name], val) {
+			continue
+		}
+		changes[name] = Change{Old: old[name], New: val}
+	}
+	for name, val := range old {
+		if _, ok := cur[name]; !ok && !ignored[name] {
+			changes[name] = Change{Old: val}
+		}
+	}
+
+	return changes, nil
+}
+
+func fields(v any) (map[string]any, error) {
+	m := map[string]any{}
+	if v == nil {
+		return m, nil
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return m, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
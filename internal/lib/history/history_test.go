@@ -0,0 +1,67 @@
+package history
+
+import (
+	"reflect"
+	"testing"
+)
+
+type task struct {
+	ID      int     `json:"id"`
+	Created string  `json:"created"`
+	Title   string  `json:"title"`
+	Due     *string `json:"due"`
+	Deleted *string `json:"deletedAt,omitempty"`
+}
+
+func TestDiff(t *testing.T) {
+	due := "2026-10-20T00:00:00Z"
+
+	tests := []struct {
+		name          string
+		before, after any
+		want          map[string]Change
+	}{
+		{
+			name:   "create",
+			before: (*task)(nil),
+			after:  &task{ID: 1, Created: "now", Title: "a"},
+			want:   map[string]Change{"title": {New: "a"}},
+		},
+		{
+			name:   "unchanged",
+			before: &task{ID: 1, Title: "a"},
+			after:  &task{ID: 1, Title: "a"},
+			want:   map[string]Change{},
+		},
+		{
+			name:   "set and clear",
+			before: &task{ID: 1, Title: "a", Due: &due},
+			after:  &task{ID: 1, Title: "b"},
+			want:   map[string]Change{"title": {Old: "a", New: "b"}, "due": {Old: due}},
+		},
+		{
+			name:   "omitted field",
+			before: &task{ID: 1, Title: "a"},
+			after:  &task{ID: 1, Title: "a", Deleted: &due},
+			want:   map[string]Change{"deletedAt": {New: due}},
+		},
+		{
+			name:   "omitted field removed",
+			before: task{ID: 1, Title: "a", Deleted: &due},
+			after:  task{ID: 1, Title: "a"},
+			want:   map[string]Change{"deletedAt": {Old: due}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Diff(tt.before, tt.after)
+			if err != nil {
+				t.Fatalf("Diff() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+// Package mention finds @username mentions in markdown text.
+package mention
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Usernames are alphanumunicode, see userConfig.User. A mention must not be glued to a
+// preceding word character, so e-mail addresses are not mentions.
+var mentionRe = regexp.MustCompile(`(?:^|[^\p{L}\p{N}@])@([\p{L}\p{N}]+)`)
+
+// codeRe matches fenced and inline markdown code, mentions inside code are ignored.
+var codeRe = regexp.MustCompile("(?s)```.*?```|`[^`\n]*`")
+
+// Parse returns the mentioned usernames in order of first appearance, without duplicates.
+func Parse(body string) []string {
+	body = codeRe.ReplaceAllString(body, " ")
+
+	var names []string
+	seen := make(map[string]bool)
+
+	for _, m := range mentionRe.FindAllStringSubmatch(body, -1) {
+		name := m[1]
+		if seen[strings.ToLower(name)] {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// New returns the usernames mentioned in body that were not mentioned in old.
+func New(old, body string) []string {
+	before := make(map[string]bool)
+	for _, name := range Parse(old) {
+		before[strings.ToLower(name)] = true
+	}
+
+	var names []string
+	for _, name := range Parse(body) {
+		if !before[strings.ToLower(name)] {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,37 @@
+package mention
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{name: "none", body: "just a comment", want: nil},
+		{name: "single", body: "@alice please review", want: []string{"alice"}},
+		{name: "several", body: "cc @alice, @bob and @Alice", want: []string{"alice", "bob"}},
+		{name: "unicode", body: "спасибо @Вася!", want: []string{"Вася"}},
+		{name: "email", body: "write to bob@example.com", want: nil},
+		{name: "markdown", body: "**@alice** see [link](http://x) _@bob_", want: []string{"alice", "bob"}},
+		{name: "code", body: "`@alice` and\n```\n@bob\n```\n@carol", want: []string{"carol"}},
+		{name: "double at", body: "@@alice", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Parse(tt.body); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	got := New("@alice hi", "@alice hi, @bob")
+	if !reflect.DeepEqual(got, []string{"bob"}) {
+		t.Errorf("New() = %v, want [bob]", got)
+	}
+}
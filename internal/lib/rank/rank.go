@@ -0,0 +1,123 @@
+// Package rank generates lexicographic ranks used for manual ordering.
+// A rank is a string over the base36 alphabet that never ends with '0', so there is
+// always room for another rank between any two distinct ranks. Ranks must be compared
+// byte-wise (COLLATE "C" on the database side).
+package rank
+
+import (
+	"fmt"
+	"strings"
+)
+
+const digits = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// Between returns a rank that sorts strictly after a and strictly before b.
+// An empty a means "before everything", an empty b means "after everything".
+func Between(a, b string) (string, error) {
+	const op = "rank.Between"
+
+	if err := check(a); err != nil {
+		return "", fmt.Errorf("%s: %v", op, err)
+	}
+	if err := check(b); err != nil {
+		return "", fmt.Errorf("%s: %v", op, err)
+	}
+	if b != "" && a >= b {
+		return "", fmt.Errorf("%s: %q is not before %q", op, a, b)
+	}
+
+	if b == "" && a != "" {
+		return after(a), nil
+	}
+
+	return midpoint(a, b), nil
+}
+
+// after returns a rank after a for appending. Halving the space after the last rank would make every
+// append longer than the one before, so after steps up by one in the last digit of a fixed width instead.
+// The ranks starting with n 'z's use 2n+1 digits: the widths grow with the logarithm of the number of
+// appends and there is still room after each width for the next one.
+func after(a string) string {
+	z := 0
+	for z < len(a) && a[z] == digits[len(digits)-1] {
+		z++
+	}
+
+	width := 2*z + 1
+	next := []byte(a)
+	if len(next) > width {
+		next = next[:width]
+	}
+	for len(next) < width {
+		next = append(next, digits[0])
+	}
+
+	// The digit at z is not a 'z', so the carry stops there at the latest.
+	for i := width - 1; i >= z; i-- {
+		d := strings.IndexByte(digits, next[i]) + 1
+		if d < len(digits) {
+			next[i] = digits[d]
+			break
+		}
+		next[i] = digits[0]
+	}
+
+	return strings.TrimRight(string(next), digits[:1])
+}
+
+func midpoint(a, b string) string {
+	if b != "" {
+		n := 0
+		for n < len(b) && digitAt(a, n) == b[n] {
+			n++
+		}
+		if n > 0 {
+			return b[:n] + midpoint(suffix(a, n), b[n:])
+		}
+	}
+
+	da := 0
+	if a != "" {
+		da = strings.IndexByte(digits, a[0])
+	}
+	db := len(digits)
+	if b != "" {
+		db = strings.IndexByte(digits, b[0])
+	}
+
+	if db-da > 1 {
+		return string(digits[(da+db)/2])
+	}
+
+	if len(b) > 1 {
+		return b[:1]
+	}
+
+	return string(digits[da]) + midpoint(suffix(a, 1), "")
+}
+
+func digitAt(s string, i int) byte {
+	if i < len(s) {
+		return s[i]
+	}
+	return digits[0]
+}
+
+func suffix(s string, i int) string {
+	if i >= len(s) {
+		return ""
+	}
+	return s[i:]
+}
+
+func check(s string) error {
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(digits, s[i]) < 0 {
+			return fmt.Errorf("invalid rank %q", s)
+		}
+	}
+	if strings.HasSuffix(s, digits[:1]) {
+		return fmt.Errorf("rank %q ends with %q", s, digits[:1])
+	}
+	return nil
+}
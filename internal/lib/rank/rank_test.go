@@ -0,0 +1,86 @@
+package rank
+
+import "testing"
+
+func TestBetween(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    string
+		wantErr bool
+	}{
+		{name: "empty", a: "", b: ""},
+		{name: "first", a: "", b: "i"},
+		{name: "last", a: "i", b: ""},
+		{name: "adjacent", a: "a", b: "b"},
+		{name: "prefix", a: "1", b: "105"},
+		{name: "backfilled", a: "00000001i", b: "00000002i"},
+		{name: "deep", a: "azzzzz", b: "b"},
+		{name: "equal", a: "i", b: "i", wantErr: true},
+		{name: "reversed", a: "z", b: "a", wantErr: true},
+		{name: "trailing zero", a: "10", b: "2", wantErr: true},
+		{name: "bad symbol", a: "A", b: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Between(tt.a, tt.b)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Between() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got <= tt.a || (tt.b != "" && got >= tt.b) {
+				t.Errorf("Between(%q, %q) = %q, not in between", tt.a, tt.b, got)
+			}
+		})
+	}
+}
+
+func TestBetweenRepeated(t *testing.T) {
+	lo, hi := "", "1"
+	for i := 0; i < 200; i++ {
+		mid, err := Between(lo, hi)
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if mid <= lo || mid >= hi {
+			t.Fatalf("step %d: Between(%q, %q) = %q", i, lo, hi, mid)
+		}
+		if i%2 == 0 {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+}
+
+func TestBetweenAppend(t *testing.T) {
+	// The first rank of a list is "i", longer ones were left by appends before the ranks had widths.
+	tests := []struct {
+		start string
+		limit int
+	}{
+		{start: "i", limit: 5},
+		{start: "y0000000001", limit: 11},
+		{start: "zzzzzzzzzzi", limit: 21},
+	}
+	for _, tt := range tests {
+		last := tt.start
+		for i := 0; i < 20000; i++ {
+			next, err := Between(last, "")
+			if err != nil {
+				t.Fatalf("%s step %d: %v", tt.start, i, err)
+			}
+			if next <= last {
+				t.Fatalf("%s step %d: Between(%q, \"\") = %q", tt.start, i, last, next)
+			}
+			if err := check(next); err != nil {
+				t.Fatalf("%s step %d: %v", tt.start, i, err)
+			}
+			if len(next) > tt.limit {
+				t.Fatalf("%s step %d: rank grew to %d digits: %q", tt.start, i, len(next), next)
+			}
+			last = next
+		}
+	}
+}
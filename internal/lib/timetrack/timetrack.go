@@ -0,0 +1,218 @@
+// Package timetrack sums up the time tracked on tasks by task, list, tag or day.
+package timetrack
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	ByTask = "task"
+	ByList = "list"
+	ByTag  = "tag"
+	ByDay  = "day"
+)
+
+const dayLayout = "2006-01-02"
+
+var ErrUnknownGroup = errors.New("unknown group")
+
+// Entry is an interval tracked on a task. A running timer has a zero End.
+type Entry struct {
+	TodoID int
+	Title  string
+	ListID *int
+	List   string
+	Tags   []string
+	Start  time.Time
+	End    time.Time
+}
+
+// Row is the time tracked in a group. ID is the task or the list of the group,
+// it is not set for days, tags and tasks without a list.
+type Row struct {
+	Group   string `json:"group"`
+	ID      *int   `json:"id,omitempty"`
+	Seconds int64  `json:"seconds"`
+	Entries int    `json:"entries"`
+}
+
+// Aggregate sums the part of the entries between from and to by group, a zero bound is open.
+// Running timers count up to now. Days are calendar days in loc, an entry crossing midnight is split between them.
+// An entry counts in every tag of its task, tasks without tags are grouped under an empty tag.
+// Days are sorted in order, other groups by the tracked time, longest first.
+func Aggregate(entries []Entry, by string, from, to, now time.Time, loc *time.Location) ([]Row, error) {
+	if by != ByTask && by != ByList && by != ByTag && by != ByDay {
+		return nil, ErrUnknownGroup
+	}
+
+	rows := map[string]*Row{}
+	var order []string
+
+	add := func(key, group string, id *int, d time.Duration) {
+		row, ok := rows[key]
+		if !ok {
+			row = &Row{Group: group, ID: id}
+			rows[key] = row
+			order = append(order, key)
+		}
+		row.Seconds += int64(d / time.Second)
+		row.Entries++
+	}
+
+	for _, e := range entries {
+		start, end := clip(e, from, to, now)
+		if !end.After(start) {
+			continue
+		}
+
+		switch by {
+		case ByTask:
+			id := e.TodoID
+			add(strconv.Itoa(id), e.Title, &id, end.Sub(start))
+		case ByList:
+			key := ""
+			if e.ListID != nil {
+				key = strconv.Itoa(*e.ListID)
+			}
+			add(key, e.List, e.ListID, end.Sub(start))
+		case ByTag:
+			tags := e.Tags
+			if len(tags) == 0 {
+				tags = []string{""}
+			}
+			for _, tag := range tags {
+				add(tag, tag, nil, end.Sub(start))
+			}
+		case ByDay:
+			for day := start.In(loc); day.Before(end); {
+				y, m, d := day.Date()
+				next := time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+				if next.After(end) {
+					next = end
+				}
+				key := day.Format(dayLayout)
+				add(key, key, nil, next.Sub(day))
+				day = next.In(loc)
+			}
+		}
+	}
+
+	result := make([]Row, 0, len(order))
+	for _, key := range order {
+		result = append(result, *rows[key])
+	}
+
+	if by == ByDay {
+		sort.Slice(result, func(i, j int) bool { return result[i].Group < result[j].Group })
+	} else {
+		sort.SliceStable(result, func(i, j int) bool {
+			if result[i].Seconds != result[j].Seconds {
+				return result[i].Seconds > result[j].Seconds
+			}
+			return result[i].Group < result[j].Group
+		})
+	}
+
+	return result, nil
+}
+
+// Total sums the part of the entries between from and to like Aggregate does. Unlike the rows of tags,
+// it counts every entry once.
+func Total(entries []Entry, from, to, now time.Time) int64 {
+	var total int64
+	for _, e := range entries {
+		if start, end := clip(e, from, to, now); end.After(start) {
+			total += int64(end.Sub(start) / time.Second)
+		}
+	}
+	return total
+}
+
+func clip(e Entry, from, to, now time.Time) (time.Time, time.Time) {
+	start, end := e.Start, e.End
+	if end.IsZero() {
+		end = now
+	}
+	if !from.IsZero() && start.Before(from) {
+		start = from
+	}
+	if !to.IsZero() && end.After(to) {
+		end = to
+	}
+	return start, end
+}
+
+// ParseRange parses the bounds of a report. A bound is either RFC 3339 or a date in loc,
+// the date of to is included in the range. An empty bound stays zero.
+func ParseRange(from, to string, loc *time.Location) (time.Time, time.Time, error) {
+	start, err := parseBound(from, loc, false)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %q", from)
+	}
+
+	end, err := parseBound(to, loc, true)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %q", to)
+	}
+
+	if !start.IsZero() && !end.IsZero() && !end.After(start) {
+		return time.Time{}, time.Time{}, errors.New("to is not after from")
+	}
+
+	return start, end, nil
+}
+
+func parseBound(s string, loc *time.Location, inclusive bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation(dayLayout, s, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if inclusive {
+		t = t.AddDate(0, 0, 1)
+	}
+
+	return t, nil
+}
+
+// WriteCSV writes the rows with the tracked time in seconds and in hours.
+func WriteCSV(w io.Writer, rows []Row) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"group", "id", "seconds", "hours", "entries"}); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		id := ""
+		if row.ID != nil {
+			id = strconv.Itoa(*row.ID)
+		}
+
+		record := []string{
+			row.Group,
+			id,
+			strconv.FormatInt(row.Seconds, 10),
+			strconv.FormatFloat(float64(row.Seconds)/3600, 'f', 2, 64),
+			strconv.Itoa(row.Entries),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
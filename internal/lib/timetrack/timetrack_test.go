@@ -0,0 +1,139 @@
+package timetrack
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+var (
+	now     = time.Date(2026, 10, 20, 12, 0, 0, 0, time.UTC)
+	entries = []Entry{
+		{TodoID: 1, Title: "Write", ListID: ptr(5), List: "Work", Tags: []string{"docs", "urgent"},
+			Start: time.Date(2026, 10, 18, 23, 0, 0, 0, time.UTC), End: time.Date(2026, 10, 19, 1, 0, 0, 0, time.UTC)},
+		{TodoID: 2, Title: "Shop", Start: time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC), End: time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC)},
+		{TodoID: 1, Title: "Write", ListID: ptr(5), List: "Work", Tags: []string{"docs", "urgent"},
+			Start: time.Date(2026, 10, 20, 11, 0, 0, 0, time.UTC)},
+	}
+)
+
+func TestAggregate(t *testing.T) {
+	tests := []struct {
+		name     string
+		by       string
+		from, to time.Time
+		loc      *time.Location
+		want     []Row
+	}{
+		{
+			name: "task",
+			by:   ByTask,
+			want: []Row{{Group: "Write", ID: ptr(1), Seconds: 3 * 3600, Entries: 2}, {Group: "Shop", ID: ptr(2), Seconds: 1800, Entries: 1}},
+		},
+		{
+			name: "list",
+			by:   ByList,
+			want: []Row{{Group: "Work", ID: ptr(5), Seconds: 3 * 3600, Entries: 2}, {Group: "", Seconds: 1800, Entries: 1}},
+		},
+		{
+			name: "tag",
+			by:   ByTag,
+			want: []Row{
+				{Group: "docs", Seconds: 3 * 3600, Entries: 2},
+				{Group: "urgent", Seconds: 3 * 3600, Entries: 2},
+				{Group: "", Seconds: 1800, Entries: 1},
+			},
+		},
+		{
+			name: "day splits at midnight",
+			by:   ByDay,
+			loc:  time.UTC,
+			want: []Row{
+				{Group: "2026-10-18", Seconds: 3600, Entries: 1},
+				{Group: "2026-10-19", Seconds: 3600 + 1800, Entries: 2},
+				{Group: "2026-10-20", Seconds: 3600, Entries: 1},
+			},
+		},
+		{
+			name: "day in another zone",
+			by:   ByDay,
+			loc:  time.FixedZone("UTC+3", 3*3600),
+			want: []Row{
+				{Group: "2026-10-19", Seconds: 2*3600 + 1800, Entries: 2},
+				{Group: "2026-10-20", Seconds: 3600, Entries: 1},
+			},
+		},
+		{
+			name: "range",
+			by:   ByTask,
+			from: time.Date(2026, 10, 19, 0, 30, 0, 0, time.UTC),
+			to:   time.Date(2026, 10, 19, 9, 15, 0, 0, time.UTC),
+			want: []Row{{Group: "Write", ID: ptr(1), Seconds: 1800, Entries: 1}, {Group: "Shop", ID: ptr(2), Seconds: 900, Entries: 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Aggregate(entries, tt.by, tt.from, tt.to, now, tt.loc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Aggregate(entries, "user", time.Time{}, time.Time{}, now, time.UTC); err != ErrUnknownGroup {
+		t.Errorf("got %v, want ErrUnknownGroup", err)
+	}
+}
+
+func TestTotal(t *testing.T) {
+	if got := Total(entries, time.Time{}, time.Time{}, now); got != 3*3600+1800 {
+		t.Errorf("got %d, want %d", got, 3*3600+1800)
+	}
+
+	from := time.Date(2026, 10, 19, 0, 30, 0, 0, time.UTC)
+	if got := Total(entries, from, time.Time{}, now); got != 1800+1800+3600 {
+		t.Errorf("from %v: got %d, want %d", from, got, 1800+1800+3600)
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	msk := time.FixedZone("UTC+3", 3*3600)
+
+	from, to, err := ParseRange("2026-10-01", "2026-10-31", msk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !from.Equal(time.Date(2026, 9, 30, 21, 0, 0, 0, time.UTC)) || !to.Equal(time.Date(2026, 10, 31, 21, 0, 0, 0, time.UTC)) {
+		t.Errorf("got %v - %v", from, to)
+	}
+
+	from, to, err = ParseRange("2026-10-01T10:00:00Z", "", msk)
+	if err != nil || !from.Equal(time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC)) || !to.IsZero() {
+		t.Errorf("got %v - %v, %v", from, to, err)
+	}
+
+	for _, r := range [][2]string{{"yesterday", ""}, {"", "2026-13-01"}, {"2026-10-02", "2026-10-01"}} {
+		if _, _, err := ParseRange(r[0], r[1], msk); err == nil {
+			t.Errorf("ParseRange(%q, %q): expected an error", r[0], r[1])
+		}
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, []Row{{Group: "Work, home", ID: ptr(5), Seconds: 5400, Entries: 2}, {Group: "", Seconds: 60, Entries: 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "group,id,seconds,hours,entries\n\"Work, home\",5,5400,1.50,2\n,,60,0.02,1\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
@@ -1,17 +1,51 @@
 package todoconfig
 
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/sabbatD/srest-api/internal/lib/history"
+	"github.com/sabbatD/srest-api/internal/lib/timetrack"
+)
+
 type Todo struct {
-	ID      uint   `json:"id"`
-	Title   string `json:"title"`
-	Created string `json:"created"`
-	IsDone  bool   `json:"isDone"`
+	ID        uint     `json:"id"`
+	Title     string   `json:"title"`
+	Created   string   `json:"created"`
+	IsDone    bool     `json:"isDone"`
+	Status    string   `json:"status"`
+	ListID    *int     `json:"listId"`
+	Rank      string   `json:"rank"`
+	Due       *string  `json:"due"`
+	Priority  int      `json:"priority"`
+	Tags      []string `json:"tags"`
+	OwnerID   *int     `json:"ownerId"`
+	DeletedAt *string  `json:"deletedAt,omitempty"`
+	// Version is sent as the ETag header, it changes with every update of the task.
+	Version int `json:"-"`
 }
 
 type Todos []Todo
 
 type TodoRequest struct {
-	Title  string `json:"title,omitempty"`
-	IsDone *bool  `json:"isDone,omitempty"`
+	Title    string   `json:"title,omitempty"`
+	IsDone   *bool    `json:"isDone,omitempty"`
+	Status   *string  `json:"status,omitempty" validate:"omitempty,min=1,max=60"`
+	ListID   *int     `json:"listId,omitempty" validate:"omitempty,min=1"`
+	Due      *string  `json:"due,omitempty" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	Priority *int     `json:"priority,omitempty" validate:"omitempty,min=0,max=3"`
+	Tags     []string `json:"tags,omitempty" validate:"omitempty,max=20,dive,min=1,max=40"`
+}
+
+// TodoPatch is the task a patch is applied to. Unlike TodoRequest every field is sent,
+// so a patch can clear the due date. The list is changed with a move.
+type TodoPatch struct {
+	Title    string   `json:"title" validate:"required"`
+	IsDone   bool     `json:"isDone"`
+	Status   string   `json:"status" validate:"required,min=1,max=60"`
+	Due      *string  `json:"due" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	Priority int      `json:"priority" validate:"min=0,max=3"`
+	Tags     []string `json:"tags" validate:"max=20,dive,min=1,max=40"`
 }
 
 type TodoInfo struct {
@@ -21,7 +55,10 @@ type TodoInfo struct {
 }
 
 type Meta struct {
-	TotalAmount int `json:"totalAmount"`
+	TotalAmount int    `json:"totalAmount"`
+	SortBy      string `json:"sortBy"`
+	SortOrder   string `json:"sortOrder"`
+	NextCursor  string `json:"nextCursor,omitempty"`
 }
 
 type MetaResponse struct {
@@ -29,3 +66,212 @@ type MetaResponse struct {
 	Info TodoInfo `json:"info"`
 	Meta Meta     `json:"meta"`
 }
+
+type GetAllQuery struct {
+	// UserID sees the tasks of Scope: "mine", "shared" or "all" of the tasks visible to the user.
+	UserID     int
+	Scope      string
+	Filter     string
+	Status     string
+	ListID     *int
+	SearchTerm string
+	SortBy     string
+	SortOrder  string
+	Limit      int
+	Cursor     string
+}
+
+type DependencyRequest struct {
+	BlockedBy int `json:"blockedBy" validate:"required,min=1"`
+}
+
+// MoveRequest places a task right before or right after an anchor task.
+// Without an anchor the task is moved to the end of ListID.
+type MoveRequest struct {
+	Before *int `json:"before,omitempty" validate:"omitempty,min=1"`
+	After  *int `json:"after,omitempty" validate:"omitempty,min=1"`
+	ListID *int `json:"listId,omitempty" validate:"omitempty,min=1"`
+}
+
+type List struct {
+	ID      int    `json:"id"`
+	Title   string `json:"title"`
+	OwnerID *int   `json:"ownerId"`
+	Created string `json:"created"`
+}
+
+type ListRequest struct {
+	Title string `json:"title" validate:"required,min=1,max=255"`
+}
+
+type Comment struct {
+	ID       int     `json:"id"`
+	TodoID   int     `json:"todoId"`
+	AuthorID *int    `json:"authorId"`
+	Author   string  `json:"author"`
+	Body     string  `json:"body"`
+	Created  string  `json:"created"`
+	Updated  *string `json:"updated"`
+}
+
+// CommentRequest body is markdown, it is stored and returned as is.
+type CommentRequest struct {
+	Body string `json:"body" validate:"required,min=1,max=10000"`
+}
+
+type Attachment struct {
+	ID          int    `json:"id"`
+	TodoID      int    `json:"todoId"`
+	OwnerID     int    `json:"ownerId"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+	Created     string `json:"created"`
+	URL         string `json:"url,omitempty"`
+	BlobKey     string `json:"-"`
+}
+
+// TodoEvent is one version of a task. Kind is one of create, update, delete, restore, move and revert.
+type TodoEvent struct {
+	Version int                       `json:"version"`
+	Kind    string                    `json:"kind"`
+	ActorID *int                      `json:"actorId"`
+	Actor   string                    `json:"actor"`
+	Changes map[string]history.Change `json:"changes"`
+	Created string                    `json:"created"`
+}
+
+// StreamEvent is a change of a task pushed to the streams. Type is the kind of the history event,
+// Todo is the task after the change. IDs grow with every event, a stream resumes after the last ID it got.
+type StreamEvent struct {
+	ID      int64           `json:"id"`
+	Type    string          `json:"type"`
+	TodoID  int             `json:"todoId"`
+	Version int             `json:"version"`
+	ActorID *int            `json:"actorId"`
+	Todo    json.RawMessage `json:"todo"`
+	Created string          `json:"created"`
+}
+
+// BulkRequest applies one action to the tasks with the given IDs or, without IDs, to the tasks matching Where.
+// Move puts the tasks at the end of ListID, tag adds Tags to the tasks.
+type BulkRequest struct {
+	Action string     `json:"action" validate:"required,oneof=complete uncomplete delete move tag"`
+	IDs    []int      `json:"ids,omitempty" validate:"required_without=Where,max=1000,dive,min=1"`
+	Where  *BulkWhere `json:"where,omitempty"`
+	ListID *int       `json:"listId,omitempty" validate:"omitempty,min=1"`
+	Tags   []string   `json:"tags,omitempty" validate:"required_if=Action tag,max=20,dive,min=1,max=40"`
+}
+
+// BulkWhere selects tasks like the query parameters of GetAll.
+type BulkWhere struct {
+	Filter string `json:"filter,omitempty" validate:"omitempty,oneof=all completed inWork"`
+	Status string `json:"status,omitempty"`
+	ListID *int   `json:"listId,omitempty" validate:"omitempty,min=1"`
+	Search string `json:"search,omitempty"`
+}
+
+// BulkResult is the outcome for one task, Status is the HTTP status the single request would have returned.
+type BulkResult struct {
+	ID     int    `json:"id"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Code   int64  `json:"-"`
+}
+
+type BulkResponse struct {
+	Results []BulkResult `json:"results"`
+	Info    TodoInfo     `json:"info"`
+}
+
+// ImportResult is the outcome of one task of an import. Row is the line the task starts at in the file,
+// for JSON it is the position of the task in the array.
+type ImportResult struct {
+	Row   int    `json:"row"`
+	ID    int64  `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+type ImportResponse struct {
+	DryRun   bool           `json:"dryRun"`
+	Imported int            `json:"imported"`
+	Failed   int            `json:"failed"`
+	Results  []ImportResult `json:"results"`
+}
+
+// Access levels of a user to a task or list, each level includes the ones before it.
+// Tasks and lists without an owner give EditAccess to everyone.
+const (
+	NoAccess = iota
+	ViewAccess
+	EditAccess
+	OwnerAccess
+)
+
+// Share grants a user the viewer or editor role on a task or a list once the user accepts it.
+type Share struct {
+	ID       int    `json:"id"`
+	TodoID   *int   `json:"todoId,omitempty"`
+	ListID   *int   `json:"listId,omitempty"`
+	Title    string `json:"title"`
+	UserID   int    `json:"userId"`
+	User     string `json:"user"`
+	Role     string `json:"role"`
+	Status   string `json:"status"`
+	SharedBy *int   `json:"sharedBy"`
+	Created  string `json:"created"`
+}
+
+type ShareRequest struct {
+	UserID int    `json:"userId" validate:"required,min=1"`
+	Role   string `json:"role" validate:"required,oneof=viewer editor"`
+}
+
+// TimeEntry is time tracked by a user on a task. A running timer has no Stopped time,
+// its Seconds are counted up to now.
+type TimeEntry struct {
+	ID      int     `json:"id"`
+	TodoID  int     `json:"todoId"`
+	UserID  int     `json:"userId"`
+	User    string  `json:"user"`
+	Started string  `json:"started"`
+	Stopped *string `json:"stopped"`
+	Seconds int64   `json:"seconds"`
+	Note    string  `json:"note"`
+}
+
+// TimeEntryRequest adds time tracked without a timer, the times are RFC 3339.
+type TimeEntryRequest struct {
+	Started string `json:"started" validate:"required"`
+	Stopped string `json:"stopped" validate:"required"`
+	Note    string `json:"note" validate:"max=500"`
+}
+
+type TimerRequest struct {
+	Note string `json:"note" validate:"max=500"`
+}
+
+// TimeQuery selects tracked time for a report. A zero UserID covers every user, zero times leave the range open.
+type TimeQuery struct {
+	UserID int
+	TodoID *int
+	ListID *int
+	Tag    string
+	From   time.Time
+	To     time.Time
+}
+
+// TimeSummary is the time tracked on a task in total and per day.
+type TimeSummary struct {
+	Total   int64           `json:"total"`
+	Days    []timetrack.Row `json:"days"`
+	Entries []TimeEntry     `json:"entries"`
+}
+
+type TimeReport struct {
+	GroupBy string          `json:"groupBy"`
+	From    string          `json:"from,omitempty"`
+	To      string          `json:"to,omitempty"`
+	Total   int64           `json:"total"`
+	Rows    []timetrack.Row `json:"rows"`
+}
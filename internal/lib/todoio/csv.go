@@ -0,0 +1,254 @@
+package todoio
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+)
+
+// Fields are the task fields CSV columns can be mapped to.
+var Fields = []string{"title", "isDone", "status", "due", "priority", "tags"}
+
+// Dialect describes a CSV layout. Columns maps task fields to column names, names are matched case insensitively.
+// Skip, Priority and Tags are optional, by default every record is a task, priority is a number
+// and tags are separated by commas.
+type Dialect struct {
+	Columns  map[string]string
+	Skip     func(get func(column string) string) bool
+	Priority func(s string) (int, error)
+	Tags     func(s string) []string
+}
+
+// Dialects are the known CSV layouts: the one WriteCSV writes and the exports of Todoist and Trello.
+var Dialects = map[string]Dialect{
+	"sapi": {
+		Columns: map[string]string{"title": "title", "isDone": "isDone", "status": "status", "due": "due", "priority": "priority", "tags": "tags"},
+	},
+	"todoist": {
+		Columns: map[string]string{"title": "CONTENT", "due": "DATE", "priority": "PRIORITY"},
+		// Sections and notes share the file with tasks.
+		Skip: func(get func(string) string) bool { return !strings.EqualFold(get("TYPE"), "task") },
+		// Todoist priorities go from 1 (urgent) to 4 (none).
+		Priority: func(s string) (int, error) {
+			p, err := strconv.Atoi(s)
+			if err != nil || p < 1 || p > 4 {
+				return 0, fmt.Errorf("invalid priority: %q", s)
+			}
+			return 4 - p, nil
+		},
+	},
+	"trello": {
+		Columns: map[string]string{"title": "Card Name", "isDone": "Due Complete", "due": "Due Date", "tags": "Labels"},
+		Skip:    func(get func(string) string) bool { return strings.EqualFold(get("Archived"), "true") },
+		// Labels are exported as "Name (color)".
+		Tags: func(s string) []string {
+			tags := splitList(s)
+			for i, tag := range tags {
+				if j := strings.LastIndex(tag, " ("); j > 0 && strings.HasSuffix(tag, ")") {
+					tags[i] = tag[:j]
+				}
+			}
+			return tags
+		},
+	},
+}
+
+// WithColumns returns a copy of d with some fields mapped to other columns.
+func (d Dialect) WithColumns(columns map[string]string) Dialect {
+	merged := make(map[string]string, len(d.Columns)+len(columns))
+	for field, column := range d.Columns {
+		merged[field] = column
+	}
+	for field, column := range columns {
+		merged[field] = column
+	}
+	d.Columns = merged
+
+	return d
+}
+
+// ParseColumns parses a column mapping like "title:Name,due:Deadline".
+func ParseColumns(s string) (map[string]string, error) {
+	columns := make(map[string]string)
+	for _, pair := range splitList(s) {
+		field, column, ok := strings.Cut(pair, ":")
+		field, column = strings.TrimSpace(field), strings.TrimSpace(column)
+		if !ok || column == "" {
+			return nil, fmt.Errorf("invalid column mapping: %q", pair)
+		}
+		if !slices.Contains(Fields, field) {
+			return nil, fmt.Errorf("unknown field: %q", field)
+		}
+		columns[field] = column
+	}
+
+	return columns, nil
+}
+
+// WriteCSV writes the tasks in the layout of the "sapi" dialect with a few read only columns.
+func WriteCSV(w io.Writer, todos []t.Todo) error {
+	cw := csv.NewWriter(w)
+
+	cw.Write([]string{"id", "title", "created", "isDone", "status", "listId", "due", "priority", "tags"})
+	for _, todo := range todos {
+		var listID, due string
+		if todo.ListID != nil {
+			listID = strconv.Itoa(*todo.ListID)
+		}
+		if todo.Due != nil {
+			due = *todo.Due
+		}
+
+		cw.Write([]string{
+			strconv.Itoa(int(todo.ID)),
+			todo.Title,
+			todo.Created,
+			strconv.FormatBool(todo.IsDone),
+			todo.Status,
+			listID,
+			due,
+			strconv.Itoa(todo.Priority),
+			strings.Join(todo.Tags, ","),
+		})
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func readCSV(r io.Reader, d Dialect) ([]Row, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the header: %v", err)
+	}
+
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if _, ok := index[name]; !ok {
+			index[name] = i
+		}
+	}
+
+	if _, ok := index[strings.ToLower(d.Columns["title"])]; !ok {
+		return nil, fmt.Errorf("no title column %q", d.Columns["title"])
+	}
+
+	var rows []Row
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rows = append(rows, Row{Line: parseErr.StartLine, Err: parseErr.Err})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		get := func(column string) string {
+			i, ok := index[strings.ToLower(column)]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		if d.Skip != nil && d.Skip(get) {
+			continue
+		}
+
+		line, _ := cr.FieldPos(0)
+		row := Row{Line: line}
+		row.Todo, row.Err = d.todo(get)
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// todo reads the mapped fields of a record.
+func (d Dialect) todo(get func(column string) string) (t.TodoRequest, error) {
+	var todo t.TodoRequest
+
+	field := func(name string) string {
+		column, ok := d.Columns[name]
+		if !ok {
+			return ""
+		}
+		return get(column)
+	}
+
+	todo.Title = field("title")
+
+	if v := field("isDone"); v != "" {
+		done, err := strconv.ParseBool(v)
+		if err != nil {
+			return todo, fmt.Errorf("invalid isDone: %q", v)
+		}
+		todo.IsDone = &done
+	}
+
+	if v := field("status"); v != "" {
+		todo.Status = &v
+	}
+
+	if v := field("due"); v != "" {
+		todo.Due = &v
+	}
+
+	if v := field("priority"); v != "" {
+		priority := d.Priority
+		if priority == nil {
+			priority = func(s string) (int, error) {
+				p, err := strconv.Atoi(s)
+				if err != nil {
+					return 0, fmt.Errorf("invalid priority: %q", s)
+				}
+				return p, nil
+			}
+		}
+
+		p, err := priority(v)
+		if err != nil {
+			return todo, err
+		}
+		todo.Priority = &p
+	}
+
+	if v := field("tags"); v != "" {
+		if d.Tags != nil {
+			todo.Tags = d.Tags(v)
+		} else {
+			todo.Tags = splitList(v)
+		}
+	}
+
+	return todo, normalize(&todo)
+}
+
+// splitList splits a comma separated list and drops empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
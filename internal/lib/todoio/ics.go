@@ -0,0 +1,349 @@
+package todoio
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+)
+
+const (
+	icsTime = "20060102T150405Z"
+	icsDate = "20060102"
+)
+
+// Components a task can be written as.
+const (
+	VTODO  = "VTODO"
+	VEVENT = "VEVENT"
+)
+
+// WriteICS writes the tasks as VTODO components of an iCalendar (RFC 5545) object.
+// stamp is the DTSTAMP of the tasks, the time the object is created.
+func WriteICS(w io.Writer, todos []t.Todo, stamp time.Time) error {
+	return writeCalendar(w, todos, stamp, "", VTODO)
+}
+
+// WriteFeed writes the tasks with a due date as a calendar subscription named name. As VEVENT
+// a task is an event that starts at its due date, as VTODO it is written like WriteICS does.
+func WriteFeed(w io.Writer, todos []t.Todo, stamp time.Time, name, component string) error {
+	var due []t.Todo
+	for _, todo := range todos {
+		if todo.Due != nil {
+			due = append(due, todo)
+		}
+	}
+
+	return writeCalendar(w, due, stamp, name, component)
+}
+
+func writeCalendar(w io.Writer, todos []t.Todo, stamp time.Time, name, component string) error {
+	iw := &icsWriter{w: w}
+
+	iw.line("BEGIN:VCALENDAR")
+	iw.line("VERSION:2.0")
+	iw.line("PRODID:-//EasyDev//sAPI//EN")
+	if name != "" {
+		iw.line("X-WR-CALNAME:" + escapeText(name))
+		iw.line("REFRESH-INTERVAL;VALUE=DURATION:PT1H")
+		iw.line("X-PUBLISHED-TTL:PT1H")
+	}
+
+	for _, todo := range todos {
+		var due time.Time
+		if todo.Due != nil {
+			due, _ = time.Parse(time.RFC3339Nano, *todo.Due)
+		}
+
+		iw.line("BEGIN:" + component)
+		iw.line(fmt.Sprintf("UID:todo-%d@sapi", todo.ID))
+		iw.line("DTSTAMP:" + stamp.UTC().Format(icsTime))
+		if created, err := time.Parse(time.RFC3339Nano, todo.Created); err == nil {
+			iw.line("CREATED:" + created.UTC().Format(icsTime))
+		}
+		iw.line("SEQUENCE:" + strconv.Itoa(todo.Version))
+		iw.line("SUMMARY:" + escapeText(todo.Title))
+
+		if component == VEVENT {
+			// Without DTEND the event takes no time.
+			iw.line("DTSTART:" + due.UTC().Format(icsTime))
+		} else {
+			if todo.IsDone {
+				iw.line("STATUS:COMPLETED")
+			} else {
+				iw.line("STATUS:NEEDS-ACTION")
+			}
+			if !due.IsZero() {
+				iw.line("DUE:" + due.UTC().Format(icsTime))
+			}
+		}
+
+		if p := icsPriority(todo.Priority); p > 0 {
+			iw.line("PRIORITY:" + strconv.Itoa(p))
+		}
+		if len(todo.Tags) > 0 {
+			tags := make([]string, len(todo.Tags))
+			for i, tag := range todo.Tags {
+				tags[i] = escapeText(tag)
+			}
+			iw.line("CATEGORIES:" + strings.Join(tags, ","))
+		}
+		iw.line("END:" + component)
+	}
+
+	iw.line("END:VCALENDAR")
+
+	return iw.err
+}
+
+// icsWriter writes content lines folded to 75 octets and keeps the first error.
+type icsWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (iw *icsWriter) line(s string) {
+	if iw.err != nil {
+		return
+	}
+
+	var b strings.Builder
+	for limit := 75; len(s) > limit; limit = 74 {
+		// Folding must not split a multi-byte character.
+		i := limit
+		for i > 0 && !utf8.RuneStart(s[i]) {
+			i--
+		}
+		b.WriteString(s[:i])
+		b.WriteString("\r\n ")
+		s = s[i:]
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+
+	_, iw.err = io.WriteString(iw.w, b.String())
+}
+
+// icsPriority maps a task priority (0-3, 3 is the highest) to an iCalendar one (1-9, 1 is the highest, 0 is undefined).
+func icsPriority(p int) int {
+	switch p {
+	case 3:
+		return 1
+	case 2:
+		return 5
+	case 1:
+		return 9
+	default:
+		return 0
+	}
+}
+
+// taskPriority is the reverse of icsPriority.
+func taskPriority(p int) int {
+	switch {
+	case p >= 1 && p <= 4:
+		return 3
+	case p == 5:
+		return 2
+	case p >= 6 && p <= 9:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func readICS(r io.Reader) ([]Row, error) {
+	type contentLine struct {
+		n    int
+		text string
+	}
+
+	var lines []contentLine
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		text := strings.TrimRight(sc.Text(), "\r")
+		if (strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1].text += text[1:]
+			continue
+		}
+		if text != "" {
+			lines = append(lines, contentLine{n, text})
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(lines) == 0 || !strings.EqualFold(strings.TrimPrefix(lines[0].text, "\ufeff"), "BEGIN:VCALENDAR") {
+		return nil, errors.New("not an iCalendar object")
+	}
+
+	var rows []Row
+	var row *Row
+	depth := 0 // components nested in the current VTODO, like VALARM
+
+	for _, l := range lines {
+		name, params, value := parseProperty(l.text)
+
+		switch {
+		case row == nil:
+			if name == "BEGIN" && strings.EqualFold(value, "VTODO") {
+				row = &Row{Line: l.n}
+			}
+			continue
+		case name == "BEGIN":
+			depth++
+			continue
+		case name == "END" && depth > 0:
+			depth--
+			continue
+		case name == "END":
+			if row.Err == nil {
+				row.Err = normalize(&row.Todo)
+			}
+			rows = append(rows, *row)
+			row = nil
+			continue
+		case depth > 0 || row.Err != nil:
+			continue
+		}
+
+		row.Err = setProperty(&row.Todo, name, params, value)
+	}
+
+	return rows, nil
+}
+
+// parseProperty splits a content line into its upper case name, parameters and value.
+func parseProperty(line string) (string, map[string]string, string) {
+	quoted := false
+	colon := len(line)
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+
+	head, value := line[:colon], ""
+	if colon < len(line) {
+		value = line[colon+1:]
+	}
+
+	parts := strings.Split(head, ";")
+	params := make(map[string]string, len(parts)-1)
+	for _, p := range parts[1:] {
+		k, v, _ := strings.Cut(p, "=")
+		params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+	}
+
+	return strings.ToUpper(parts[0]), params, value
+}
+
+func setProperty(todo *t.TodoRequest, name string, params map[string]string, value string) error {
+	switch name {
+	case "SUMMARY":
+		todo.Title = unescapeText(value)
+	case "STATUS":
+		done := strings.EqualFold(value, "COMPLETED")
+		todo.IsDone = &done
+	case "COMPLETED":
+		done := true
+		todo.IsDone = &done
+	case "DUE":
+		due, err := parseICSTime(value, params)
+		if err != nil {
+			return err
+		}
+		s := due.Format(time.RFC3339)
+		todo.Due = &s
+	case "PRIORITY":
+		p, err := strconv.Atoi(value)
+		if err != nil || p < 0 || p > 9 {
+			return fmt.Errorf("invalid priority: %q", value)
+		}
+		priority := taskPriority(p)
+		todo.Priority = &priority
+	case "CATEGORIES":
+		for _, tag := range splitText(value) {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				todo.Tags = append(todo.Tags, tag)
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseICSTime parses a DATE or DATE-TIME value. Floating times are taken as UTC.
+func parseICSTime(value string, params map[string]string) (time.Time, error) {
+	var d time.Time
+	var err error
+
+	switch {
+	case params["VALUE"] == "DATE" || len(value) == len(icsDate):
+		d, err = time.Parse(icsDate, value)
+	case strings.HasSuffix(value, "Z"):
+		d, err = time.Parse(icsTime, value)
+	default:
+		loc := time.UTC
+		if tz := params["TZID"]; tz != "" {
+			if loc, err = time.LoadLocation(tz); err != nil {
+				return d, fmt.Errorf("unknown time zone: %q", tz)
+			}
+		}
+		d, err = time.ParseInLocation(strings.TrimSuffix(icsTime, "Z"), value, loc)
+	}
+	if err != nil {
+		return d, fmt.Errorf("invalid date: %q", value)
+	}
+
+	return d.UTC(), nil
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+func unescapeText(s string) string {
+	parts := splitText(s)
+	return strings.Join(parts, ",")
+}
+
+// splitText unescapes a TEXT value and splits it on the unescaped commas.
+func splitText(s string) []string {
+	var parts []string
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case 'n', 'N':
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(s[i])
+			}
+		case c == ',':
+			parts = append(parts, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return append(parts, b.String())
+}
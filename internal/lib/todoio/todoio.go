@@ -0,0 +1,119 @@
+// Package todoio reads and writes tasks in the JSON, CSV and iCalendar (VTODO) formats
+// used by the import and export of tasks.
+package todoio
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	t "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+)
+
+const (
+	JSON = "json"
+	CSV  = "csv"
+	ICS  = "ics"
+)
+
+var ErrUnknownFormat = errors.New("unknown format")
+
+// Row is a task read from an import file. Line is the line the task starts at, for JSON it is
+// the position of the task in the array. Err is set when the task could not be read.
+type Row struct {
+	Line int
+	Todo t.TodoRequest
+	Err  error
+}
+
+// Read reads the tasks of an import file. CSV columns are mapped to task fields by the dialect d.
+// An error is returned only when the file can not be read at all, a broken task is reported in its row.
+func Read(format string, r io.Reader, d Dialect) ([]Row, error) {
+	switch format {
+	case JSON:
+		return readJSON(r)
+	case CSV:
+		return readCSV(r, d)
+	case ICS:
+		return readICS(r)
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// WriteJSON writes the tasks as a JSON array, the format Read accepts.
+func WriteJSON(w io.Writer, todos []t.Todo) error {
+	if todos == nil {
+		todos = []t.Todo{}
+	}
+	return json.NewEncoder(w).Encode(todos)
+}
+
+func readJSON(r io.Reader) ([]Row, error) {
+	var items []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&items); err != nil {
+		return nil, fmt.Errorf("expected an array of tasks: %v", err)
+	}
+
+	rows := make([]Row, 0, len(items))
+	for i, item := range items {
+		row := Row{Line: i + 1}
+
+		// Exported tasks carry read only fields like id and rank, they are ignored.
+		if err := json.Unmarshal(item, &row.Todo); err != nil {
+			row.Err = err
+		} else {
+			row.Err = normalize(&row.Todo)
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// normalize trims the title and brings the due date to the format of TodoRequest.
+func normalize(todo *t.TodoRequest) error {
+	todo.Title = strings.TrimSpace(todo.Title)
+	if todo.Title == "" {
+		return errors.New("empty title")
+	}
+
+	if todo.Due != nil {
+		due, err := parseDue(*todo.Due)
+		if err != nil {
+			return err
+		}
+		todo.Due = due
+	}
+
+	return nil
+}
+
+var dueLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseDue parses a due date in one of dueLayouts. An empty date is no due date.
+func parseDue(s string) (*string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+
+	for _, layout := range dueLayouts {
+		if d, err := time.Parse(layout, s); err == nil {
+			due := d.UTC().Format(time.RFC3339)
+			return &due, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported due date: %q", s)
+}
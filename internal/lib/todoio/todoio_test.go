@@ -0,0 +1,275 @@
+package todoio
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	tc "github.com/sabbatD/srest-api/internal/lib/todoConfig"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+func TestReadJSON(t *testing.T) {
+	rows, err := Read(JSON, strings.NewReader(`[
+		{"id": 7, "title": " a ", "due": "2026-10-20T10:00:00.5+03:00", "tags": ["x"]},
+		{"title": ""},
+		{"title": 1}
+	]`), Dialect{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(rows))
+	}
+
+	want := tc.TodoRequest{Title: "a", Due: ptr("2026-10-20T07:00:00Z"), Tags: []string{"x"}}
+	if rows[0].Err != nil || !reflect.DeepEqual(rows[0].Todo, want) {
+		t.Errorf("row 1 = %+v, %v, want %+v", rows[0].Todo, rows[0].Err, want)
+	}
+	for _, row := range rows[1:] {
+		if row.Err == nil {
+			t.Errorf("row %d: expected an error", row.Line)
+		}
+	}
+
+	if _, err := Read(JSON, strings.NewReader(`{"title": "a"}`), Dialect{}); err == nil {
+		t.Error("expected an error for an object")
+	}
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	todos := []tc.Todo{
+		{ID: 1, Title: "Buy milk, bread", Status: "todo", Due: ptr("2026-10-20T10:00:00Z"), Priority: 2, Tags: []string{"home", "shop"}},
+		{ID: 2, Title: "Done", IsDone: true, Status: "done", ListID: ptr(3)},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, todos); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := Read(CSV, &buf, Dialects["sapi"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []tc.TodoRequest{
+		{Title: "Buy milk, bread", IsDone: ptr(false), Status: ptr("todo"), Due: ptr("2026-10-20T10:00:00Z"), Priority: ptr(2), Tags: []string{"home", "shop"}},
+		{Title: "Done", IsDone: ptr(true), Status: ptr("done"), Priority: ptr(0)},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("got %d rows, want %d", len(rows), len(want))
+	}
+	for i, row := range rows {
+		if row.Err != nil || !reflect.DeepEqual(row.Todo, want[i]) {
+			t.Errorf("row %d = %+v, %v, want %+v", i, row.Todo, row.Err, want[i])
+		}
+		if row.Line != i+2 {
+			t.Errorf("row %d: line = %d, want %d", i, row.Line, i+2)
+		}
+	}
+}
+
+func TestReadTodoist(t *testing.T) {
+	file := "TYPE,CONTENT,DESCRIPTION,PRIORITY,INDENT,AUTHOR,RESPONSIBLE,DATE,DATE_LANG,TIMEZONE\n" +
+		"section,Errands,,,,,,,,\n" +
+		"task,Call mom,,1,1,,,2026-10-21,en,UTC\n" +
+		",,,,,,,,,\n" +
+		"task,Water plants,,4,1,,,every day,en,UTC\n" +
+		"task,Bad priority,,7,1,,,,en,UTC\n"
+
+	rows, err := Read(CSV, strings.NewReader(file), Dialects["todoist"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(rows))
+	}
+
+	want := tc.TodoRequest{Title: "Call mom", Due: ptr("2026-10-21T00:00:00Z"), Priority: ptr(3)}
+	if rows[0].Err != nil || !reflect.DeepEqual(rows[0].Todo, want) || rows[0].Line != 3 {
+		t.Errorf("row 1 = %+v, %v at %d, want %+v at 3", rows[0].Todo, rows[0].Err, rows[0].Line, want)
+	}
+	if rows[1].Err == nil || rows[1].Line != 5 {
+		t.Errorf("row 2: expected an unsupported due date error at line 5, got %v at %d", rows[1].Err, rows[1].Line)
+	}
+	if rows[2].Err == nil {
+		t.Error("row 3: expected an invalid priority error")
+	}
+}
+
+func TestReadTrello(t *testing.T) {
+	file := "Card ID,Card Name,Labels,Due Date,Archived,Due Complete\n" +
+		"a1,Write report,\"Work (blue), Urgent (red)\",2026-10-22T09:00:00.000Z,false,true\n" +
+		"a2,Old card,,,true,false\n"
+
+	rows, err := Read(CSV, strings.NewReader(file), Dialects["trello"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Row{{Line: 2, Todo: tc.TodoRequest{Title: "Write report", IsDone: ptr(true), Due: ptr("2026-10-22T09:00:00Z"), Tags: []string{"Work", "Urgent"}}}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("got %+v, want %+v", rows, want)
+	}
+}
+
+func TestColumns(t *testing.T) {
+	columns, err := ParseColumns("title: Name , due:Deadline")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := Dialects["sapi"].WithColumns(columns)
+	if d.Columns["title"] != "Name" || d.Columns["due"] != "Deadline" || d.Columns["tags"] != "tags" {
+		t.Errorf("unexpected columns: %v", d.Columns)
+	}
+	if Dialects["sapi"].Columns["title"] != "title" {
+		t.Error("WithColumns changed the dialect")
+	}
+
+	rows, err := Read(CSV, strings.NewReader("name,deadline\nTask,2026-10-23 12:30\n"), d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Err != nil || rows[0].Todo.Title != "Task" || *rows[0].Todo.Due != "2026-10-23T12:30:00Z" {
+		t.Errorf("unexpected rows: %+v", rows)
+	}
+
+	if _, err := Read(CSV, strings.NewReader("id,content\n1,Task\n"), d); err == nil {
+		t.Error("expected an error for a missing title column")
+	}
+
+	for _, s := range []string{"title", "owner:Owner", "title:"} {
+		if _, err := ParseColumns(s); err == nil {
+			t.Errorf("ParseColumns(%q): expected an error", s)
+		}
+	}
+}
+
+func TestICSRoundTrip(t *testing.T) {
+	todos := []tc.Todo{
+		{ID: 1, Title: "Plan; review, ship\nthen rest " + strings.Repeat("я", 60), Created: "2026-10-19T08:00:00.123456Z", Due: ptr("2026-10-20T10:00:00Z"), Priority: 3, Tags: []string{"a,b", "c"}, Version: 2},
+		{ID: 2, Title: "Done", IsDone: true, Priority: 1},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteICS(&buf, todos, time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line is not folded: %q", line)
+		}
+	}
+	for _, s := range []string{"UID:todo-1@sapi", "CREATED:20261019T080000Z", "SEQUENCE:2", "PRIORITY:1", `CATEGORIES:a\,b,c`, "STATUS:COMPLETED"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("output has no %q", s)
+		}
+	}
+
+	rows, err := Read(ICS, strings.NewReader(out), Dialect{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []tc.TodoRequest{
+		{Title: todos[0].Title, IsDone: ptr(false), Due: ptr("2026-10-20T10:00:00Z"), Priority: ptr(3), Tags: []string{"a,b", "c"}},
+		{Title: "Done", IsDone: ptr(true), Priority: ptr(1)},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("got %d rows, want %d", len(rows), len(want))
+	}
+	for i, row := range rows {
+		if row.Err != nil || !reflect.DeepEqual(row.Todo, want[i]) {
+			t.Errorf("row %d = %+v, %v, want %+v", i, row.Todo, row.Err, want[i])
+		}
+	}
+}
+
+func TestReadICS(t *testing.T) {
+	file := "BEGIN:VCALENDAR\r\n" +
+		"BEGIN:VTODO\r\n" +
+		"SUMMARY:Local\r\n" +
+		"DUE;TZID=Europe/Moscow:20261020T100000\r\n" +
+		"BEGIN:VALARM\r\n" +
+		"SUMMARY:Alarm\r\n" +
+		"END:VALARM\r\n" +
+		"END:VTODO\r\n" +
+		"BEGIN:VTODO\r\n" +
+		"SUMMARY:All day\r\n" +
+		"DUE;VALUE=DATE:20261021\r\n" +
+		"END:VTODO\r\n" +
+		"BEGIN:VTODO\r\n" +
+		"SUMMARY:Broken\r\n" +
+		"DUE:tomorrow\r\n" +
+		"END:VTODO\r\n" +
+		"END:VCALENDAR\r\n"
+
+	rows, err := Read(ICS, strings.NewReader(file), Dialect{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Row{
+		{Line: 2, Todo: tc.TodoRequest{Title: "Local", Due: ptr("2026-10-20T07:00:00Z")}},
+		{Line: 9, Todo: tc.TodoRequest{Title: "All day", Due: ptr("2026-10-21T00:00:00Z")}},
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(rows))
+	}
+	if !reflect.DeepEqual(rows[:2], want) {
+		t.Errorf("got %+v, want %+v", rows[:2], want)
+	}
+	if rows[2].Err == nil || rows[2].Line != 13 {
+		t.Errorf("row 3: expected an invalid date error at line 13, got %v at %d", rows[2].Err, rows[2].Line)
+	}
+
+	if _, err := Read(ICS, strings.NewReader("SUMMARY:x\r\n"), Dialect{}); err == nil {
+		t.Error("expected an error for a file without a calendar")
+	}
+}
+
+func TestReadUnknownFormat(t *testing.T) {
+	if _, err := Read("xml", strings.NewReader(""), Dialect{}); err != ErrUnknownFormat {
+		t.Errorf("got %v, want ErrUnknownFormat", err)
+	}
+}
+
+func TestWriteFeed(t *testing.T) {
+	todos := []tc.Todo{
+		{ID: 1, Title: "No due"},
+		{ID: 2, Title: "Due", Due: ptr("2026-10-20T10:00:00.5Z"), IsDone: true},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteFeed(&buf, todos, time.Now(), "Tasks, mine", VEVENT); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	if strings.Contains(out, "todo-1@sapi") {
+		t.Error("task without a due date is in the feed")
+	}
+	for _, s := range []string{`X-WR-CALNAME:Tasks\, mine`, "BEGIN:VEVENT", "UID:todo-2@sapi", "DTSTART:20261020T100000Z", "END:VEVENT"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("output has no %q", s)
+		}
+	}
+	if strings.Contains(out, "STATUS:") || strings.Contains(out, "VTODO") {
+		t.Errorf("event has to-do properties:\n%s", out)
+	}
+
+	buf.Reset()
+	if err := WriteFeed(&buf, todos, time.Now(), "Tasks", VTODO); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, "DUE:20261020T100000Z") || !strings.Contains(out, "STATUS:COMPLETED") {
+		t.Errorf("unexpected to-do feed:\n%s", out)
+	}
+}
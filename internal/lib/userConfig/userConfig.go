@@ -14,6 +14,14 @@ type PutUser struct {
 	PhoneNumber string `json:"phoneNumber,omitempty" validate:"omitempty,e164"`
 }
 
+// PatchUser is the profile a patch is applied to. Unlike PutUser every field is sent,
+// so a patch can clear the phone number.
+type PatchUser struct {
+	Username    string `json:"username" validate:"required,min=1,max=60,alphanumunicode"`
+	Email       string `json:"email" validate:"required,email"`
+	PhoneNumber string `json:"phoneNumber" validate:"omitempty,e164"`
+}
+
 type Pwd struct {
 	Password string `json:"password" validate:"required,min=6,max=60,alphanumunicode"`
 }
@@ -31,6 +39,8 @@ type TableUser struct {
 	IsBlocked   bool     `json:"isBlocked"`
 	Roles       []string `json:"roles"`
 	PhoneNumber string   `json:"phoneNumber"`
+	// Version is sent as the ETag header of the profile.
+	Version int `json:"-"`
 }
 
 type Meta struct {
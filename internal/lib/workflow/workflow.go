@@ -0,0 +1,113 @@
+// Package workflow describes the statuses a task can be in and the transitions between them.
+// A status is either open or terminal, a task in a terminal status is done.
+package workflow
+
+import "fmt"
+
+type Status struct {
+	Name     string `json:"name" validate:"required,min=1,max=60"`
+	Terminal bool   `json:"terminal"`
+}
+
+type Transition struct {
+	From string `json:"from" validate:"required"`
+	To   string `json:"to" validate:"required"`
+}
+
+// Workflow lists statuses in board order. Without transitions any move is allowed.
+type Workflow struct {
+	Statuses    []Status     `json:"statuses" validate:"required,min=2,dive"`
+	Transitions []Transition `json:"transitions" validate:"dive"`
+}
+
+// Default is used by tasks outside of a list and by lists without their own workflow.
+var Default = Workflow{
+	Statuses: []Status{
+		{Name: "todo"},
+		{Name: "done", Terminal: true},
+	},
+	Transitions: []Transition{},
+}
+
+func (w Workflow) Check() error {
+	const op = "workflow.Check"
+
+	seen := make(map[string]bool, len(w.Statuses))
+	var open, terminal bool
+
+	for _, s := range w.Statuses {
+		if seen[s.Name] {
+			return fmt.Errorf("%s: duplicate status %q", op, s.Name)
+		}
+		seen[s.Name] = true
+
+		if s.Terminal {
+			terminal = true
+		} else {
+			open = true
+		}
+	}
+
+	if !open || !terminal {
+		return fmt.Errorf("%s: workflow needs at least one open and one terminal status", op)
+	}
+
+	for _, tr := range w.Transitions {
+		if !seen[tr.From] || !seen[tr.To] {
+			return fmt.Errorf("%s: transition %q -> %q uses unknown status", op, tr.From, tr.To)
+		}
+	}
+
+	return nil
+}
+
+// Terminal reports whether the status is terminal and whether it exists at all.
+func (w Workflow) Terminal(name string) (terminal, ok bool) {
+	for _, s := range w.Statuses {
+		if s.Name == name {
+			return s.Terminal, true
+		}
+	}
+	return false, false
+}
+
+// CanMove reports whether a task may go from one status to another.
+// Tasks in a status the workflow does not know may go anywhere.
+func (w Workflow) CanMove(from, to string) bool {
+	if from == to || len(w.Transitions) == 0 {
+		return true
+	}
+
+	if _, ok := w.Terminal(from); !ok {
+		return true
+	}
+
+	for _, tr := range w.Transitions {
+		if tr.From == from && tr.To == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// StatusFor returns the first terminal status for done tasks and the first open one otherwise.
+func (w Workflow) StatusFor(done bool) string {
+	for _, s := range w.Statuses {
+		if s.Terminal == done {
+			return s.Name
+		}
+	}
+	return ""
+}
+
+// Names returns the status names, optionally only the terminal ones.
+func (w Workflow) Names(terminalOnly bool) []string {
+	var names []string
+	for _, s := range w.Statuses {
+		if !terminalOnly || s.Terminal {
+			names = append(names, s.Name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,85 @@
+package workflow
+
+import "testing"
+
+var board = Workflow{
+	Statuses: []Status{
+		{Name: "backlog"},
+		{Name: "in progress"},
+		{Name: "review"},
+		{Name: "done", Terminal: true},
+	},
+	Transitions: []Transition{
+		{From: "backlog", To: "in progress"},
+		{From: "in progress", To: "review"},
+		{From: "review", To: "in progress"},
+		{From: "review", To: "done"},
+	},
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    Workflow
+		wantErr bool
+	}{
+		{name: "default", args: Default},
+		{name: "board", args: board},
+		{
+			name:    "no terminal",
+			args:    Workflow{Statuses: []Status{{Name: "a"}, {Name: "b"}}},
+			wantErr: true,
+		},
+		{
+			name:    "duplicate",
+			args:    Workflow{Statuses: []Status{{Name: "a"}, {Name: "a", Terminal: true}}},
+			wantErr: true,
+		},
+		{
+			name: "unknown transition",
+			args: Workflow{
+				Statuses:    []Status{{Name: "a"}, {Name: "b", Terminal: true}},
+				Transitions: []Transition{{From: "a", To: "c"}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.args.Check(); (err != nil) != tt.wantErr {
+				t.Errorf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCanMove(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{"backlog", "in progress", true},
+		{"backlog", "done", false},
+		{"review", "done", true},
+		{"done", "done", true},
+		{"legacy", "review", true},
+	}
+	for _, tt := range tests {
+		if got := board.CanMove(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanMove(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+
+	if !Default.CanMove("done", "todo") {
+		t.Errorf("default workflow must allow any move")
+	}
+}
+
+func TestStatusFor(t *testing.T) {
+	if got := board.StatusFor(false); got != "backlog" {
+		t.Errorf("StatusFor(false) = %q, want backlog", got)
+	}
+	if got := board.StatusFor(true); got != "done" {
+		t.Errorf("StatusFor(true) = %q, want done", got)
+	}
+}
@@ -0,0 +1,60 @@
+// Package maintenance holds the background jobs keeping the database tidy.
+package maintenance
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const (
+	// TokensJob deletes the expired refresh tokens.
+	TokensJob = "tokens.cleanup"
+	// RetentionJob deletes the processed outbox events, webhook deliveries and jobs.
+	RetentionJob = "retention.prune"
+)
+
+type Tokens interface {
+	DeleteExpiredTokens(ctx context.Context) (int64, error)
+}
+
+// TokensHandler runs the TokensJob jobs.
+func TokensHandler(log *slog.Logger, storage Tokens) func(ctx context.Context, args struct{}) error {
+	return func(ctx context.Context, args struct{}) error {
+		n, err := storage.DeleteExpiredTokens(ctx)
+		if err != nil {
+			return err
+		}
+
+		if n > 0 {
+			log.Info("deleted expired tokens", slog.Int64("tokens", n))
+		}
+
+		return nil
+	}
+}
+
+type Pruner interface {
+	PruneProcessed(ctx context.Context, age time.Duration) (int64, error)
+}
+
+// RetentionArgs is the payload of a RetentionJob, records processed at least Keep ago are deleted.
+type RetentionArgs struct {
+	Keep time.Duration `json:"keep"`
+}
+
+// RetentionHandler runs the RetentionJob jobs.
+func RetentionHandler(log *slog.Logger, storage Pruner) func(ctx context.Context, args RetentionArgs) error {
+	return func(ctx context.Context, args RetentionArgs) error {
+		n, err := storage.PruneProcessed(ctx, args.Keep)
+		if err != nil {
+			return err
+		}
+
+		if n > 0 {
+			log.Info("pruned processed records", slog.Int64("records", n))
+		}
+
+		return nil
+	}
+}
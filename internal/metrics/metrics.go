@@ -0,0 +1,167 @@
+// Package metrics exposes the Prometheus metrics of the service: HTTP requests by chi route pattern,
+// the database pool, the latency of the Storage methods and the authentication outcomes.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "sapi"
+
+// Registry holds the metrics of the service, the Go runtime and the process.
+var Registry = prometheus.NewRegistry()
+
+var (
+	requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, chi route pattern and status.",
+	}, []string{"method", "route", "status"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time to serve HTTP requests by method, chi route pattern and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	storageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_op_duration_seconds",
+		Help:      "Time taken by the Storage methods by op.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"op"})
+
+	signIns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_signins_total",
+		Help:      "Sign-ins by result: success, failure (wrong credentials), blocked (user is blocked) or error.",
+	}, []string{"result"})
+
+	refreshes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_refreshes_total",
+		Help:      "Token refreshes by result: success, expired or error.",
+	}, []string{"result"})
+)
+
+// Results of the auth counters.
+const (
+	Success = "success"
+	Failure = "failure"
+	Blocked = "blocked"
+	Expired = "expired"
+	Error   = "error"
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		requests, requestDuration, storageDuration, signIns, refreshes,
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Middleware counts the requests by their chi route pattern, so /todos/1 and /todos/2 are the same route.
+// It has to wrap the root router, the pattern is complete once the request is served.
+// Requests matching no route are counted as "unmatched".
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			if pattern := rctx.RoutePattern(); pattern != "" {
+				route = pattern
+			}
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		labels := prometheus.Labels{"method": r.Method, "route": route, "status": strconv.Itoa(status)}
+		requests.With(labels).Inc()
+		requestDuration.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
+
+// ObserveStorage records how long a Storage method took.
+func ObserveStorage(op string, took time.Duration) {
+	storageDuration.WithLabelValues(op).Observe(took.Seconds())
+}
+
+// SignIn counts a sign-in with the result.
+func SignIn(result string) {
+	signIns.WithLabelValues(result).Inc()
+}
+
+// Refresh counts a token refresh with the result.
+func Refresh(result string) {
+	refreshes.WithLabelValues(result).Inc()
+}
+
+// RegisterDB exposes the stats of a connection pool.
+func RegisterDB(stats func() sql.DBStats) {
+	Registry.MustRegister(&dbCollector{stats: stats})
+}
+
+var (
+	dbMaxOpen           = dbDesc("max_open_connections", "Maximum number of open connections.")
+	dbOpen              = dbDesc("open_connections", "Number of open connections, in use and idle.")
+	dbInUse             = dbDesc("in_use_connections", "Number of connections in use.")
+	dbIdle              = dbDesc("idle_connections", "Number of idle connections.")
+	dbWaitCount         = dbDesc("wait_count_total", "Number of times a connection was waited for.")
+	dbWaitDuration      = dbDesc("wait_duration_seconds_total", "Time spent waiting for a connection.")
+	dbMaxIdleClosed     = dbDesc("max_idle_closed_total", "Connections closed because of the idle connections limit.")
+	dbMaxIdleTimeClosed = dbDesc("max_idle_time_closed_total", "Connections closed because they were idle too long.")
+	dbMaxLifetimeClosed = dbDesc("max_lifetime_closed_total", "Connections closed because they were open too long.")
+)
+
+func dbDesc(name, help string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db", name), help, nil, nil)
+}
+
+// dbCollector reads the pool stats on every scrape.
+type dbCollector struct {
+	stats func() sql.DBStats
+}
+
+func (c *dbCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{dbMaxOpen, dbOpen, dbInUse, dbIdle, dbWaitCount, dbWaitDuration,
+		dbMaxIdleClosed, dbMaxIdleTimeClosed, dbMaxLifetimeClosed} {
+		ch <- d
+	}
+}
+
+func (c *dbCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.stats()
+
+	ch <- prometheus.MustNewConstMetric(dbMaxOpen, prometheus.GaugeValue, float64(s.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(dbOpen, prometheus.GaugeValue, float64(s.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(dbInUse, prometheus.GaugeValue, float64(s.InUse))
+	ch <- prometheus.MustNewConstMetric(dbIdle, prometheus.GaugeValue, float64(s.Idle))
+	ch <- prometheus.MustNewConstMetric(dbWaitCount, prometheus.CounterValue, float64(s.WaitCount))
+	ch <- prometheus.MustNewConstMetric(dbWaitDuration, prometheus.CounterValue, s.WaitDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(dbMaxIdleClosed, prometheus.CounterValue, float64(s.MaxIdleClosed))
+	ch <- prometheus.MustNewConstMetric(dbMaxIdleTimeClosed, prometheus.CounterValue, float64(s.MaxIdleTimeClosed))
+	ch <- prometheus.MustNewConstMetric(dbMaxLifetimeClosed, prometheus.CounterValue, float64(s.MaxLifetimeClosed))
+}
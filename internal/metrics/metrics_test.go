@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func scrape(t *testing.T) string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body, _ := io.ReadAll(rec.Body)
+	return string(body)
+}
+
+func TestMiddleware(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Route("/api/v1", func(r chi.Router) {
+		r.Get("/todos/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		})
+	})
+
+	for _, path := range []string{"/api/v1/todos/1", "/api/v1/todos/2", "/nowhere"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	body := scrape(t)
+	for _, want := range []string{
+		`sapi_http_requests_total{method="GET",route="/api/v1/todos/{id}",status="418"} 2`,
+		`sapi_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`sapi_http_request_duration_seconds_count{method="GET",route="/api/v1/todos/{id}",status="418"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %s", want)
+		}
+	}
+}
+
+func TestCounters(t *testing.T) {
+	SignIn(Blocked)
+	Refresh(Expired)
+	ObserveStorage("database.postgres.Get", 0)
+	RegisterDB(func() sql.DBStats { return sql.DBStats{OpenConnections: 3, InUse: 1} })
+
+	body := scrape(t)
+	for _, want := range []string{
+		`sapi_auth_signins_total{result="blocked"} 1`,
+		`sapi_auth_refreshes_total{result="expired"} 1`,
+		`sapi_storage_op_duration_seconds_count{op="database.postgres.Get"} 1`,
+		`sapi_db_open_connections 3`,
+		`sapi_db_in_use_connections 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %s", want)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// Package notify defines the in-app notifications of the users and emails them to those who asked for it.
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Kinds of notifications.
+const (
+	// Reminder tells the owner of a task that it is due soon.
+	Reminder = "reminder"
+	// Mention tells a user that a comment @mentions them.
+	Mention = "mention"
+	// Share tells a user that a task or a list is shared with them.
+	Share = "share"
+	// Account tells a user that an admin changed their roles or blocked or unblocked them.
+	Account = "account"
+)
+
+var Kinds = []string{Reminder, Mention, Share, Account}
+
+type Notification struct {
+	ID      int             `json:"id"`
+	Kind    string          `json:"kind"`
+	Payload json.RawMessage `json:"payload" swaggertype:"object"`
+	Created time.Time       `json:"created"`
+	ReadAt  *time.Time      `json:"readAt"`
+}
+
+type Inbox struct {
+	Data   []Notification `json:"data"`
+	Unread int            `json:"unread"`
+}
+
+type Query struct {
+	Unread bool
+	Limit  int
+	Offset int
+}
+
+// Preference tells whether a kind of notifications goes to the inbox and whether it is emailed.
+// Without a preference a kind goes to the inbox only.
+type Preference struct {
+	Kind  string `json:"kind" validate:"required,oneof=reminder mention share account"`
+	Inbox bool   `json:"inbox"`
+	Email bool   `json:"email"`
+}
+
+type Preferences struct {
+	Preferences []Preference `json:"preferences" validate:"required,dive"`
+}
+
+// Defaults returns the preferences of a user who set none.
+func Defaults() []Preference {
+	prefs := make([]Preference, len(Kinds))
+	for i, kind := range Kinds {
+		prefs[i] = Preference{Kind: kind, Inbox: true}
+	}
+	return prefs
+}
+
+// EmailJob is the kind of the job emailing a notification.
+const EmailJob = "notification.email"
+
+// EmailArgs is the payload of an EmailJob.
+type EmailArgs struct {
+	UserID  int             `json:"userId"`
+	Kind    string          `json:"kind"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Mailer sends a plain text email.
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+type Recipients interface {
+	UserEmail(ctx context.Context, id int) (string, error)
+}
+
+// EmailHandler runs the EmailJob jobs. A user without an email address is skipped.
+func EmailHandler(log *slog.Logger, users Recipients, mailer Mailer) func(ctx context.Context, args EmailArgs) error {
+	return func(ctx context.Context, args EmailArgs) error {
+		to, err := users.UserEmail(ctx, args.UserID)
+		if err != nil {
+			return err
+		}
+
+		if to == "" {
+			log.Info("user has no email, notification not sent", slog.Int("user", args.UserID))
+			return nil
+		}
+
+		subject, body := Render(args.Kind, args.Payload)
+
+		return mailer.Send(ctx, to, subject, body)
+	}
+}
+
+// Render returns the subject and the body of the email of a notification.
+func Render(kind string, payload json.RawMessage) (string, string) {
+	var p struct {
+		TodoID    int      `json:"todoId"`
+		ListID    int      `json:"listId"`
+		CommentID int      `json:"commentId"`
+		Title     string   `json:"title"`
+		Due       string   `json:"due"`
+		Role      string   `json:"role"`
+		Action    string   `json:"action"`
+		Roles     []string `json:"roles"`
+	}
+	json.Unmarshal(payload, &p)
+
+	switch kind {
+	case Reminder:
+		return fmt.Sprintf("Reminder: %s", p.Title),
+			fmt.Sprintf("Task #%d \"%s\" is due %s.", p.TodoID, p.Title, p.Due)
+	case Mention:
+		return "You were mentioned in a comment",
+			fmt.Sprintf("Comment #%d on task #%d mentions you.", p.CommentID, p.TodoID)
+	case Share:
+		what := fmt.Sprintf("task #%d", p.TodoID)
+		if p.ListID != 0 {
+			what = fmt.Sprintf("list #%d", p.ListID)
+		}
+		return "Shared with you",
+			fmt.Sprintf("The %s \"%s\" is shared with you as %s.", what, p.Title, p.Role)
+	case Account:
+		var body string
+		switch p.Action {
+		case "roles":
+			body = fmt.Sprintf("An administrator changed your roles to: %s.", strings.Join(p.Roles, ", "))
+		case "blocked", "unblocked":
+			body = fmt.Sprintf("An administrator %s your account.", p.Action)
+		default:
+			body = "An administrator changed your admin rights."
+		}
+		return "Your account was changed", body
+	}
+
+	return "Notification", string(payload)
+}
+
+// ReminderJob is the kind of the job reminding of the tasks due soon.
+const ReminderJob = "todos.remind"
+
+// ReminderArgs is the payload of a ReminderJob, the tasks due within Before are reminded of.
+type ReminderArgs struct {
+	Before time.Duration `json:"before"`
+}
+
+type Reminders interface {
+	RemindDue(ctx context.Context, before time.Duration) (int64, error)
+}
+
+// ReminderHandler runs the ReminderJob jobs.
+func ReminderHandler(log *slog.Logger, storage Reminders) func(ctx context.Context, args ReminderArgs) error {
+	return func(ctx context.Context, args ReminderArgs) error {
+		n, err := storage.RemindDue(ctx, args.Before)
+		if err != nil {
+			return err
+		}
+
+		if n > 0 {
+			log.Info("reminded of due tasks", slog.Int64("tasks", n))
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeMailer struct {
+	to, subject, body string
+}
+
+func (m *fakeMailer) Send(ctx context.Context, to, subject, body string) error {
+	m.to, m.subject, m.body = to, subject, body
+	return nil
+}
+
+type fakeUsers map[int]string
+
+func (u fakeUsers) UserEmail(_ context.Context, id int) (string, error) {
+	return u[id], nil
+}
+
+func TestEmailHandler(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	mailer := &fakeMailer{}
+	handle := EmailHandler(log, fakeUsers{1: "user@example.com"}, mailer)
+
+	payload := json.RawMessage(`{"todoId": 7, "title": "Pay rent", "due": "2026-10-20T12:00:00Z"}`)
+	if err := handle(context.Background(), EmailArgs{UserID: 1, Kind: Reminder, Payload: payload}); err != nil {
+		t.Fatal(err)
+	}
+	if mailer.to != "user@example.com" || mailer.subject != "Reminder: Pay rent" || !strings.Contains(mailer.body, "#7") {
+		t.Errorf("unexpected email: %+v", mailer)
+	}
+
+	*mailer = fakeMailer{}
+	if err := handle(context.Background(), EmailArgs{UserID: 2, Kind: Mention}); err != nil || mailer.to != "" {
+		t.Errorf("a user without email should be skipped, got %v %+v", err, mailer)
+	}
+}
+
+func TestRender(t *testing.T) {
+	_, body := Render(Account, json.RawMessage(`{"action": "roles", "roles": ["USER", "ADMIN"]}`))
+	if !strings.Contains(body, "USER, ADMIN") {
+		t.Errorf("got %q", body)
+	}
+
+	_, body = Render(Share, json.RawMessage(`{"listId": 3, "title": "Home", "role": "editor"}`))
+	if !strings.Contains(body, "list #3") {
+		t.Errorf("got %q", body)
+	}
+}
+
+func TestMessage(t *testing.T) {
+	msg := string(Message("app@example.com", "user@example.com", "Привет", "line 1\nline 2", time.Unix(0, 0).UTC()))
+
+	if !strings.Contains(msg, "Subject: =?utf-8?q?") {
+		t.Errorf("subject is not encoded: %q", msg)
+	}
+	if !strings.HasSuffix(msg, "\r\n\r\nline 1\r\nline 2\r\n") {
+		t.Errorf("unexpected body: %q", msg)
+	}
+}
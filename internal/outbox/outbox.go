@@ -0,0 +1,118 @@
+// Package outbox relays domain events written to the outbox table together with the changes
+// that caused them. Every event is published at least once, sinks and their consumers
+// use the ID of an event to drop duplicates.
+package outbox
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/sabbatD/srest-api/internal/lib/logger/sl"
+)
+
+const (
+	UserCreated   = "user.created"
+	UserUpdated   = "user.updated"
+	UserBlocked   = "user.blocked"
+	UserUnblocked = "user.unblocked"
+	UserDeleted   = "user.deleted"
+	TodoCreated   = "todo.created"
+	TodoUpdated   = "todo.updated"
+	TodoCompleted = "todo.completed"
+	TodoReopened  = "todo.reopened"
+	TodoMoved     = "todo.moved"
+	TodoDeleted   = "todo.deleted"
+	TodoRestored  = "todo.restored"
+
+	// All matches every event.
+	All = "*"
+)
+
+// Types lists every domain event.
+var Types = []string{
+	UserCreated, UserUpdated, UserBlocked, UserUnblocked, UserDeleted,
+	TodoCreated, TodoUpdated, TodoCompleted, TodoReopened, TodoMoved, TodoDeleted, TodoRestored,
+}
+
+// Event is a domain event. ID is the dedup ID, it stays the same when the event is published again.
+type Event struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"event"`
+	Created time.Time       `json:"created"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// NewID generates a random UUID for an event.
+func NewID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// Sink publishes events. An error makes the relay publish the whole batch to every sink again.
+type Sink interface {
+	Publish(ctx context.Context, events []Event) error
+}
+
+type Store interface {
+	// PublishOutbox passes up to limit unpublished events, oldest first, to publish and marks them
+	// published if it succeeds. Concurrent relays get different events.
+	PublishOutbox(ctx context.Context, limit int, publish func([]Event) error) (int, error)
+}
+
+type Relay struct {
+	store    Store
+	log      *slog.Logger
+	sinks    []Sink
+	interval time.Duration
+	batch    int
+}
+
+func NewRelay(store Store, log *slog.Logger, sinks []Sink, interval time.Duration, batch int) *Relay {
+	return &Relay{store: store, log: log, sinks: sinks, interval: interval, batch: batch}
+}
+
+// Run publishes the outbox every interval until ctx is done.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			n, err := r.store.PublishOutbox(ctx, r.batch, func(events []Event) error {
+				return r.publish(ctx, events)
+			})
+			if err != nil {
+				r.log.Error("failed to publish outbox", sl.Err(err))
+				break
+			}
+
+			if n < r.batch {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Relay) publish(ctx context.Context, events []Event) error {
+	for _, sink := range r.sinks {
+		if err := sink.Publish(ctx, events); err != nil {
+			return fmt.Errorf("%T: %v", sink, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"regexp"
+	"testing"
+	"time"
+)
+
+var events = []Event{
+	{ID: "1", Type: TodoCompleted, Created: time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC), Data: json.RawMessage(`{"id":5}`)},
+	{ID: "2", Type: UserCreated, Created: time.Date(2026, 10, 19, 12, 0, 1, 0, time.UTC), Data: json.RawMessage(`{"id":7}`)},
+}
+
+func TestNewID(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	a, err := NewID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := NewID()
+
+	if !uuid.MatchString(a) || a == b {
+		t.Errorf("got %q and %q", a, b)
+	}
+}
+
+func TestBus(t *testing.T) {
+	bus := NewBus()
+
+	var completed, all []string
+	bus.Subscribe(TodoCompleted, func(ctx context.Context, e Event) error {
+		completed = append(completed, e.ID)
+		return nil
+	})
+	bus.Subscribe(All, func(ctx context.Context, e Event) error {
+		all = append(all, e.ID)
+		return nil
+	})
+
+	if err := bus.Publish(context.Background(), events); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(completed) != 1 || completed[0] != "1" || len(all) != 2 {
+		t.Errorf("completed %v, all %v", completed, all)
+	}
+
+	failure := errors.New("consumer down")
+	bus.Subscribe(UserCreated, func(ctx context.Context, e Event) error { return failure })
+	if err := bus.Publish(context.Background(), events); !errors.Is(err, failure) {
+		t.Errorf("got %v, want the error of the handler", err)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewWriter(&buf).Publish(context.Background(), events); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"id":"1","event":"todo.completed","created":"2026-10-19T12:00:00Z","data":{"id":5}}` + "\n" +
+		`{"id":"2","event":"user.created","created":"2026-10-19T12:00:01Z","data":{"id":7}}` + "\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+type fakeStore struct {
+	pending   []Event
+	published []Event
+}
+
+func (s *fakeStore) PublishOutbox(_ context.Context, limit int, publish func([]Event) error) (int, error) {
+	batch := s.pending[:min(limit, len(s.pending))]
+	if err := publish(batch); err != nil {
+		return 0, err
+	}
+	s.published = append(s.published, batch...)
+	s.pending = s.pending[len(batch):]
+	return len(batch), nil
+}
+
+type flakySink struct {
+	fail  int
+	calls int
+}
+
+func (s *flakySink) Publish(ctx context.Context, events []Event) error {
+	s.calls++
+	if s.calls <= s.fail {
+		return errors.New("unavailable")
+	}
+	return nil
+}
+
+func TestRelay(t *testing.T) {
+	store := &fakeStore{pending: append([]Event{}, events...)}
+	var buf bytes.Buffer
+	sink := &flakySink{fail: 1}
+
+	relay := NewRelay(store, slog.New(slog.NewTextHandler(io.Discard, nil)), []Sink{NewWriter(&buf), sink}, time.Hour, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// The failing sink keeps the event in the outbox, it is published again on the next run.
+	relay.Run(ctx)
+	if len(store.published) != 0 {
+		t.Fatalf("published %v despite the failing sink", store.published)
+	}
+
+	relay.Run(ctx)
+	if len(store.published) != 2 || len(store.pending) != 0 {
+		t.Fatalf("published %v, pending %v", store.published, store.pending)
+	}
+
+	// The writer saw the first event twice, once per attempt.
+	if n := bytes.Count(buf.Bytes(), []byte("\n")); n != 3 {
+		t.Errorf("writer got %d events, want 3", n)
+	}
+}
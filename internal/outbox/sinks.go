@@ -0,0 +1,73 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+)
+
+// Handler consumes an event published on a Bus.
+type Handler func(ctx context.Context, e Event) error
+
+// Bus is a sink passing events to handlers in the same process. A failing handler makes the
+// relay publish the batch again, so handlers may see an event more than once.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+func NewBus() *Bus {
+	return &Bus{handlers: map[string][]Handler{}}
+}
+
+// Subscribe calls h for every event of the type, All subscribes it to every event.
+func (b *Bus) Subscribe(event string, h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers[event] = append(b.handlers[event], h)
+}
+
+// Publish calls the handlers of every event and returns their errors.
+func (b *Bus) Publish(ctx context.Context, events []Event) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var errs []error
+	for _, e := range events {
+		for _, h := range b.handlers[e.Type] {
+			errs = append(errs, h(ctx, e))
+		}
+		for _, h := range b.handlers[All] {
+			errs = append(errs, h(ctx, e))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Writer is a sink writing events as newline delimited JSON, to stdout for local testing.
+type Writer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+func (s *Writer) Publish(ctx context.Context, events []Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enc := json.NewEncoder(s.w)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+// Package scheduler queues background jobs on cron schedules.
+//
+// Every instance runs a scheduler but only the leader, the one holding a PostgreSQL advisory lock,
+// queues the jobs, the job workers of any instance run them. If the leader goes away its lock is
+// released with its connection and another instance takes over.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/sabbatD/srest-api/internal/jobs"
+	"github.com/sabbatD/srest-api/internal/lib/cron"
+	"github.com/sabbatD/srest-api/internal/lib/logger/sl"
+)
+
+// LockKey is the advisory lock key of the leader.
+const LockKey int64 = 0x73617069_63726f6e
+
+// Lock is a held advisory lock.
+type Lock interface {
+	// Alive fails once the connection holding the lock is lost, and the lock with it.
+	Alive(ctx context.Context) error
+	Release() error
+}
+
+// Locker takes the advisory lock key if it is free.
+type Locker interface {
+	TryLock(ctx context.Context, key int64) (Lock, bool, error)
+}
+
+type Store interface {
+	Locker
+	jobs.Enqueuer
+}
+
+type task struct {
+	kind     string
+	payload  any
+	schedule cron.Schedule
+	next     time.Time
+}
+
+type Scheduler struct {
+	store    Store
+	log      *slog.Logger
+	interval time.Duration
+	tasks    []*task
+
+	now func() time.Time
+}
+
+// New returns a scheduler checking the schedules and the leadership every interval.
+func New(store Store, log *slog.Logger, interval time.Duration) *Scheduler {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	return &Scheduler{store: store, log: log, interval: interval, now: time.Now}
+}
+
+// Add queues a job of kind with payload every time expr matches. An empty expr disables the task.
+// A job still queued or running from the previous time is not queued again.
+func (s *Scheduler) Add(expr, kind string, payload any) error {
+	if expr == "" {
+		return nil
+	}
+
+	schedule, err := cron.Parse(expr)
+	if err != nil {
+		return fmt.Errorf("%s: %v", kind, err)
+	}
+
+	s.tasks = append(s.tasks, &task{kind: kind, payload: payload, schedule: schedule})
+
+	return nil
+}
+
+// Run schedules the tasks until ctx is done. Times missed while no instance was the leader are skipped.
+func (s *Scheduler) Run(ctx context.Context) {
+	if len(s.tasks) == 0 {
+		return
+	}
+
+	now := s.now()
+	for _, t := range s.tasks {
+		t.next = t.schedule.Next(now)
+	}
+
+	var lock Lock
+	defer func() {
+		if lock != nil {
+			lock.Release()
+		}
+	}()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		lock = s.lead(ctx, lock)
+		s.tick(ctx, lock != nil)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// lead returns the lock if this instance is the leader and nil otherwise.
+func (s *Scheduler) lead(ctx context.Context, lock Lock) Lock {
+	if lock != nil {
+		err := lock.Alive(ctx)
+		if err == nil {
+			return lock
+		}
+
+		s.log.Warn("lost scheduler leadership", sl.Err(err))
+		lock.Release()
+	}
+
+	lock, ok, err := s.store.TryLock(ctx, LockKey)
+	if err != nil {
+		s.log.Error("failed to take scheduler lock", sl.Err(err))
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+
+	s.log.Info("became scheduler leader")
+
+	return lock
+}
+
+// tick queues the jobs due if leader and moves the tasks due to their next time either way.
+func (s *Scheduler) tick(ctx context.Context, leader bool) {
+	now := s.now()
+
+	for _, t := range s.tasks {
+		if t.next.IsZero() || now.Before(t.next) {
+			continue
+		}
+
+		if leader {
+			id, err := jobs.Enqueue(ctx, s.store, t.kind, t.payload, jobs.Options{UniqueKey: t.kind})
+			switch {
+			case err != nil:
+				s.log.Error("failed to queue scheduled job", slog.String("kind", t.kind), sl.Err(err))
+			case id == 0:
+				s.log.Warn("scheduled job is still pending, skipped", slog.String("kind", t.kind))
+			default:
+				s.log.Debug("queued scheduled job", slog.String("kind", t.kind), slog.Int64("id", id))
+			}
+		}
+
+		t.next = t.schedule.Next(now)
+	}
+}
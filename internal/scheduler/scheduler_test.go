@@ -0,0 +1,114 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/sabbatD/srest-api/internal/jobs"
+)
+
+type fakeLock struct {
+	lost     bool
+	released bool
+}
+
+func (l *fakeLock) Alive(ctx context.Context) error {
+	if l.lost {
+		return errors.New("connection lost")
+	}
+	return nil
+}
+
+func (l *fakeLock) Release() error {
+	l.released = true
+	return nil
+}
+
+type fakeStore struct {
+	free     bool
+	lock     *fakeLock
+	enqueued []string
+}
+
+func (s *fakeStore) TryLock(ctx context.Context, key int64) (Lock, bool, error) {
+	if !s.free {
+		return nil, false, nil
+	}
+	s.free = false
+	s.lock = &fakeLock{}
+	return s.lock, true, nil
+}
+
+func (s *fakeStore) EnqueueJob(_ context.Context, kind string, payload []byte, opts jobs.Options) (int64, error) {
+	if opts.UniqueKey != kind {
+		return 0, errors.New("unexpected unique key")
+	}
+	s.enqueued = append(s.enqueued, kind)
+	return int64(len(s.enqueued)), nil
+}
+
+func TestScheduler(t *testing.T) {
+	store := &fakeStore{}
+	now := time.Date(2026, 10, 19, 12, 0, 30, 0, time.UTC)
+
+	s := New(store, slog.New(slog.NewTextHandler(io.Discard, nil)), time.Second)
+	s.now = func() time.Time { return now }
+
+	if err := s.Add("* * * * *", "every.minute", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add("@hourly", "every.hour", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add("", "disabled", nil); err != nil || len(s.tasks) != 2 {
+		t.Fatalf("an empty expression should disable the task")
+	}
+	if err := s.Add("61 * * * *", "broken", nil); err == nil {
+		t.Fatalf("expected an invalid expression error")
+	}
+
+	for _, task := range s.tasks {
+		task.next = task.schedule.Next(now)
+	}
+
+	step := func(minutes int) {
+		now = now.Add(time.Duration(minutes) * time.Minute)
+		lock := s.lead(context.Background(), lockOf(store))
+		s.tick(context.Background(), lock != nil)
+	}
+
+	// Not the leader: the times pass without jobs.
+	step(1)
+	if len(store.enqueued) != 0 {
+		t.Fatalf("a follower queued %v", store.enqueued)
+	}
+
+	store.free = true
+	step(1)
+	if len(store.enqueued) != 1 || store.enqueued[0] != "every.minute" {
+		t.Fatalf("got %v, want [every.minute]", store.enqueued)
+	}
+
+	step(60)
+	if len(store.enqueued) != 3 {
+		t.Fatalf("got %v, want both tasks queued once more", store.enqueued)
+	}
+
+	store.lock.lost = true
+	lost := store.lock
+	step(1)
+	if !lost.released || len(store.enqueued) != 3 {
+		t.Fatalf("a lost lock should be released and stop the jobs, got %v", store.enqueued)
+	}
+}
+
+func lockOf(s *fakeStore) Lock {
+	if s.lock == nil || s.lock.released {
+		return nil
+	}
+	return s.lock
+}
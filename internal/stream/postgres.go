@@ -0,0 +1,68 @@
+package stream
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sabbatD/srest-api/internal/lib/logger/sl"
+)
+
+// Channel is notified by the trigger on public.todo_events with the ID of every new event.
+const Channel = "todo_events"
+
+// Listener is the Broker of several sAPI instances sharing a database. It wakes up its local streams
+// on the notifications of Channel, so the events committed by any instance reach every stream.
+type Listener struct {
+	*Hub
+	listener *pq.Listener
+	log      *slog.Logger
+}
+
+func NewListener(ctx context.Context, dsn string, log *slog.Logger) (*Listener, error) {
+	l := &Listener{Hub: NewHub(), log: log}
+
+	l.listener = pq.NewListener(dsn, 10*time.Second, time.Minute, l.report)
+	if err := l.listener.Listen(Channel); err != nil {
+		l.listener.Close()
+		return nil, err
+	}
+
+	go l.run(ctx)
+
+	return l, nil
+}
+
+// Publish does nothing, the trigger notifies every instance including this one.
+func (l *Listener) Publish() {}
+
+func (l *Listener) run(ctx context.Context) {
+	defer l.listener.Close()
+
+	ping := time.NewTicker(90 * time.Second)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-l.listener.Notify:
+			// A nil notification follows a reconnect, events could have been committed meanwhile.
+			l.Hub.Publish()
+		case <-ping.C:
+			go l.listener.Ping()
+		}
+	}
+}
+
+func (l *Listener) report(event pq.ListenerEventType, err error) {
+	switch event {
+	case pq.ListenerEventDisconnected:
+		l.log.Warn("stream listener disconnected", sl.Err(err))
+	case pq.ListenerEventReconnected:
+		l.log.Info("stream listener reconnected")
+	case pq.ListenerEventConnectionAttemptFailed:
+		l.log.Error("stream listener failed to connect", sl.Err(err))
+	}
+}
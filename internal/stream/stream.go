@@ -0,0 +1,84 @@
+// Package stream wakes up the real-time streams of task events when new events are committed.
+// The events themselves are read from public.todo_events, so a stream can resume from any event ID
+// and a wake-up only has to say that there is something new.
+package stream
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+const (
+	Memory   = "memory"
+	Postgres = "postgres"
+)
+
+// New returns the broker of the kind. The postgres broker listens on dsn until ctx is done.
+func New(ctx context.Context, kind, dsn string, log *slog.Logger) (Broker, error) {
+	switch kind {
+	case Memory, "":
+		return NewHub(), nil
+	case Postgres:
+		return NewListener(ctx, dsn, log)
+	default:
+		return nil, fmt.Errorf("stream: unknown broker %q", kind)
+	}
+}
+
+// Broker fans out the wake-ups of committed task events to the open streams.
+type Broker interface {
+	// Publish tells the subscribers that new events are committed.
+	Publish()
+	// Subscribe returns the wake-up channel of a stream and the function that closes it.
+	Subscribe() (<-chan struct{}, func())
+}
+
+// Hub is the in-process Broker, it only sees the events committed by its own instance.
+type Hub struct {
+	mu   sync.Mutex
+	subs map[chan struct{}]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[chan struct{}]struct{})}
+}
+
+// Publish never blocks, a subscriber that has not read its last wake-up yet reads the new events with it.
+func (h *Hub) Publish() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (h *Hub) Subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subs, ch)
+			h.mu.Unlock()
+		})
+	}
+}
+
+// Subscribers returns the number of open streams.
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.subs)
+}
@@ -0,0 +1,62 @@
+package stream
+
+import (
+	"context"
+	"testing"
+)
+
+func TestHub(t *testing.T) {
+	h := NewHub()
+
+	a, closeA := h.Subscribe()
+	b, closeB := h.Subscribe()
+	if h.Subscribers() != 2 {
+		t.Fatalf("got %d subscribers, want 2", h.Subscribers())
+	}
+
+	// Wake-ups of a slow subscriber collapse into one.
+	h.Publish()
+	h.Publish()
+
+	for name, ch := range map[string]<-chan struct{}{"a": a, "b": b} {
+		select {
+		case <-ch:
+		default:
+			t.Errorf("%s: no wake-up", name)
+		}
+		select {
+		case <-ch:
+			t.Errorf("%s: second wake-up", name)
+		default:
+		}
+	}
+
+	closeA()
+	closeA()
+	h.Publish()
+
+	select {
+	case <-a:
+		t.Error("closed subscriber got a wake-up")
+	default:
+	}
+	if h.Subscribers() != 1 {
+		t.Errorf("got %d subscribers, want 1", h.Subscribers())
+	}
+
+	closeB()
+}
+
+func TestNew(t *testing.T) {
+	b, err := New(context.Background(), "", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.(*Hub); !ok {
+		t.Errorf("got %T, want *Hub", b)
+	}
+
+	if _, err := New(context.Background(), "redis", "", nil); err == nil {
+		t.Error("expected an error for an unknown broker")
+	}
+}
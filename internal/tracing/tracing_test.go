@@ -0,0 +1,100 @@
+package tracing
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	traceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	parentID    = "00f067aa0ba902b7"
+	traceparent = "00-" + traceID + "-" + parentID + "-01"
+)
+
+func record(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return exporter
+}
+
+func TestMiddleware(t *testing.T) {
+	exporter := record(t)
+
+	r := chi.NewRouter()
+	r.Route("/api/v1", func(r chi.Router) {
+		r.Use(Middleware)
+		r.Get("/todos/{id}", func(w http.ResponseWriter, r *http.Request) {
+			_, span := Start(r.Context(), "handler")
+			span.End()
+			w.WriteHeader(http.StatusServiceUnavailable)
+		})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/todos/1", nil)
+	req.Header.Set("traceparent", traceparent)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans", len(spans))
+	}
+	handler, server := spans[0], spans[1]
+
+	if server.Name != "GET /api/v1/todos/{id}" || server.SpanKind != trace.SpanKindServer {
+		t.Errorf("got server span %q of kind %v", server.Name, server.SpanKind)
+	}
+	if server.SpanContext.TraceID().String() != traceID || server.Parent.SpanID().String() != parentID {
+		t.Errorf("server span does not continue the trace: %v, parent %v", server.SpanContext, server.Parent)
+	}
+	if server.Status.Code != codes.Error {
+		t.Errorf("got status %v for 503", server.Status)
+	}
+	if handler.Parent.SpanID() != server.SpanContext.SpanID() {
+		t.Errorf("handler span is not a child of the server span")
+	}
+
+	if got := rec.Header().Get("traceparent"); got != "00-"+traceID+"-"+server.SpanContext.SpanID().String()+"-01" {
+		t.Errorf("got traceparent %q", got)
+	}
+}
+
+func TestLogAttrs(t *testing.T) {
+	record(t)
+
+	if attrs := LogAttrs(context.Background()); attrs != nil {
+		t.Errorf("got %v without a trace", attrs)
+	}
+
+	ctx, span := Start(context.Background(), "op")
+	defer span.End()
+
+	attrs := LogAttrs(ctx)
+	if len(attrs) != 2 {
+		t.Fatalf("got %v", attrs)
+	}
+	if a := attrs[0].(slog.Attr); a.Key != "trace_id" || a.Value.String() != span.SpanContext().TraceID().String() {
+		t.Errorf("got %v", a)
+	}
+}
+
+func TestUnknownExporter(t *testing.T) {
+	if _, err := Setup(context.Background(), Options{Exporter: "zipkin"}); err == nil {
+		t.Error("unknown exporter accepted")
+	}
+}
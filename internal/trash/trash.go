@@ -0,0 +1,61 @@
+// Package trash permanently removes trashed tasks together with the contents of their attachments.
+package trash
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/sabbatD/srest-api/internal/blob"
+	"github.com/sabbatD/srest-api/internal/lib/logger/sl"
+)
+
+type Purger interface {
+	PurgeTrash(ctx context.Context, age time.Duration) (int64, []string, error)
+}
+
+// Purge deletes the tasks trashed at least age ago and the blobs of their attachments.
+// A blob that fails to delete is only logged, its task is gone already.
+func Purge(ctx context.Context, log *slog.Logger, storage Purger, blobs blob.BlobStore, age time.Duration) (int64, error) {
+	n, keys, err := storage.PurgeTrash(ctx, age)
+	if err != nil {
+		return n, err
+	}
+
+	DeleteBlobs(ctx, log, blobs, keys)
+
+	return n, nil
+}
+
+// DeleteBlobs deletes the blobs of purged attachments. A blob that fails to delete is only logged.
+func DeleteBlobs(ctx context.Context, log *slog.Logger, blobs blob.BlobStore, keys []string) {
+	for _, key := range keys {
+		if err := blobs.Delete(ctx, key); err != nil {
+			log.Error("failed to delete blob", slog.String("key", key), sl.Err(err))
+		}
+	}
+}
+
+// PurgeJob is the kind of the job purging the trash.
+const PurgeJob = "trash.purge"
+
+// PurgeArgs is the payload of a PurgeJob, tasks trashed at least Retention ago are purged.
+type PurgeArgs struct {
+	Retention time.Duration `json:"retention"`
+}
+
+// PurgeHandler runs the PurgeJob jobs.
+func PurgeHandler(log *slog.Logger, storage Purger, blobs blob.BlobStore) func(ctx context.Context, args PurgeArgs) error {
+	return func(ctx context.Context, args PurgeArgs) error {
+		n, err := Purge(ctx, log, storage, blobs, args.Retention)
+		if err != nil {
+			return err
+		}
+
+		if n > 0 {
+			log.Info("purged trash", slog.Int64("tasks", n))
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,142 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sabbatD/srest-api/internal/lib/backoff"
+	"github.com/sabbatD/srest-api/internal/lib/logger/sl"
+)
+
+type Store interface {
+	// ClaimDeliveries takes up to limit pending deliveries due for an attempt and hides them
+	// from other dispatchers for lease.
+	ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]Attempt, error)
+	DeliverySucceeded(ctx context.Context, id int64, code int) error
+	// DeliveryFailed records a failed attempt, a nil retry marks the delivery dead.
+	DeliveryFailed(ctx context.Context, id int64, code int, msg string, retry *time.Time) error
+}
+
+type Options struct {
+	MaxAttempts  int
+	Backoff      time.Duration
+	MaxBackoff   time.Duration
+	Timeout      time.Duration
+	PollInterval time.Duration
+	Batch        int
+}
+
+type Dispatcher struct {
+	store  Store
+	log    *slog.Logger
+	client *http.Client
+	opts   Options
+}
+
+func NewDispatcher(store Store, log *slog.Logger, opts Options) *Dispatcher {
+	if opts.Batch == 0 {
+		opts.Batch = 20
+	}
+
+	return &Dispatcher{
+		store:  store,
+		log:    log,
+		client: &http.Client{Timeout: opts.Timeout},
+		opts:   opts,
+	}
+}
+
+// Run sends the due deliveries every poll interval until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			// A delivery is claimed for longer than the request may take, so no other dispatcher sends it meanwhile.
+			attempts, err := d.store.ClaimDeliveries(ctx, d.opts.Batch, 2*d.opts.Timeout)
+			if err != nil {
+				d.log.Error("failed to claim webhook deliveries", sl.Err(err))
+				break
+			}
+
+			// A request in flight is finished on shutdown, the attempts claimed but not sent yet
+			// are sent by a dispatcher claiming them again.
+			for _, a := range attempts {
+				if ctx.Err() != nil {
+					return
+				}
+				d.deliver(context.WithoutCancel(ctx), a)
+			}
+
+			if len(attempts) < d.opts.Batch {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, a Attempt) {
+	code, err := d.send(ctx, a)
+	if err == nil {
+		if err := d.store.DeliverySucceeded(ctx, a.ID, code); err != nil {
+			d.log.Error("failed to record webhook delivery", slog.Int64("delivery", a.ID), sl.Err(err))
+		}
+		return
+	}
+
+	var retry *time.Time
+	if a.Attempt < d.opts.MaxAttempts {
+		next := time.Now().Add(backoff.Exponential(a.Attempt, d.opts.Backoff, d.opts.MaxBackoff))
+		retry = &next
+	}
+
+	d.log.Info("webhook delivery failed",
+		slog.Int64("delivery", a.ID), slog.String("url", a.URL), slog.Int("attempt", a.Attempt), sl.Err(err))
+
+	if err := d.store.DeliveryFailed(ctx, a.ID, code, err.Error(), retry); err != nil {
+		d.log.Error("failed to record webhook delivery", slog.Int64("delivery", a.ID), sl.Err(err))
+	}
+}
+
+// send posts the payload and returns the status code of the response, any status but 2xx is an error.
+func (d *Dispatcher) send(ctx context.Context, a Attempt) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.URL, bytes.NewReader(a.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "sAPI-Webhooks")
+	req.Header.Set(EventHeader, a.Event)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(a.ID, 10))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(SignatureHeader, Sign(a.Secret, now, a.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,26 @@
+package webhook
+
+import (
+	"context"
+
+	"github.com/sabbatD/srest-api/internal/outbox"
+)
+
+type Queue interface {
+	// EnqueueWebhooks queues a delivery of every event to the active webhooks subscribed to it.
+	// An event queued for a webhook before is skipped.
+	EnqueueWebhooks(ctx context.Context, events []outbox.Event) error
+}
+
+// Sink is the outbox sink queueing deliveries for the dispatcher.
+type Sink struct {
+	queue Queue
+}
+
+func NewSink(queue Queue) *Sink {
+	return &Sink{queue: queue}
+}
+
+func (s *Sink) Publish(ctx context.Context, events []outbox.Event) error {
+	return s.queue.EnqueueWebhooks(ctx, events)
+}
@@ -0,0 +1,126 @@
+// Package webhook delivers domain events to the URLs subscribed to them. The body of a delivery is
+// the outbox.Event, its ID lets receivers drop duplicates. Deliveries are signed with HMAC-SHA256
+// and retried with exponential backoff until they end up dead.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/sabbatD/srest-api/internal/outbox"
+)
+
+// Events lists every event a webhook can subscribe to, outbox.All subscribes it to every event.
+var Events = outbox.Types
+
+// Statuses of a delivery. A pending delivery waits for its next attempt, a dead one ran out of attempts.
+const (
+	Pending   = "pending"
+	Delivered = "delivered"
+	Dead      = "dead"
+)
+
+// Headers of a delivery.
+const (
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+	TimestampHeader = "X-Webhook-Timestamp"
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+// Webhook is a subscription of a URL to events. The secret is only shown when it is set.
+type Webhook struct {
+	ID          int      `json:"id"`
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Active      bool     `json:"active"`
+	Description string   `json:"description"`
+	Secret      string   `json:"secret,omitempty"`
+	Created     string   `json:"created"`
+}
+
+// Request creates or replaces a webhook. Without a secret a new webhook gets a generated one
+// and an updated webhook keeps its own.
+type Request struct {
+	URL         string   `json:"url" validate:"required,url,max=2000"`
+	Events      []string `json:"events" validate:"required,min=1,dive,required"`
+	Active      *bool    `json:"active,omitempty"`
+	Description string   `json:"description,omitempty" validate:"max=200"`
+	Secret      string   `json:"secret,omitempty" validate:"omitempty,min=16,max=200"`
+}
+
+// Delivery is a single event sent to a webhook. Replaying a delivery creates a new one pointing to it.
+type Delivery struct {
+	ID          int64           `json:"id"`
+	WebhookID   int             `json:"webhookId"`
+	EventID     string          `json:"eventId"`
+	Event       string          `json:"event"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt *string         `json:"nextAttempt"`
+	LastStatus  *int            `json:"lastStatus"`
+	LastError   string          `json:"lastError"`
+	ReplayOf    *int64          `json:"replayOf"`
+	Created     string          `json:"created"`
+	DeliveredAt *string         `json:"deliveredAt"`
+}
+
+// DeliveryQuery filters the delivery log, zero values match everything.
+type DeliveryQuery struct {
+	WebhookID int
+	Status    string
+	Event     string
+	Limit     int
+	Offset    int
+}
+
+// Attempt is a delivery claimed for sending. Attempt counts this attempt as well.
+type Attempt struct {
+	ID      int64
+	Event   string
+	URL     string
+	Secret  string
+	Payload []byte
+	Attempt int
+}
+
+// ValidEvents reports whether every event can be subscribed to.
+func ValidEvents(events []string) bool {
+	for _, e := range events {
+		if e != outbox.All && !slices.Contains(Events, e) {
+			return false
+		}
+	}
+	return true
+}
+
+// NewSecret generates a random signing secret.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Sign returns the signature header of a body sent at ts. The timestamp is signed together
+// with the body, so a receiver rejecting old timestamps is safe from replayed requests.
+func Sign(secret string, ts time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(ts.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the signature of a body sent at ts, receivers written in Go can use it.
+func Verify(secret string, ts time.Time, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, ts, body)), []byte(signature))
+}
@@ -0,0 +1,124 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sabbatD/srest-api/internal/outbox"
+)
+
+func TestSign(t *testing.T) {
+	ts := time.Unix(1760000000, 0)
+	body := []byte(`{"event":"user.created"}`)
+
+	sig := Sign("secret", ts, body)
+	if len(sig) != len("sha256=")+64 || sig[:7] != "sha256=" {
+		t.Fatalf("unexpected signature %q", sig)
+	}
+
+	if !Verify("secret", ts, body, sig) {
+		t.Error("signature does not verify")
+	}
+	if Verify("other", ts, body, sig) {
+		t.Error("signature verifies with another secret")
+	}
+	if Verify("secret", ts.Add(time.Second), body, sig) {
+		t.Error("signature verifies with another timestamp")
+	}
+	if Verify("secret", ts, []byte(`{"event":"user.deleted"}`), sig) {
+		t.Error("signature verifies with another body")
+	}
+}
+
+func TestValidEvents(t *testing.T) {
+	if !ValidEvents([]string{outbox.TodoCompleted, outbox.UserBlocked}) || !ValidEvents([]string{outbox.All}) {
+		t.Error("valid events rejected")
+	}
+	if ValidEvents([]string{outbox.TodoCompleted, "todo.exploded"}) {
+		t.Error("unknown event accepted")
+	}
+}
+
+type result struct {
+	id    int64
+	code  int
+	retry *time.Time
+	ok    bool
+}
+
+type fakeStore struct {
+	attempts []Attempt
+	results  []result
+}
+
+func (s *fakeStore) ClaimDeliveries(_ context.Context, limit int, lease time.Duration) ([]Attempt, error) {
+	a := s.attempts
+	s.attempts = nil
+	return a, nil
+}
+
+func (s *fakeStore) DeliverySucceeded(_ context.Context, id int64, code int) error {
+	s.results = append(s.results, result{id: id, code: code, ok: true})
+	return nil
+}
+
+func (s *fakeStore) DeliveryFailed(_ context.Context, id int64, code int, msg string, retry *time.Time) error {
+	s.results = append(s.results, result{id: id, code: code, retry: retry})
+	return nil
+}
+
+func TestDispatcher(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		sec, _ := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+
+		if !Verify("secret", time.Unix(sec, 0), body, r.Header.Get(SignatureHeader)) || r.Header.Get(EventHeader) != outbox.TodoCompleted {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if id := r.Header.Get(DeliveryHeader); id == "2" || id == "3" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+	}))
+	defer srv.Close()
+
+	store := &fakeStore{attempts: []Attempt{
+		{ID: 1, Event: outbox.TodoCompleted, URL: srv.URL, Secret: "secret", Payload: []byte(`{}`), Attempt: 1},
+		{ID: 2, Event: outbox.TodoCompleted, URL: srv.URL, Secret: "secret", Payload: []byte(`{}`), Attempt: 1},
+		{ID: 3, Event: outbox.TodoCompleted, URL: srv.URL, Secret: "secret", Payload: []byte(`{}`), Attempt: 3},
+		{ID: 4, Event: outbox.TodoCompleted, URL: srv.URL, Secret: "wrong", Payload: []byte(`{}`), Attempt: 1},
+	}}
+
+	d := NewDispatcher(store, slog.New(slog.NewTextHandler(io.Discard, nil)), Options{
+		MaxAttempts: 3, Backoff: time.Minute, MaxBackoff: time.Hour, Timeout: time.Second, PollInterval: time.Hour,
+	})
+
+	attempts, _ := store.ClaimDeliveries(context.Background(), 10, time.Minute)
+	for _, a := range attempts {
+		d.deliver(context.Background(), a)
+	}
+
+	if len(store.results) != 4 {
+		t.Fatalf("got %d results, want 4", len(store.results))
+	}
+
+	if r := store.results[0]; !r.ok || r.code != http.StatusOK {
+		t.Errorf("delivery 1: %+v", r)
+	}
+	if r := store.results[1]; r.ok || r.code != http.StatusServiceUnavailable || r.retry == nil {
+		t.Errorf("delivery 2 should be retried: %+v", r)
+	}
+	if r := store.results[2]; r.ok || r.code != http.StatusServiceUnavailable || r.retry != nil {
+		t.Errorf("last attempt should be dead: %+v", r)
+	}
+	if r := store.results[3]; r.ok || r.code != http.StatusUnauthorized {
+		t.Errorf("delivery with a wrong secret: %+v", r)
+	}
+}